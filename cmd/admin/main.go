@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	"github.com/LeeDat03/gin-event-app/internal/privacy"
+	_ "github.com/joho/godotenv/autoload"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const usage = `Usage:
+  admin export <userId> [file]   write a user's data export archive (default: stdout)
+  admin erase <userId>           anonymize a user
+  admin promote <email>          grant the admin role to a user`
+
+func main() {
+	if len(os.Args) < 3 {
+		log.Fatal(usage)
+	}
+
+	db, err := sql.Open("sqlite3", "./data.db")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	models := database.NewModels(db)
+
+	switch os.Args[1] {
+	case "export":
+		userId := parseUserId(os.Args[2])
+		export, err := privacy.Collect(models, userId)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var out io.Writer = os.Stdout
+		if len(os.Args) > 3 {
+			f, err := os.Create(os.Args[3])
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			out = f
+		}
+		if err := privacy.WriteArchive(out, export); err != nil {
+			log.Fatal(err)
+		}
+	case "erase":
+		userId := parseUserId(os.Args[2])
+		err := models.WithTx(func(tx database.Models) error {
+			if err := tx.Users.Anonymize(userId); err != nil {
+				return err
+			}
+			return audit(tx, database.AuditAnonymize, userId, nil, nil)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "user %d erased\n", userId)
+	case "promote":
+		user, err := models.Users.GetByEmail(os.Args[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if user == nil {
+			log.Fatal("user not found")
+		}
+		err = models.WithTx(func(tx database.Models) error {
+			if err := tx.Users.SetRole(user.ID, database.RoleAdmin); err != nil {
+				return err
+			}
+			return audit(tx, database.AuditUpdate, user.ID, map[string]string{"role": user.Role}, map[string]string{"role": database.RoleAdmin})
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "user %d is now an admin\n", user.ID)
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// audit records a change to a user made from the command line.
+func audit(models database.Models, action string, userId int, before, after any) error {
+	entry := database.AuditEntry{
+		Action:       action,
+		ResourceType: database.ResourceUser,
+		ResourceId:   userId,
+		RequestId:    "cli",
+	}
+	if err := entry.SetChanges(before, after); err != nil {
+		return err
+	}
+	return models.AuditLog.Insert(&entry)
+}
+
+func parseUserId(s string) int {
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatalf("invalid user id %q", s)
+	}
+	return id
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminExportUser exports a user's personal data
+//
+//	@Summary		Exports a user's personal data
+//	@Description	Admin only. Returns the same archive as /users/me/export for any user.
+//	@Tags			admin
+//	@Produce		application/zip
+//	@Param			id		path		int	true	"User ID"
+//	@Success		200		{file}		file
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/admin/users/{id}/export [get]
+//	@Security		BearerAuth
+func (app *application) adminExportUser(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if app.getUserOrAbort(c, id) == nil {
+		return
+	}
+
+	app.writeUserExport(c, id)
+}
+
+// AdminEraseUser anonymizes a user
+//
+//	@Summary		Anonymizes a user
+//	@Description	Admin only. Erases a user's personal data while keeping their RSVPs anonymously.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id				path	int		true	"User ID"
+//	@Param			Idempotency-Key	header	string	false	"Unique key that makes retries safe"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/admin/users/{id}/erase [post]
+//	@Security		BearerAuth
+func (app *application) adminEraseUser(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if app.getUserOrAbort(c, id) == nil {
+		return
+	}
+
+	err = app.anonymizeUser(c, id)
+	if err == database.ErrNoRowsAffected {
+		ErrorResponse(c, http.StatusConflict, "User already erased")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AdminGetUsers lists users
+//
+//	@Summary		Lists users
+//	@Description	Admin only. Lists every user, including deleted users when includeDeleted is true.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			includeDeleted	query		bool	false	"Include deleted users"
+//	@Success		200				{object}	[]database.User
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/admin/users [get]
+//	@Security		BearerAuth
+func (app *application) adminGetUsers(c *gin.Context) {
+	users, err := app.models.Users.GetAll(c.Query("includeDeleted") == "true")
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// AdminRestoreUser restores a deleted user
+//
+//	@Summary		Restores a deleted user
+//	@Description	Admin only. Restores a user deleted within the retention window together with the events deleted with the account. Fails with 409 if another account signed up with the user's email meanwhile.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id				path		int		true	"User ID"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.User
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/admin/users/{id}/restore [post]
+//	@Security		BearerAuth
+func (app *application) adminRestoreUser(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = app.models.WithTx(func(tx database.Models) error {
+		if err := tx.Users.Restore(id, time.Now().Add(-app.retention)); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditRestore, database.ResourceUser, id, nil, nil)
+	})
+	if err == database.ErrNoRowsAffected {
+		ErrorResponse(c, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	user := app.getUserOrAbort(c, id)
+	if user == nil {
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// AdminGetEvents lists events
+//
+//	@Summary		Lists events
+//	@Description	Admin only. Lists the events of every organization regardless of status or visibility, including deleted events when includeDeleted is true.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			includeDeleted	query		bool	false	"Include deleted events"
+//	@Success		200				{object}	[]database.Event
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/admin/events [get]
+//	@Security		BearerAuth
+func (app *application) adminGetEvents(c *gin.Context) {
+	models := app.models.ForOrganization(database.AllOrganizations)
+	events, err := models.Events.GetAllForAdmin(c.Query("includeDeleted") == "true")
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// AdminRestoreEvent restores a deleted event
+//
+//	@Summary		Restores a deleted event
+//	@Description	Admin only. Restores any event deleted within the retention window.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Event
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/admin/events/{id}/restore [post]
+//	@Security		BearerAuth
+func (app *application) adminRestoreEvent(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	models := app.models.ForOrganization(database.AllOrganizations)
+	err = models.WithTx(func(tx database.Models) error {
+		if err := tx.Events.Restore(id, time.Now().Add(-app.retention)); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditRestore, database.ResourceEvent, id, nil, nil)
+	})
+	if err == database.ErrNoRowsAffected {
+		ErrorResponse(c, http.StatusNotFound, "event not found")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	event, err := models.Events.Get(id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, event)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+type auditLogPage struct {
+	Items    []*database.AuditEntry `json:"items"`
+	Total    int                    `json:"total"`
+	Page     int                    `json:"page"`
+	PageSize int                    `json:"pageSize"`
+}
+
+// audit records a change made by the current request. It must be given the
+// transaction-bound models the change was made with, so the entry is only
+// kept if the change is.
+func (app *application) audit(c *gin.Context, models database.Models, action, resourceType string, resourceId int, before, after any) error {
+	entry := database.AuditEntry{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceId:   resourceId,
+		RequestId:    GetRequestIDFromContext(c),
+		IP:           c.ClientIP(),
+	}
+	if user := GetUserFromContext(c); user.ID != 0 {
+		entry.ActorId = &user.ID
+	}
+	if err := entry.SetChanges(before, after); err != nil {
+		return err
+	}
+	return models.AuditLog.Insert(&entry)
+}
+
+// AdminGetAuditLog queries the audit log
+//
+//	@Summary		Queries the audit log
+//	@Description	Admin only. Returns audit log entries matching the filters, newest first.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			actorId			query		int		false	"Actor user ID"
+//	@Param			action			query		string	false	"Action (create, update, delete, restore, ...)"
+//	@Param			resourceType	query		string	false	"Resource type (user, event, attendee, venue, room, category, tag, file, ticket_type, order, promo_code, registration_form, job, event_reminders)"
+//	@Param			resourceId		query		int		false	"Resource ID"
+//	@Param			from			query		string	false	"Only entries at or after this RFC 3339 time"
+//	@Param			to				query		string	false	"Only entries before this RFC 3339 time"
+//	@Param			page			query		int		false	"Page number, starting at 1"
+//	@Param			pageSize		query		int		false	"Entries per page (max 200)"
+//	@Success		200				{object}	auditLogPage
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/admin/audit-log [get]
+//	@Security		BearerAuth
+func (app *application) adminGetAuditLog(c *gin.Context) {
+	filter, ok := auditFilterFromQuery(c)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		ErrorResponse(c, http.StatusBadRequest, "page must be a positive number")
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultAuditPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxAuditPageSize {
+		ErrorResponse(c, http.StatusBadRequest, "pageSize must be between 1 and 200")
+		return
+	}
+
+	entries, total, err := app.models.AuditLog.Query(filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, auditLogPage{
+		Items:    entries,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	})
+}
+
+// AdminExportAuditLog exports the audit log
+//
+//	@Summary		Exports the audit log
+//	@Description	Admin only. Downloads every audit log entry matching the filters as CSV (default) or JSON.
+//	@Tags			admin
+//	@Produce		text/csv
+//	@Produce		json
+//	@Param			format			query		string	false	"csv or json"
+//	@Param			actorId			query		int		false	"Actor user ID"
+//	@Param			action			query		string	false	"Action"
+//	@Param			resourceType	query		string	false	"Resource type"
+//	@Param			resourceId		query		int		false	"Resource ID"
+//	@Param			from			query		string	false	"Only entries at or after this RFC 3339 time"
+//	@Param			to				query		string	false	"Only entries before this RFC 3339 time"
+//	@Success		200				{file}		file
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/admin/audit-log/export [get]
+//	@Security		BearerAuth
+func (app *application) adminExportAuditLog(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		ErrorResponse(c, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	filter, ok := auditFilterFromQuery(c)
+	if !ok {
+		return
+	}
+
+	entries, _, err := app.models.AuditLog.Query(filter, 0, 0)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	filename := "audit-log-" + time.Now().UTC().Format("20060102-150405")
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		c.JSON(http.StatusOK, entries)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "actor_id", "action", "resource_type", "resource_id", "request_id", "ip", "before", "after"})
+	for _, e := range entries {
+		actor := ""
+		if e.ActorId != nil {
+			actor = strconv.Itoa(*e.ActorId)
+		}
+		w.Write([]string{
+			strconv.Itoa(e.ID),
+			e.CreatedAt.Format(time.RFC3339),
+			actor,
+			e.Action,
+			e.ResourceType,
+			strconv.Itoa(e.ResourceId),
+			e.RequestId,
+			e.IP,
+			string(e.Before),
+			string(e.After),
+		})
+	}
+	w.Flush()
+}
+
+func auditFilterFromQuery(c *gin.Context) (database.AuditFilter, bool) {
+	filter := database.AuditFilter{
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resourceType"),
+	}
+
+	for name, dst := range map[string]*int{"actorId": &filter.ActorId, "resourceId": &filter.ResourceId} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				ErrorResponse(c, http.StatusBadRequest, name+" must be a number")
+				return filter, false
+			}
+			*dst = n
+		}
+	}
+
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				ErrorResponse(c, http.StatusBadRequest, name+" must be an RFC 3339 time")
+				return filter, false
+			}
+			*dst = t
+		}
+	}
+
+	return filter, true
+}
@@ -28,6 +28,11 @@ type loginResponse struct {
 	Token string `json:"token"`
 }
 
+type acceptInviteRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
 // RegisterUser registers a new user
 //
 //	@Summary		Registers a new user
@@ -35,20 +40,21 @@ type loginResponse struct {
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
-//	@Param			user	body		registerRequest	true	"User"
-//	@Success		201		{object}	database.User
+//	@Param			user			body		registerRequest	true	"User"
+//	@Success		201				{object}	database.User
+//	@Failure		default			{object}	helpers.Problem
 //	@Router			/api/v1/auth/register [post]
 func (app *application) registerUser(c *gin.Context) {
 	var register registerRequest
 	if err := c.ShouldBindJSON(&register); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		BindErrorResponse(c, err)
 		return
 	}
 
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(register.Password), bcrypt.DefaultCost)
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Something went wrong")
+		ServerErrorResponse(c, err)
 		return
 	}
 	register.Password = string(hashedPassword)
@@ -58,9 +64,14 @@ func (app *application) registerUser(c *gin.Context) {
 		Name:     register.Name,
 	}
 
-	err = app.models.Users.Insert(&user)
+	err = app.models.WithTx(func(tx database.Models) error {
+		if err := tx.Users.Insert(&user); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourceUser, user.ID, nil, user)
+	})
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Something went wrong")
+		ServerErrorResponse(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, user)
@@ -73,14 +84,15 @@ func (app *application) registerUser(c *gin.Context) {
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
-//	@Param			user	body		loginRequest	true	"User"
-//	@Success		200		{object}	loginResponse
+//	@Param			user			body		loginRequest	true	"User"
+//	@Success		200				{object}	loginResponse
+//	@Failure		default			{object}	helpers.Problem
 //	@Router			/api/v1/auth/login [post]
 func (app *application) login(c *gin.Context) {
 	var auth loginRequest
 
 	if err := c.ShouldBindJSON(&auth); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		BindErrorResponse(c, err)
 		return
 	}
 
@@ -93,6 +105,7 @@ func (app *application) login(c *gin.Context) {
 	err = bcrypt.CompareHashAndPassword([]byte(existUser.Password), []byte(auth.Password))
 	if err != nil {
 		ErrorResponse(c, http.StatusUnauthorized, "Invalid password")
+		return
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -102,7 +115,7 @@ func (app *application) login(c *gin.Context) {
 	tokenStr, err := token.SignedString([]byte(app.jwtSecret))
 	fmt.Println(token, tokenStr)
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "error gen token")
+		ServerErrorResponse(c, err)
 	}
 	c.JSON(http.StatusOK, loginResponse{
 		Token: tokenStr,
@@ -110,10 +123,54 @@ func (app *application) login(c *gin.Context) {
 
 }
 
+// AcceptInvite sets the password of an account created by an attendee import
+//
+//	@Summary		Accepts an account invitation
+//	@Description	Sets the password of an account that was created when its owner was imported as an attendee, with the token mailed to them. They can log in from then on.
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			invite			body		acceptInviteRequest	true	"Invitation token and new password"
+//	@Success		200				{object}	database.User
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/auth/accept-invite [post]
+func (app *application) acceptInvite(c *gin.Context) {
+	var req acceptInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	var user *database.User
+	err = app.models.WithTx(func(tx database.Models) error {
+		var err error
+		if user, err = tx.Users.AcceptInvite(HashToken(req.Token), string(hashedPassword)); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceUser, user.ID, nil, gin.H{"password": "set"})
+	})
+	if err == database.ErrInvalidToken {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
 func (app *application) getUserOrAbort(c *gin.Context, id int) *database.User {
 	user, err := app.models.Users.Get(id)
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		ServerErrorResponse(c, err)
 		return nil
 	}
 	if user == nil {
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTagSuggestions = 10
+	maxTagSuggestions     = 50
+)
+
+// GetCategories returns all categories
+//
+//	@Summary		Returns all categories
+//	@Description	Returns the categories events can be filed under, by name
+//	@Tags			categories
+//	@Produce		json
+//	@Success		200		{object}	[]database.Category
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/categories [get]
+func (app *application) getCategories(c *gin.Context) {
+	categories, err := app.models.Categories.GetAll()
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// AdminCreateCategory creates a category
+//
+//	@Summary		Creates a category
+//	@Description	Admin only. Adds a category events can be filed under. Slugs are unique and may only contain lowercase letters, digits and hyphens.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			category		body		database.Category	true	"Category"
+//	@Param			Idempotency-Key	header		string				false	"Unique key that makes retries safe"
+//	@Success		201				{object}	database.Category
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/admin/categories [post]
+//	@Security		BearerAuth
+func (app *application) adminCreateCategory(c *gin.Context) {
+	var category database.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	err := app.models.WithTx(func(tx database.Models) error {
+		if err := tx.Categories.Insert(&category); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourceCategory, category.ID, nil, category)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// AdminUpdateCategory updates a category
+//
+//	@Summary		Updates a category
+//	@Description	Admin only. Changes the slug and name of a category.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int					true	"Category ID"
+//	@Param			category	body		database.Category	true	"Category"
+//	@Success		200			{object}	database.Category
+//	@Failure		default		{object}	helpers.Problem
+//	@Router			/api/v1/admin/categories/{id} [put]
+//	@Security		BearerAuth
+func (app *application) adminUpdateCategory(c *gin.Context) {
+	existing := app.getCategoryOrAbort(c)
+	if existing == nil {
+		return
+	}
+
+	var category database.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	category.ID = existing.ID
+	category.CreatedAt = existing.CreatedAt
+
+	err := app.models.WithTx(func(tx database.Models) error {
+		if err := tx.Categories.Update(&category); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceCategory, category.ID, existing, category)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// AdminDeleteCategory deletes a category
+//
+//	@Summary		Deletes a category
+//	@Description	Admin only. Deletes a category. Categories that events are filed under cannot be deleted (409).
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path	int	true	"Category ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/admin/categories/{id} [delete]
+//	@Security		BearerAuth
+func (app *application) adminDeleteCategory(c *gin.Context) {
+	category := app.getCategoryOrAbort(c)
+	if category == nil {
+		return
+	}
+
+	err := app.models.WithTx(func(tx database.Models) error {
+		if err := tx.Categories.Delete(category.ID); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceCategory, category.ID, category, nil)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (app *application) getCategoryOrAbort(c *gin.Context) *database.Category {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	category, err := app.models.Categories.Get(id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return nil
+	}
+	return category
+}
+
+// checkCategory returns an InvalidFieldError when the event is filed under a
+// category that does not exist.
+func checkCategory(models database.Models, event *database.Event) error {
+	if event.CategoryId == nil {
+		return nil
+	}
+	_, err := models.Categories.Get(*event.CategoryId)
+	if err == database.ErrCategoryNotFound {
+		return &InvalidFieldError{Field: "categoryId", Code: "exists", Message: "does not refer to a category"}
+	}
+	return err
+}
+
+// GetTags suggests tags
+//
+//	@Summary		Suggests tags
+//	@Description	Returns the tags starting with prefix, most used first, with the number of events carrying them. Only events the caller may see are counted.
+//	@Tags			events
+//	@Produce		json
+//	@Param			prefix	query		string	false	"Start of the tag"
+//	@Param			limit	query		int		false	"Maximum number of tags (default 10, max 50)"
+//	@Success		200		{object}	[]database.TagCount
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/tags [get]
+func (app *application) getTags(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultTagSuggestions)))
+	if err != nil || limit < 1 || limit > maxTagSuggestions {
+		ErrorResponse(c, http.StatusBadRequest, "limit must be between 1 and 50")
+		return
+	}
+
+	tags, err := app.modelsFor(c).Tags.Autocomplete(c.Query("prefix"), limit, app.viewerId(c))
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+type renameTagRequest struct {
+	Name string `json:"name" binding:"required,max=30,excludes=0x2C"`
+}
+
+type mergeTagsRequest struct {
+	From []string `json:"from" binding:"required,min=1,dive,required,max=30"`
+	Into string   `json:"into" binding:"required,max=30,excludes=0x2C"`
+}
+
+// AdminRenameTag renames a tag
+//
+//	@Summary		Renames a tag
+//	@Description	Admin only. Renames a tag on every event carrying it. Renaming to an existing tag merges the two.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string				true	"Tag"
+//	@Param			tag		body		renameTagRequest	true	"New name"
+//	@Success		200		{object}	database.TagMerge
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/admin/tags/{name} [put]
+//	@Security		BearerAuth
+func (app *application) adminRenameTag(c *gin.Context) {
+	var req renameTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	app.mergeTags(c, []string{c.Param("name")}, req.Name)
+}
+
+// AdminMergeTags merges tags
+//
+//	@Summary		Merges tags
+//	@Description	Admin only. Retags the events carrying any of the from tags with into, which is created if needed, and deletes the from tags.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			merge			body		mergeTagsRequest	true	"Tags to merge"
+//	@Param			Idempotency-Key	header		string				false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.TagMerge
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/admin/tags/merge [post]
+//	@Security		BearerAuth
+func (app *application) adminMergeTags(c *gin.Context) {
+	var req mergeTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	app.mergeTags(c, req.From, req.Into)
+}
+
+func (app *application) mergeTags(c *gin.Context, from []string, into string) {
+	if database.NormalizeTag(into) == "" {
+		ErrorResponse(c, http.StatusBadRequest, "The new tag name must not be blank")
+		return
+	}
+
+	var merge *database.TagMerge
+	err := app.models.WithTx(func(tx database.Models) error {
+		var err error
+		merge, err = tx.Tags.Merge(from, into)
+		if err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceTag, merge.IntoId, map[string][]string{"tags": merge.From}, merge)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, merge)
+}
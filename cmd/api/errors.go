@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// GetErrorCatalog lists the error codes of the API
+//
+//	@Summary		Lists the error codes of the API
+//	@Description	Every error response is an RFC 7807 problem (application/problem+json) whose code is one of these. The type of a problem links to its entry here. Internal errors only carry a request ID; quote it when reporting them.
+//	@Tags			errors
+//	@Produce		json
+//	@Success		200	{object}	[]helpers.ErrorCode
+//	@Router			/api/v1/errors [get]
+func (app *application) getErrorCatalog(c *gin.Context) {
+	c.JSON(http.StatusOK, ErrorCatalog)
+}
+
+// recoverPanic turns a panic in a handler into an internal error problem.
+func recoverPanic(c *gin.Context, recovered any) {
+	ServerErrorResponse(c, fmt.Errorf("panic: %v", recovered))
+	c.Abort()
+}
+
+func routeNotFound(c *gin.Context) {
+	ErrorResponse(c, http.StatusNotFound, "Route not found")
+}
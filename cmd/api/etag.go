@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// eventETag is the entity tag of an event, derived from its version.
+func eventETag(event *database.Event) string {
+	return `"` + strconv.Itoa(event.Version) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value
+// matches etag. Weak tags are compared weakly.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch writes a 412 response and returns false when the request has
+// an If-Match header that does not match the current version of event.
+// Requests without the header are not checked.
+func checkIfMatch(c *gin.Context, event *database.Event) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || etagMatches(header, eventETag(event)) {
+		return true
+	}
+	c.Header("ETag", eventETag(event))
+	ErrorResponse(c, http.StatusPreconditionFailed, "Event has been changed since it was read")
+	return false
+}
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to the JSON document doc.
+func mergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergeValue(t[k], v)
+		}
+	}
+	return t
+}
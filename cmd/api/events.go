@@ -1,23 +1,31 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/LeeDat03/gin-event-app/internal/database"
 	. "github.com/LeeDat03/gin-event-app/internal/helpers"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // CreateEvent creates a new event
 //
 //	@Summary		Create a new event
-//	@Description	Adds a new event to the database with the authenticated user as the owner.
+//	@Description	Adds a new event to the database with the authenticated user as the owner. New events are drafts until they are published. Events booked at a venue may not overlap other bookings of the same room (409 booking_conflict). When an address is given without latitude and longitude, the coordinates are looked up from it. Tags are lower-cased and deduplicated; categoryId must refer to an existing category.
 //	@Tags			events
 //	@Accept			json
 //	@Produce		json
-//	@Param			event	body		database.Event	true	"Event object to be created"
-//	@Success		201		{object}	database.Event
+//	@Param			event			body		database.Event	true	"Event object to be created"
+//	@Param			Idempotency-Key	header		string			false	"Unique key that makes retries safe"
+//	@Success		201				{object}	database.Event
+//	@Failure		409				{object}	helpers.Problem{conflicts=[]database.Booking,hiddenConflicts=int}
+//	@Failure		default			{object}	helpers.Problem
 //	@Router			/api/v1/events [post]
 //	@Security		BearerAuth
 func (app *application) createEvent(c *gin.Context) {
@@ -26,14 +34,33 @@ func (app *application) createEvent(c *gin.Context) {
 	user := GetUserFromContext(c)
 
 	if err := c.ShouldBindJSON(&event); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		BindErrorResponse(c, err)
 		return
 	}
 
 	event.OwnerId = user.ID
-	err := app.models.Events.Insert(&event)
+	event.Tags = database.NormalizeTags(event.Tags)
+	app.locateEvent(c, nil, &event)
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := checkCategory(tx, &event); err != nil {
+			return err
+		}
+		if err := checkBooking(tx, &event, app.viewerId(c)); err != nil {
+			return err
+		}
+		if err := tx.Events.Insert(&event); err != nil {
+			return err
+		}
+		if err := tx.Tags.SetForEvent(event.Id, event.Tags); err != nil {
+			return err
+		}
+		if _, err := tx.Events.AddRevision(event.Id, user.ID, nil); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourceEvent, event.Id, nil, event)
+	})
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		ServerErrorResponse(c, err)
 		return
 	}
 
@@ -43,31 +70,53 @@ func (app *application) createEvent(c *gin.Context) {
 // GetEvents returns all events
 //
 //	@Summary		Returns all events
-//	@Description	Returns all events
+//	@Description	Returns all public events, plus the unlisted and private events the caller owns, organizes or attends when a bearer token is sent. Filter by category slug and by tags; events must carry every tag given. With facets=true the events are wrapped in an object together with the number of matching events per category and per tag (database.EventListing). Category counts ignore the category filter, so they tell what picking another category would list.
 //	@Tags			events
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	[]database.Event
+//	@Param			category	query		string		false	"Category slug"
+//	@Param			tag			query		[]string	false	"Tag; repeat to require several"	collectionFormat(multi)
+//	@Param			facets		query		bool		false	"Return facet counts with the events"
+//	@Success		200			{object}	[]database.Event
+//	@Failure		default		{object}	helpers.Problem
 //	@Router			/api/v1/events [get]
 func (app *application) getAllEvents(c *gin.Context) {
-	events, err := app.models.Events.GetAll()
+	filter := database.EventFilter{Category: c.Query("category"), Tags: c.QueryArray("tag")}
+	withFacets, err := strconv.ParseBool(c.DefaultQuery("facets", "false"))
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to get events")
+		ErrorResponse(c, http.StatusBadRequest, "facets must be true or false")
 		return
 	}
 
-	c.JSON(http.StatusOK, events)
+	models := app.modelsFor(c)
+	events, err := models.Events.GetAll(filter, app.viewerId(c))
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	if !withFacets {
+		c.JSON(http.StatusOK, events)
+		return
+	}
+
+	facets, err := models.Events.Facets(filter, app.viewerId(c))
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, database.EventListing{Events: events, Facets: facets})
 }
 
 // GetEvent returns a single event
 //
 //	@Summary		Returns a single event
-//	@Description	Returns a single event
+//	@Description	Returns a single event. Private events are only returned to their owner, organizers and attendees.
 //	@Tags			events
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int	true	"Event ID"
-//	@Success		200	{object}	database.Event
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	database.Event
+//	@Failure		default	{object}	helpers.Problem
 //	@Router			/api/v1/events/{id} [get]
 func (app *application) getEventById(c *gin.Context) {
 	id, err := GetIDFromParam(c, "id")
@@ -76,69 +125,194 @@ func (app *application) getEventById(c *gin.Context) {
 		return
 	}
 
-	event := app.getEventOrAbort(c, id)
+	event := app.getVisibleEventOrAbort(c, id)
 	if event == nil {
 		return
 	}
 
+	c.Header("ETag", eventETag(event))
+	if inm := c.GetHeader("If-None-Match"); inm != "" && etagMatches(inm, eventETag(event)) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, event)
 }
 
 // UpdateEvent updates an existing event
 //
 //	@Summary		Updates an existing event
-//	@Description	Updates an existing event
+//	@Description	Replaces the editable fields of an event. The previous values are kept as a revision. Send the ETag of the event in If-Match to only update it if it has not changed since; a mismatch returns 412.
 //	@Tags			events
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		path		int				true	"Event ID"
-//	@Param			event	body		database.Event	true	"Event"
-//	@Success		200		{object}	database.Event
+//	@Param			id			path		int				true	"Event ID"
+//	@Param			If-Match	header		string			false	"ETag of the event"
+//	@Param			event		body		database.Event	true	"Event"
+//	@Success		200			{object}	database.Event
+//	@Failure		409			{object}	helpers.Problem{conflicts=[]database.Booking,hiddenConflicts=int}
+//	@Failure		default		{object}	helpers.Problem
 //	@Router			/api/v1/events/{id} [put]
 //	@Security		BearerAuth
 func (app *application) updateEvent(c *gin.Context) {
-	id, err := GetIDFromParam(c, "id")
-	if err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+	existingEvent := app.getEditableEventOrAbort(c)
+	if existingEvent == nil {
 		return
 	}
 
-	user := GetUserFromContext(c)
+	updatedEvent := &database.Event{}
+	if err := c.ShouldBindJSON(&updatedEvent); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
 
-	existingEvent := app.getEventOrAbort(c, id)
+	if updatedEvent.Visibility == "" {
+		updatedEvent.Visibility = existingEvent.Visibility
+	}
+	app.saveEventOrAbort(c, existingEvent, updatedEvent)
+}
+
+// PatchEvent partially updates an existing event
+//
+//	@Summary		Partially updates an existing event
+//	@Description	Applies a JSON Merge Patch (RFC 7396) to the editable fields of an event; fields left out are kept. Read-only fields in the patch are ignored. Send the ETag of the event in If-Match to only update it if it has not changed since; a mismatch returns 412.
+//	@Tags			events
+//	@Accept			json
+//	@Accept			application/merge-patch+json
+//	@Produce		json
+//	@Param			id			path		int				true	"Event ID"
+//	@Param			If-Match	header		string			false	"ETag of the event"
+//	@Param			patch		body		database.Event	true	"Fields to change"
+//	@Success		200			{object}	database.Event
+//	@Failure		409			{object}	helpers.Problem{conflicts=[]database.Booking,hiddenConflicts=int}
+//	@Failure		default		{object}	helpers.Problem
+//	@Router			/api/v1/events/{id} [patch]
+//	@Security		BearerAuth
+func (app *application) patchEvent(c *gin.Context) {
+	existingEvent := app.getEditableEventOrAbort(c)
 	if existingEvent == nil {
 		return
 	}
 
-	if existingEvent.OwnerId != user.ID {
-		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	current := *existingEvent
+	current.Date = database.DateOnly(current.Date)
+	doc, err := json.Marshal(current)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	patched, err := mergePatch(doc, patch)
+	if err != nil {
+		BindErrorResponse(c, err)
 		return
 	}
 
 	updatedEvent := &database.Event{}
-	if err := c.ShouldBindJSON(&updatedEvent); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+	if err := json.Unmarshal(patched, updatedEvent); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	if err := binding.Validator.ValidateStruct(updatedEvent); err != nil {
+		BindErrorResponse(c, err)
 		return
 	}
 
-	updatedEvent.Id = id
-	if err := app.models.Events.Update(updatedEvent); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, err.Error())
+	app.saveEventOrAbort(c, existingEvent, updatedEvent)
+}
+
+// getEditableEventOrAbort returns the event in the route if the current user
+// may change it, it is not archived and it matches the If-Match header.
+func (app *application) getEditableEventOrAbort(c *gin.Context) *database.Event {
+	event := app.getManagedEventOrAbort(c)
+	if event == nil {
+		return nil
+	}
+	if event.Status == database.StatusArchived {
+		ErrorResponse(c, http.StatusConflict, "Archived events cannot be changed")
+		return nil
+	}
+	if !checkIfMatch(c, event) {
+		return nil
+	}
+	return event
+}
+
+// saveEventOrAbort saves the editable fields of updated over existing and
+// writes the saved event, or an error response.
+func (app *application) saveEventOrAbort(c *gin.Context, existing, updated *database.Event) {
+	updated.Id = existing.Id
+	updated.OwnerId = existing.OwnerId
+	updated.OrganizationId = existing.OrganizationId
+	updated.Status = existing.Status
+	updated.PublishAt = existing.PublishAt
+	updated.DeletedAt = existing.DeletedAt
+	updated.Version = existing.Version
+	updated.Tags = database.NormalizeTags(updated.Tags)
+	app.locateEvent(c, existing, updated)
+
+	err := app.saveEvent(c, existing, updated)
+	if err == database.ErrEditConflict {
+		ErrorResponse(c, http.StatusPreconditionFailed, "Event has been changed since it was read")
 		return
 	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", eventETag(updated))
+	c.JSON(http.StatusOK, updated)
+}
+
+// saveEvent stores updated, the new state of existing, together with a
+// revision snapshot and an audit entry. It fails with
+// database.ErrEditConflict if the event is no longer at updated.Version, and
+// with the error of checkCategory or checkBooking if its category or venue
+// booking is not valid.
+func (app *application) saveEvent(c *gin.Context, existing, updated *database.Event) error {
+	return app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := checkCategory(tx, updated); err != nil {
+			return err
+		}
+		if err := checkBooking(tx, updated, app.viewerId(c)); err != nil {
+			return err
+		}
+		if err := tx.Events.Update(updated); err != nil {
+			return err
+		}
+		if err := tx.Tags.SetForEvent(updated.Id, updated.Tags); err != nil {
+			return err
+		}
+		changed := database.ChangedFields(existing, updated)
+		if len(changed) > 0 {
+			if _, err := tx.Events.AddRevision(updated.Id, GetUserFromContext(c).ID, changed); err != nil {
+				return err
+			}
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceEvent, updated.Id, existing, updated)
+	})
+}
 
-	c.JSON(http.StatusOK, updatedEvent)
+type deletedEventResponse struct {
+	EventId int `json:"eventId"`
 }
 
 // DeleteEvent deletes an existing event
 //
 //	@Summary		Deletes an existing event
-//	@Description	Deletes an existing event
+//	@Description	Deletes an existing event. The event and its attendees can be restored until the retention window ends. Send the ETag of the event in If-Match to only delete it if it has not changed since; a mismatch returns 412.
 //	@Tags			events
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path	int	true	"Event ID"
-//	@Success		204
+//	@Param			id			path		int		true	"Event ID"
+//	@Param			If-Match	header		string	false	"ETag of the event"
+//	@Success		200			{object}	deletedEventResponse
+//	@Failure		default		{object}	helpers.Problem
 //	@Router			/api/v1/events/{id} [delete]
 //	@Security		BearerAuth
 func (app *application) deleteEvent(c *gin.Context) {
@@ -155,18 +329,87 @@ func (app *application) deleteEvent(c *gin.Context) {
 		return
 	}
 
-	if existingEvent.OwnerId != user.ID {
+	if !app.canManageEvent(c, user, existingEvent) {
 		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
 		return
 	}
+	if !checkIfMatch(c, existingEvent) {
+		return
+	}
+
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Events.Delete(id, existingEvent.Version); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceEvent, id, existingEvent, nil)
+	})
+	if err == database.ErrEditConflict {
+		ErrorResponse(c, http.StatusPreconditionFailed, "Event has been changed since it was read")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deletedEventResponse{EventId: id})
+}
+
+// RestoreEvent restores a deleted event
+//
+//	@Summary		Restores a deleted event
+//	@Description	Restores an event deleted within the retention window together with its attendees. Event owner only.
+//	@Tags			events
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Event
+//	@Failure		409				{object}	helpers.Problem{conflicts=[]database.Booking,hiddenConflicts=int}
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/restore [post]
+//	@Security		BearerAuth
+func (app *application) restoreEvent(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	since := time.Now().Add(-app.retention)
+	models := app.modelsFor(c)
 
-	if err := app.models.Events.Delete(id); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, err.Error())
+	event, err := models.Events.GetDeleted(id, since)
+	if err == database.ErrEventNotFound {
+		ErrorResponse(c, http.StatusNotFound, "event not found")
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"eventId": id,
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	if !app.canManageEvent(c, GetUserFromContext(c), event) {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
+		return
+	}
+
+	deleted := *event
+	event.DeletedAt = nil
+	event.Version++
+	err = models.WithTx(func(tx database.Models) error {
+		if err := checkBooking(tx, event, app.viewerId(c)); err != nil {
+			return err
+		}
+		if err := tx.Events.Restore(id, since); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditRestore, database.ResourceEvent, id, deleted, event)
 	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
 }
 
 // AddAttendeeToEvent adds an attendee to an event
@@ -176,9 +419,12 @@ func (app *application) deleteEvent(c *gin.Context) {
 //	@Tags			attendees
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		path		int	true	"Event ID"
-//	@Param			userId	path		int	true	"User ID"
-//	@Success		201		{object}	database.Attendee
+//	@Param			id				path		int					true	"Event ID"
+//	@Param			userId			path		int					true	"User ID"
+//	@Param			Idempotency-Key	header		string				false	"Unique key that makes retries safe"
+//	@Param			registration	body		registrationRequest	false	"Answers to the registration form"
+//	@Success		201				{object}	database.Attendee
+//	@Failure		default			{object}	helpers.Problem
 //	@Router			/api/v1/events/{id}/attendees/{userId} [post]
 //	@Security		BearerAuth
 func (app *application) addAttendeeToEvent(c *gin.Context) {
@@ -204,17 +450,11 @@ func (app *application) addAttendeeToEvent(c *gin.Context) {
 	}
 
 	user := GetUserFromContext(c)
-	if user.ID != event.OwnerId {
-		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
-	}
-
-	existingAttendee, err := app.models.Attendees.GetByEventAndAttendee(eventId, userId)
-	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve")
+	if !app.requireOrganizer(c, user, event) {
 		return
 	}
-	if existingAttendee != nil {
-		ErrorResponse(c, http.StatusConflict, "Attendee exists")
+	answers, ok := bindAnswersOrAbort(c)
+	if !ok {
 		return
 	}
 
@@ -223,23 +463,80 @@ func (app *application) addAttendeeToEvent(c *gin.Context) {
 		UserId:  userId,
 	}
 
-	if err := app.models.Attendees.Insert(&attendee); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to insert")
+	// The status and membership are checked again in the transaction, so a
+	// concurrent cancel or removal from the organization can't slip in
+	// before the insert.
+	membership := GetMembershipFromContext(c)
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		current, err := tx.Events.Get(eventId)
+		if err != nil {
+			return err
+		}
+		if !acceptsAttendees(current) {
+			event = current
+			return errNotAcceptingAttendees
+		}
+		if membership != nil {
+			member, err := tx.Organizations.GetMembership(membership.OrganizationId, userId)
+			if err != nil {
+				return err
+			}
+			if member == nil {
+				return errNotMember
+			}
+		}
+		form, err := currentForm(tx, eventId)
+		if err != nil {
+			return err
+		}
+		checked, err := checkAnswers(form, answers, "answers")
+		if err != nil {
+			return err
+		}
+		if err := checkCapacity(tx, eventId, 1); err != nil {
+			return err
+		}
+		if err := tx.Attendees.Insert(&attendee); err != nil {
+			return err
+		}
+		if err := saveAnswers(tx, form, &attendee, checked); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourceAttendee, attendee.ID, nil, attendee)
+	})
+	switch err {
+	case nil:
+	case errNotAcceptingAttendees:
+		ErrorResponse(c, http.StatusConflict, "Event is "+event.Status)
+		return
+	case errNotMember:
+		ErrorResponse(c, http.StatusBadRequest, "User is not a member of this organization")
+		return
+	case database.ErrAttendeeExists:
+		ProblemResponse(c, http.StatusConflict, CodeAlreadyExists, "Attendee exists")
+		return
+	case errEventFull:
+		ProblemResponse(c, http.StatusConflict, CodeEventFull, "Event is full")
+		return
+	default:
+		ServerErrorResponse(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, attendee)
+	app.sendTicket(&attendee)
+	c.JSON(http.StatusCreated, attendee)
 }
 
 // GetAttendeesForEvent returns all attendees for a given event
 //
 //	@Summary		Returns all attendees for a given event
-//	@Description	Returns all attendees for a given event
+//	@Description	Returns all attendees for a given event. The list of a private event is only visible to its owner, organizers and attendees.
 //	@Tags			attendees
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int	true	"Event ID"
-//	@Success		200	{object}	[]database.User
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]database.User
+//	@Failure		default	{object}	helpers.Problem
 //	@Router			/api/v1/events/{id}/attendees [get]
 func (app *application) getAttendeesForEvent(c *gin.Context) {
 	id, err := GetIDFromParam(c, "id")
@@ -248,9 +545,13 @@ func (app *application) getAttendeesForEvent(c *gin.Context) {
 		return
 	}
 
-	users, err := app.models.Attendees.GetAttendeesByEvent(id)
+	if app.getVisibleEventOrAbort(c, id) == nil {
+		return
+	}
+
+	users, err := app.modelsFor(c).Attendees.GetAttendeesByEvent(id)
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		ServerErrorResponse(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, users)
@@ -266,6 +567,7 @@ func (app *application) getAttendeesForEvent(c *gin.Context) {
 //	@Param			id		path	int	true	"Event ID"
 //	@Param			userId	path	int	true	"User ID"
 //	@Success		204
+//	@Failure		default	{object}	helpers.Problem
 //	@Router			/api/v1/events/{id}/attendees/{userId} [delete]
 //	@Security		BearerAuth
 func (app *application) deleteAttendeeFromEvent(c *gin.Context) {
@@ -285,14 +587,22 @@ func (app *application) deleteAttendeeFromEvent(c *gin.Context) {
 		return
 	}
 	user := GetUserFromContext(c)
-	if user.ID != event.OwnerId {
-		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
+	if !app.requireOrganizer(c, user, event) {
 		return
 	}
 
-	err = app.models.Attendees.Delete(eventId, userId)
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		attendee, err := tx.Attendees.GetByEventAndAttendee(eventId, userId)
+		if err != nil || attendee == nil {
+			return err
+		}
+		if err := tx.Attendees.Delete(eventId, userId); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceAttendee, attendee.ID, attendee, nil)
+	})
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed")
+		ServerErrorResponse(c, err)
 		return
 	}
 	c.JSON(http.StatusNoContent, nil)
@@ -301,24 +611,24 @@ func (app *application) deleteAttendeeFromEvent(c *gin.Context) {
 // GetEventsByAttendee returns all events for a given attendee
 //
 //	@Summary		Returns all events for a given attendee
-//	@Description	Returns all events for a given attendee
+//	@Description	Returns the events a user attends that the caller may see
 //	@Tags			attendees
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int	true	"Attendee ID"
-//	@Success		200	{object}	[]database.Event
+//	@Param			id		path		int	true	"Attendee ID"
+//	@Success		200		{object}	[]database.Event
+//	@Failure		default	{object}	helpers.Problem
 //	@Router			/api/v1/attendees/{id}/events [get]
 func (app *application) getEventsByAttendee(c *gin.Context) {
-	fmt.Println("run")
 	id, err := GetIDFromParam(c, "id")
 	if err != nil {
 		ErrorResponse(c, http.StatusBadRequest, "not valid attendee")
 		return
 	}
 
-	events, err := app.models.Events.GetByAttendee(id)
+	events, err := app.modelsFor(c).Events.GetByAttendee(id, app.viewerId(c))
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		ServerErrorResponse(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, events)
@@ -326,14 +636,143 @@ func (app *application) getEventsByAttendee(c *gin.Context) {
 }
 
 func (app *application) getEventOrAbort(c *gin.Context, id int) *database.Event {
-	event, err := app.models.Events.Get(id)
+	event, err := app.modelsFor(c).Events.Get(id)
+	if err == database.ErrEventNotFound {
+		ErrorResponse(c, http.StatusNotFound, "event not found")
+		return nil
+	}
 	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		ServerErrorResponse(c, err)
 		return nil
 	}
+	return event
+}
+
+// modelsFor returns the models scoped to the organization in the route, or
+// to the personal namespace outside organization routes.
+func (app *application) modelsFor(c *gin.Context) *database.Models {
+	if membership := GetMembershipFromContext(c); membership != nil {
+		models := app.models.ForOrganization(membership.OrganizationId)
+		return &models
+	}
+	return &app.models
+}
+
+// canManageEvent reports whether user may change the event: its owner, or an
+// admin of the organization the event belongs to.
+func (app *application) canManageEvent(c *gin.Context, user *database.User, event *database.Event) bool {
+	if event.OwnerId == user.ID {
+		return true
+	}
+	membership := GetMembershipFromContext(c)
+	return membership != nil && membership.CanManage()
+}
+
+// getVisibleEventOrAbort is getEventOrAbort for read routes: events the
+// current user may not see are reported as not found. Drafts are only
+// visible to organizers.
+func (app *application) getVisibleEventOrAbort(c *gin.Context, id int) *database.Event {
+	event := app.getEventOrAbort(c, id)
 	if event == nil {
-		ErrorResponse(c, http.StatusNotFound, "event not found")
 		return nil
 	}
-	return event
+
+	isDraft := event.Status == database.StatusDraft
+	if event.Visibility != database.VisibilityPrivate && !isDraft {
+		return event
+	}
+
+	user := GetUserFromContext(c)
+	if user.ID != 0 {
+		ok, err := app.isOrganizer(c, user, event)
+		if err != nil {
+			ServerErrorResponse(c, err)
+			return nil
+		}
+		if ok {
+			return event
+		}
+
+		if !isDraft {
+			attendee, err := app.modelsFor(c).Attendees.GetByEventAndAttendee(event.Id, user.ID)
+			if err != nil {
+				ServerErrorResponse(c, err)
+				return nil
+			}
+			if attendee != nil {
+				return event
+			}
+		}
+	}
+
+	ErrorResponse(c, http.StatusNotFound, "event not found")
+	return nil
+}
+
+var (
+	errNotAcceptingAttendees = errors.New("event does not accept attendees")
+	errNotMember             = errors.New("user is not a member of the organization")
+	errEventFull             = errors.New("event is full")
+	errTicketRequired        = errors.New("event sells tickets")
+)
+
+// acceptsAttendees reports whether attendees may still be added: drafts can
+// be prepared by organizers, published events are open.
+func acceptsAttendees(event *database.Event) bool {
+	return event.Status == database.StatusDraft || event.Status == database.StatusPublished
+}
+
+// checkCapacity returns errEventFull unless seats more attendees fit in the
+// event's capacity, or that of its room or venue. Tickets reserved by
+// pending orders count as taken.
+func checkCapacity(models database.Models, eventId, seats int) error {
+	capacity, err := models.Events.Capacity(eventId)
+	if err != nil || capacity == nil {
+		return err
+	}
+	n, err := models.Attendees.CountByEvent(eventId)
+	if err != nil {
+		return err
+	}
+	reserved, err := models.Orders.CountReserved(eventId)
+	if err != nil {
+		return err
+	}
+	if n+reserved+seats > *capacity {
+		return errEventFull
+	}
+	return nil
+}
+
+// isOrganizer reports whether user may run the event day to day: whoever can
+// manage it, plus the organizers they appointed.
+func (app *application) isOrganizer(c *gin.Context, user *database.User, event *database.Event) (bool, error) {
+	if app.canManageEvent(c, user, event) {
+		return true, nil
+	}
+	return app.modelsFor(c).Events.IsOrganizer(event.Id, user.ID)
+}
+
+// requireOrganizer writes a 403 and returns false unless user is an
+// organizer of the event.
+func (app *application) requireOrganizer(c *gin.Context, user *database.User, event *database.Event) bool {
+	ok, err := app.isOrganizer(c, user, event)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return false
+	}
+	if !ok {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
+		return false
+	}
+	return true
+}
+
+// viewerId is the user listings are filtered for: 0 for anonymous visitors,
+// AnyViewer for organization admins who may see every event of their tenant.
+func (app *application) viewerId(c *gin.Context) int {
+	if membership := GetMembershipFromContext(c); membership != nil && membership.CanManage() {
+		return database.AnyViewer
+	}
+	return GetUserFromContext(c).ID
 }
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/LeeDat03/gin-event-app/internal/thumbnail"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxCoverSize      = 5 << 20
+	maxAttachmentSize = 20 << 20
+	maxAttachments    = 20
+	thumbnailSize     = 400
+	// signedURLTTL is how long download links handed out by the API work.
+	signedURLTTL = time.Hour
+	filePurpose  = "file"
+)
+
+var errTooManyAttachments = errors.New("too many attachments")
+
+// coverTypes are the content types accepted for cover images; thumbnails can
+// be made of all of them.
+var coverTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// attachmentTypes are the content types accepted for attachments. Office
+// documents (.docx, .pptx, .xlsx) are zip archives and sniff as such.
+var attachmentTypes = []string{"application/pdf", "application/zip", "image/jpeg", "image/png", "image/gif", "image/webp", "text/plain; charset=utf-8"}
+
+// officeTypes refine the sniffed type of zip uploads by their extension.
+var officeTypes = map[string]string{
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// UploadEventCover sets the cover image of an event
+//
+//	@Summary		Sets the cover image of an event
+//	@Description	Uploads a JPEG, PNG or GIF of at most 5 MB as the cover image of an event, replacing the previous one. The type is sniffed from the content; a thumbnail is generated. The response carries signed download URLs that expire after an hour.
+//	@Tags			files
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			id		path		int		true	"Event ID"
+//	@Param			file	formData	file	true	"Image"
+//	@Success		200		{object}	database.EventFile
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/cover [put]
+//	@Security		BearerAuth
+func (app *application) uploadEventCover(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	file := app.readUploadOrAbort(c, event, database.FileCover, maxCoverSize, coverTypes)
+	if file == nil {
+		return
+	}
+
+	var previous *database.EventFile
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		var err error
+		previous, err = tx.EventFiles.GetCover(event.Id)
+		if err != nil && err != database.ErrFileNotFound {
+			return err
+		}
+		if previous != nil {
+			if err := tx.EventFiles.Delete(previous.ID); err != nil {
+				return err
+			}
+		}
+		if err := tx.EventFiles.Insert(file); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceFile, file.ID, previous, file)
+	})
+	if err != nil {
+		app.deleteBlobs(file)
+		ServerErrorResponse(c, err)
+		return
+	}
+	if previous != nil {
+		app.deleteBlobs(previous)
+	}
+
+	app.signFile(file)
+	c.JSON(http.StatusOK, file)
+}
+
+// GetEventCover returns the cover image of an event
+//
+//	@Summary		Returns the cover image of an event
+//	@Description	Returns the cover image of an event with signed download URLs that expire after an hour
+//	@Tags			files
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	database.EventFile
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/cover [get]
+func (app *application) getEventCover(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	event := app.getVisibleEventOrAbort(c, id)
+	if event == nil {
+		return
+	}
+
+	file, err := app.models.EventFiles.GetCover(event.Id)
+	if err == database.ErrFileNotFound {
+		ErrorResponse(c, http.StatusNotFound, "event has no cover image")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	app.signFile(file)
+	c.JSON(http.StatusOK, file)
+}
+
+// DeleteEventCover removes the cover image of an event
+//
+//	@Summary		Removes the cover image of an event
+//	@Description	Removes the cover image of an event
+//	@Tags			files
+//	@Param			id	path	int	true	"Event ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/cover [delete]
+//	@Security		BearerAuth
+func (app *application) deleteEventCover(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	var file *database.EventFile
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		var err error
+		if file, err = tx.EventFiles.GetCover(event.Id); err != nil {
+			return err
+		}
+		if err := tx.EventFiles.Delete(file.ID); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceFile, file.ID, file, nil)
+	})
+	if err == database.ErrFileNotFound {
+		ErrorResponse(c, http.StatusNotFound, "event has no cover image")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	app.deleteBlobs(file)
+	c.Status(http.StatusNoContent)
+}
+
+// UploadEventAttachment attaches a file to an event
+//
+//	@Summary		Attaches a file to an event
+//	@Description	Uploads a PDF, office document, image or plain text file of at most 20 MB to an event, which can have up to 20 attachments. The type is sniffed from the content; images get a thumbnail. The response carries signed download URLs that expire after an hour.
+//	@Tags			files
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			file			formData	file	true	"File"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		201				{object}	database.EventFile
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/attachments [post]
+//	@Security		BearerAuth
+func (app *application) uploadEventAttachment(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	file := app.readUploadOrAbort(c, event, database.FileAttachment, maxAttachmentSize, attachmentTypes)
+	if file == nil {
+		return
+	}
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		attachments, err := tx.EventFiles.GetAttachments(event.Id)
+		if err != nil {
+			return err
+		}
+		if len(attachments) >= maxAttachments {
+			return errTooManyAttachments
+		}
+		if err := tx.EventFiles.Insert(file); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourceFile, file.ID, nil, file)
+	})
+	if err != nil {
+		app.deleteBlobs(file)
+		if err == errTooManyAttachments {
+			ErrorResponse(c, http.StatusConflict, "An event can have at most "+strconv.Itoa(maxAttachments)+" attachments")
+			return
+		}
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	app.signFile(file)
+	noStore(c)
+	c.JSON(http.StatusCreated, file)
+}
+
+// GetEventAttachments lists the attachments of an event
+//
+//	@Summary		Lists the attachments of an event
+//	@Description	Lists the attachments of an event, oldest first, with signed download URLs that expire after an hour
+//	@Tags			files
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]database.EventFile
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/attachments [get]
+func (app *application) getEventAttachments(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	event := app.getVisibleEventOrAbort(c, id)
+	if event == nil {
+		return
+	}
+
+	files, err := app.models.EventFiles.GetAttachments(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	for _, file := range files {
+		app.signFile(file)
+	}
+	c.JSON(http.StatusOK, files)
+}
+
+// DeleteEventAttachment removes an attachment
+//
+//	@Summary		Removes an attachment
+//	@Description	Removes an attachment of an event
+//	@Tags			files
+//	@Param			id		path	int	true	"Event ID"
+//	@Param			fileId	path	int	true	"Attachment ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/attachments/{fileId} [delete]
+//	@Security		BearerAuth
+func (app *application) deleteEventAttachment(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+	fileId, err := GetIDFromParam(c, "fileId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var file *database.EventFile
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		var err error
+		if file, err = tx.EventFiles.GetForEvent(event.Id, fileId, database.FileAttachment); err != nil {
+			return err
+		}
+		if err := tx.EventFiles.Delete(file.ID); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceFile, file.ID, file, nil)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	app.deleteBlobs(file)
+	c.Status(http.StatusNoContent)
+}
+
+// DownloadFile downloads an uploaded file
+//
+//	@Summary		Downloads an uploaded file
+//	@Description	Serves a cover image, attachment or thumbnail through a signed URL handed out by the other file routes. The URL expires after an hour and stops working once the event is deleted.
+//	@Tags			files
+//	@Produce		octet-stream
+//	@Param			token	path	string	true	"Signed file token"
+//	@Success		200		{file}	file
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/files/{token} [get]
+func (app *application) downloadFile(c *gin.Context) {
+	value, ok := VerifySignedValue(app.jwtSecret, filePurpose, c.Param("token"))
+	parts := strings.Split(value, ".")
+	if !ok || len(parts) != 3 {
+		ErrorResponse(c, http.StatusNotFound, "file not found")
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		ErrorResponse(c, http.StatusNotFound, "file not found")
+		return
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		ErrorResponse(c, http.StatusGone, "The download link has expired")
+		return
+	}
+
+	file, err := app.models.EventFiles.Get(id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	// Files of deleted events are kept until the event is purged, so it can
+	// be restored, but are no longer served.
+	allModels := app.models.ForOrganization(database.AllOrganizations)
+	if _, err := allModels.Events.Get(file.EventId); err != nil {
+		ServerErrorResponse(c, database.ErrFileNotFound)
+		return
+	}
+
+	key, filename, contentType, size, disposition := file.Key, file.Filename, file.ContentType, file.Size, "attachment"
+	if parts[1] == "thumbnail" {
+		if file.ThumbnailKey == "" {
+			ErrorResponse(c, http.StatusNotFound, "file has no thumbnail")
+			return
+		}
+		key, contentType, size = file.ThumbnailKey, "image/jpeg", -1
+		filename = strings.TrimSuffix(filename, path.Ext(filename)) + "-thumbnail.jpg"
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+
+	blob, err := app.blobs.Get(c.Request.Context(), key)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	defer blob.Close()
+
+	c.DataFromReader(http.StatusOK, size, contentType, blob, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": filename}),
+		"Cache-Control":          "private, max-age=" + strconv.FormatInt(max(0, expires-time.Now().Unix()), 10),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// readUploadOrAbort reads the "file" field of a multipart upload of at most
+// maxSize bytes, checks its sniffed content type against allowed, stores it,
+// and a thumbnail for images, in the blob store and returns its unsaved
+// record.
+func (app *application) readUploadOrAbort(c *gin.Context, event *database.Event, kind string, maxSize int64, allowed []string) *database.EventFile {
+	// Leave room for the multipart framing around the file.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+64<<10)
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || err == nil && header.Size > maxSize {
+		ErrorResponse(c, http.StatusRequestEntityTooLarge, "The file must be at most "+strconv.FormatInt(maxSize>>20, 10)+" MB")
+		return nil
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Send the file as the multipart form field \"file\"")
+		return nil
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return nil
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return nil
+	}
+
+	filename := path.Base(strings.ReplaceAll(header.Filename, "\\", "/"))
+	ext := strings.ToLower(path.Ext(filename))
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(allowed, contentType) {
+		ErrorResponse(c, http.StatusUnsupportedMediaType, "Files of type "+contentType+" are not allowed here")
+		return nil
+	}
+	if office, ok := officeTypes[ext]; ok && contentType == "application/zip" {
+		contentType = office
+	}
+
+	user := GetUserFromContext(c)
+	file := &database.EventFile{
+		EventId:     event.Id,
+		Kind:        kind,
+		Key:         "events/" + strconv.Itoa(event.Id) + "/" + randomHex() + keyExtension(ext),
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		UploadedBy:  &user.ID,
+	}
+
+	ctx := c.Request.Context()
+	if thumbnail.CanMake(contentType) {
+		thumb, err := thumbnail.Make(data, thumbnailSize)
+		if err != nil {
+			ErrorResponse(c, http.StatusUnsupportedMediaType, "The image could not be read")
+			return nil
+		}
+		file.ThumbnailKey = strings.TrimSuffix(file.Key, path.Ext(file.Key)) + "-thumb.jpg"
+		if err := app.blobs.Put(ctx, file.ThumbnailKey, thumb, "image/jpeg"); err != nil {
+			ServerErrorResponse(c, err)
+			return nil
+		}
+	}
+	if err := app.blobs.Put(ctx, file.Key, data, contentType); err != nil {
+		app.deleteBlobs(file)
+		ServerErrorResponse(c, err)
+		return nil
+	}
+	return file
+}
+
+// signFile fills in the signed download URLs of file.
+func (app *application) signFile(file *database.EventFile) {
+	expires := strconv.FormatInt(time.Now().Add(signedURLTTL).Unix(), 10)
+	sign := func(variant string) string {
+		token := SignValue(app.jwtSecret, filePurpose, strconv.Itoa(file.ID)+"."+variant+"."+expires)
+		return app.baseURL + "/api/v1/files/" + token
+	}
+	file.URL = sign("original")
+	if file.ThumbnailKey != "" {
+		file.ThumbnailURL = sign("thumbnail")
+	}
+}
+
+// deleteBlobs removes the blobs of a file whose record is gone or was never
+// saved. Failures are only logged: a leftover blob is harmless.
+func (app *application) deleteBlobs(file *database.EventFile) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, key := range file.Keys() {
+		if err := app.blobs.Delete(ctx, key); err != nil {
+			log.Printf("delete blob %s: %v", key, err)
+		}
+	}
+}
+
+func randomHex() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// keyExtension keeps the extension of an upload in its blob key when it is
+// safe to, which makes blobs easier to tell apart when browsing the store.
+func keyExtension(ext string) string {
+	if len(ext) < 2 || len(ext) > 6 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// sweepOrphanedFiles deletes the files of purged events from the blob store.
+func (app *application) sweepOrphanedFiles(models database.Models) {
+	files, err := models.EventFiles.DeleteOrphaned()
+	if err != nil {
+		log.Printf("delete files of purged events: %v", err)
+		return
+	}
+	for _, file := range files {
+		app.deleteBlobs(file)
+	}
+	if len(files) > 0 {
+		log.Printf("deleted %d files of purged events", len(files))
+	}
+}
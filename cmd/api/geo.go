@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	"github.com/LeeDat03/gin-event-app/internal/geo"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultNearbyRadius = 10
+	maxNearbyRadius     = 500
+)
+
+// NearbyEvents lists events close to a point
+//
+//	@Summary		Lists events near a point
+//	@Description	Returns the events within radius kilometres of lat/lng, nearest first, with their distance in kilometres. Events without coordinates are left out. Only events the caller may see are returned.
+//	@Tags			events
+//	@Produce		json
+//	@Param			lat		query		number	true	"Latitude of the centre"
+//	@Param			lng		query		number	true	"Longitude of the centre"
+//	@Param			radius	query		number	false	"Radius in kilometres (default 10, max 500)"
+//	@Param			limit	query		int		false	"Maximum number of results (max 100)"
+//	@Param			offset	query		int		false	"Number of results to skip"
+//	@Success		200		{object}	[]database.NearbyEvent
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/nearby [get]
+func (app *application) nearbyEvents(c *gin.Context) {
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		ErrorResponse(c, http.StatusBadRequest, "lat must be a latitude between -90 and 90")
+		return
+	}
+	lng, err := strconv.ParseFloat(c.Query("lng"), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		ErrorResponse(c, http.StatusBadRequest, "lng must be a longitude between -180 and 180")
+		return
+	}
+	radius, err := strconv.ParseFloat(c.DefaultQuery("radius", strconv.Itoa(defaultNearbyRadius)), 64)
+	if err != nil || radius <= 0 || radius > maxNearbyRadius {
+		ErrorResponse(c, http.StatusBadRequest, "radius must be greater than 0 and at most 500 kilometres")
+		return
+	}
+	limit, offset, ok := pageOrAbort(c)
+	if !ok {
+		return
+	}
+
+	events, err := app.modelsFor(c).Events.Nearby(geo.Point{Lat: lat, Lng: lng}, radius, limit, offset, app.viewerId(c))
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// locateEvent fills in the coordinates of event from its address when none
+// were given. When an update changes the address of existing but keeps its
+// coordinates, they are looked up again. An address the geocoder cannot place
+// leaves the event without coordinates.
+func (app *application) locateEvent(c *gin.Context, existing, event *database.Event) {
+	if existing != nil && database.AddressOf(existing.Address) != database.AddressOf(event.Address) &&
+		sameCoordinate(existing.Latitude, event.Latitude) && sameCoordinate(existing.Longitude, event.Longitude) {
+		event.Latitude, event.Longitude = nil, nil
+	}
+	if event.Latitude != nil || event.Address == nil {
+		return
+	}
+
+	point, err := app.geocoder.Geocode(c.Request.Context(), event.Address.String())
+	if err != nil {
+		if !errors.Is(err, geo.ErrNoMatch) {
+			log.Printf("request %s: geocode %q: %v", GetRequestIDFromContext(c), event.Address.String(), err)
+		}
+		return
+	}
+	event.Latitude, event.Longitude = &point.Lat, &point.Lng
+}
+
+func sameCoordinate(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
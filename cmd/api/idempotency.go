@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize bounds the bodies read to fingerprint a request.
+	// It is the largest body any handler accepts: an attachment with its
+	// multipart framing.
+	maxIdempotentBodySize = maxAttachmentSize + 64<<10
+	// idempotentBodyMemory is how much of a body is kept in memory; larger
+	// bodies are spooled to a temporary file for the handler to read.
+	idempotentBodyMemory = 1 << 20
+)
+
+// replayedHeaders are the response headers stored along with a response and
+// sent again when it is replayed. Others, such as X-Request-ID, describe the
+// original exchange only.
+var replayedHeaders = []string{"Location", "ETag", "Last-Modified", "Content-Disposition"}
+
+// responseRecorder keeps a copy of the response body written by a handler.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes POST requests sent with an Idempotency-Key
+// header safe to retry. The first request with a key runs normally and its
+// response is stored for app.idempotencyTTL; retries with the same key and
+// body get the stored response back instead of running again. Reusing a key
+// for a different request returns 422, and a retry that arrives while the
+// first request is still running returns 409. Server errors are not stored,
+// so those requests can be retried with the same key, and neither are
+// responses marked no-store, which carry credentials; retrying those runs
+// the request again. Bodies over
+// maxIdempotentBodySize return 413; large ones are spooled to disk rather
+// than kept in memory. Keys are scoped to the current user and must run
+// after the auth middleware.
+func (app *application) IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			ErrorResponse(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			c.Abort()
+			return
+		}
+
+		body, fingerprint, err := fingerprintBody(c)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ErrorResponse(c, http.StatusRequestEntityTooLarge, "The request body must be at most "+strconv.Itoa(maxIdempotentBodySize>>20)+" MB")
+			c.Abort()
+			return
+		}
+		if err != nil {
+			BindErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+		defer body.Close()
+		c.Request.Body = body
+
+		userId := GetUserFromContext(c).ID
+		stored, reserved, err := app.models.Idempotency.Reserve(userId, key, fingerprint, time.Now().Add(app.idempotencyTTL))
+		if err != nil {
+			ServerErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+
+		if !reserved {
+			switch {
+			case stored.Fingerprint != fingerprint:
+				ProblemResponse(c, http.StatusUnprocessableEntity, CodeIdempotencyMismatch, "Idempotency-Key was already used for a different request")
+			case stored.StatusCode == 0:
+				c.Header("Retry-After", "1")
+				ProblemResponse(c, http.StatusConflict, CodeRequestInProgress, "A request with this Idempotency-Key is still in progress")
+			default:
+				for name, values := range stored.Headers {
+					for _, value := range values {
+						c.Writer.Header().Add(name, value)
+					}
+				}
+				c.Header("Idempotency-Replayed", "true")
+				c.Data(stored.StatusCode, stored.ContentType, stored.ResponseBody)
+			}
+			c.Abort()
+			return
+		}
+
+		// Release the key unless the response gets stored, so the request
+		// can be retried after a server error or a panic.
+		done := false
+		defer func() {
+			if !done {
+				if err := app.models.Idempotency.Release(userId, key); err != nil {
+					log.Printf("release idempotency key: %v", err)
+				}
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || recorder.Header().Get("Cache-Control") == "no-store" {
+			return
+		}
+		headers := http.Header{}
+		for _, name := range replayedHeaders {
+			for _, value := range recorder.Header().Values(name) {
+				headers.Add(name, value)
+			}
+		}
+		if err := app.models.Idempotency.Complete(userId, key, status, recorder.Header().Get("Content-Type"), headers, recorder.body.Bytes()); err != nil {
+			log.Printf("store idempotent response: %v", err)
+			return
+		}
+		done = true
+	}
+}
+
+// noStore marks a response that carries credentials, such as tokens or
+// signed URLs, so that it is neither cached nor stored for replay.
+func noStore(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+}
+
+// fingerprintBody reads the body of a request of at most
+// maxIdempotentBodySize bytes and returns a copy of it for the handler
+// together with the fingerprint of the request. The copy must be closed.
+func fingerprintBody(c *gin.Context) (io.ReadCloser, string, error) {
+	sum := sha256.New()
+	sum.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+	src := http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodySize)
+
+	var buf bytes.Buffer
+	_, err := io.CopyN(io.MultiWriter(&buf, sum), src, idempotentBodyMemory+1)
+	if err == io.EOF {
+		return io.NopCloser(&buf), hex.EncodeToString(sum.Sum(nil)), nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	f, err := os.CreateTemp("", "idempotent-body-*")
+	if err != nil {
+		return nil, "", err
+	}
+	spool := &tempFile{f}
+	if _, err := buf.WriteTo(f); err != nil {
+		spool.Close()
+		return nil, "", err
+	}
+	if _, err := io.Copy(io.MultiWriter(f, sum), src); err != nil {
+		spool.Close()
+		return nil, "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		spool.Close()
+		return nil, "", err
+	}
+	return spool, hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// tempFile is a temporary file that is removed when it is closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if rmErr := os.Remove(f.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
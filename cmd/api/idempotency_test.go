@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentServer serves POST /things behind the idempotency middleware
+// for user. The handler counts its runs, answers with the body it read and
+// waits for a value on gate, if set, before answering.
+type idempotentServer struct {
+	router  *gin.Engine
+	runs    atomic.Int32
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func newIdempotentServer(app *application, user *database.User) *idempotentServer {
+	s := &idempotentServer{router: gin.New()}
+	s.router.Use(func(c *gin.Context) { c.Set("user", user) })
+	s.router.POST("/things", app.IdempotencyMiddleware(), func(c *gin.Context) {
+		s.runs.Add(1)
+		body, _ := io.ReadAll(c.Request.Body)
+		if s.gate != nil {
+			s.entered <- struct{}{}
+			<-s.gate
+		}
+		c.Header("Location", "/things/1")
+		c.Data(http.StatusCreated, "application/json", body)
+	})
+	return s
+}
+
+func (s *idempotentServer) post(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// problemCode returns the code of a problem response.
+func problemCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("problem %q: %v", w.Body.String(), err)
+	}
+	return problem.Code
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	app := newTestApp(t)
+	s := newIdempotentServer(app, newTestUser(t, app, "alice@example.com"))
+
+	first := s.post("key-1", `{"n":1}`)
+	retry := s.post("key-1", `{"n":1}`)
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated {
+		t.Fatalf("status = %d then %d, want %d twice", first.Code, retry.Code, http.StatusCreated)
+	}
+	if got := s.runs.Load(); got != 1 {
+		t.Errorf("handler ran %d times, want 1", got)
+	}
+	if got := retry.Header().Get("Idempotency-Replayed"); got != "true" {
+		t.Errorf("Idempotency-Replayed = %q, want %q", got, "true")
+	}
+	if got := retry.Header().Get("Location"); got != "/things/1" {
+		t.Errorf("Location = %q, want %q", got, "/things/1")
+	}
+	if got, want := retry.Body.String(), first.Body.String(); got != want {
+		t.Errorf("replayed body = %q, want %q", got, want)
+	}
+}
+
+// TestIdempotencyKeyReused sends a different request with a key that was
+// already used, which must not run and return 422.
+func TestIdempotencyKeyReused(t *testing.T) {
+	app := newTestApp(t)
+	s := newIdempotentServer(app, newTestUser(t, app, "alice@example.com"))
+
+	if w := s.post("key-1", `{"n":1}`); w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	w := s.post("key-1", `{"n":2}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if got := problemCode(t, w); got != CodeIdempotencyMismatch {
+		t.Errorf("code = %q, want %q", got, CodeIdempotencyMismatch)
+	}
+	if got := s.runs.Load(); got != 1 {
+		t.Errorf("handler ran %d times, want 1", got)
+	}
+
+	// Keys are scoped to their user.
+	other := newIdempotentServer(app, newTestUser(t, app, "bob@example.com"))
+	if w := other.post("key-1", `{"n":2}`); w.Code != http.StatusCreated {
+		t.Errorf("status for another user = %d, want %d", w.Code, http.StatusCreated)
+	}
+}
+
+// TestIdempotencyRequestInProgress retries a request while the first one is
+// still running, which must return 409 without running it twice.
+func TestIdempotencyRequestInProgress(t *testing.T) {
+	app := newTestApp(t)
+	s := newIdempotentServer(app, newTestUser(t, app, "alice@example.com"))
+	s.entered, s.gate = make(chan struct{}), make(chan struct{})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- s.post("key-1", `{"n":1}`) }()
+	<-s.entered
+
+	w := s.post("key-1", `{"n":1}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if got := problemCode(t, w); got != CodeRequestInProgress {
+		t.Errorf("code = %q, want %q", got, CodeRequestInProgress)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want %q", got, "1")
+	}
+
+	close(s.gate)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Fatalf("first status = %d, want %d", first.Code, http.StatusCreated)
+	}
+	if w := s.post("key-1", `{"n":1}`); w.Code != http.StatusCreated || w.Header().Get("Idempotency-Replayed") != "true" {
+		t.Errorf("retry after completion = %d, replayed %q, want a replayed %d", w.Code, w.Header().Get("Idempotency-Replayed"), http.StatusCreated)
+	}
+	if got := s.runs.Load(); got != 1 {
+		t.Errorf("handler ran %d times, want 1", got)
+	}
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/LeeDat03/gin-event-app/internal/jobs"
+	"github.com/LeeDat03/gin-event-app/internal/mailer"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize bounds the size of attendee imports and maxImportRows the
+// number of rows below their header.
+const (
+	maxImportSize = 1 << 20
+	maxImportRows = 1000
+)
+
+// inviteTokenTTL is how long accounts created by an import can be claimed.
+const inviteTokenTTL = 7 * 24 * time.Hour
+
+// Outcomes of the rows of an attendee import.
+const (
+	importAdded   = "added"
+	importInvited = "invited"
+	importSkipped = "skipped"
+	importFailed  = "failed"
+)
+
+// errDryRun rolls back the transaction of an import that is only previewed.
+var errDryRun = errors.New("dry run")
+
+// importRow is the outcome of a row of an attendee import. Field, Code and
+// Message say why a row was skipped or failed.
+type importRow struct {
+	// Row is the number of the record in the file, the header being 1.
+	Row     int    `json:"row"`
+	Email   string `json:"email"`
+	UserId  int    `json:"userId,omitempty"`
+	Status  string `json:"status" enums:"added,invited,skipped,failed"`
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// importReport sums up an attendee import. Added counts users who already
+// had an account, Invited those an account was created for.
+type importReport struct {
+	DryRun  bool        `json:"dryRun"`
+	Added   int         `json:"added"`
+	Invited int         `json:"invited"`
+	Skipped int         `json:"skipped"`
+	Failed  int         `json:"failed"`
+	Rows    []importRow `json:"rows"`
+}
+
+// importFile is a parsed attendee import: the rows below the header and
+// the columns of the email, the name (-1 without one) and the answers,
+// keyed by question.
+type importFile struct {
+	rows    [][]string
+	email   int
+	name    int
+	answers map[string]int
+	// keys are the question keys of the answer columns in file order.
+	keys []string
+}
+
+// invitationEmail is the payload of a jobSendInvitation job. The token
+// the account is claimed with is only made when the email is sent, so it's
+// never stored with the job.
+type invitationEmail struct {
+	UserId  int `json:"userId"`
+	EventId int `json:"eventId"`
+}
+
+// ImportAttendees adds attendees to an event from a CSV file
+//
+//	@Summary		Adds attendees to an event from a CSV file
+//	@Description	Organizers only. The file has a header row with an email column and optionally a name column and a column per registration question, named by its key; multiple choices are separated by semicolons and checkboxes are yes or no. Rows are matched to users by email, ignoring case. With createAccounts, an account is created for unknown emails and an invitation to set a password is mailed. All rows are checked in one transaction: if any fails, nothing is imported and the failures are returned as validation errors. Users already attending are skipped. With dryRun, the report of what would happen is returned without changing anything.
+//	@Tags			attendees
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			file			formData	file	true	"CSV file"
+//	@Param			dryRun			query		bool	false	"Only report what would be imported"
+//	@Param			createAccounts	query		bool	false	"Create accounts for unknown emails"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	importReport
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/attendees/import [post]
+//	@Security		BearerAuth
+func (app *application) importAttendees(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "dryRun must be true or false")
+		return
+	}
+	createAccounts, err := strconv.ParseBool(c.DefaultQuery("createAccounts", "false"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "createAccounts must be true or false")
+		return
+	}
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+	file := readImportOrAbort(c)
+	if file == nil {
+		return
+	}
+
+	var report importReport
+	var added []*database.Attendee
+	var invited []*database.User
+	membership := GetMembershipFromContext(c)
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		report = importReport{DryRun: dryRun, Rows: []importRow{}}
+		added, invited = nil, nil
+
+		current, err := tx.Events.Get(event.Id)
+		if err != nil {
+			return err
+		}
+		if !acceptsAttendees(current) {
+			event = current
+			return errNotAcceptingAttendees
+		}
+		form, err := currentForm(tx, event.Id)
+		if err != nil {
+			return err
+		}
+		for _, key := range file.keys {
+			if form == nil || form.Question(key) == nil {
+				return &InvalidFieldError{Field: "file", Code: "columns", Message: fmt.Sprintf("has a column %q that is neither email, name nor a question of the registration form", key)}
+			}
+		}
+
+		seen := map[string]int{}
+		for i, record := range file.rows {
+			row := importRow{Row: i + 2, Email: strings.TrimSpace(record[file.email])}
+			reject := func(status, field, code, message string) {
+				row.Status, row.Field, row.Code, row.Message = status, fmt.Sprintf("rows[%d]%s", row.Row, field), code, message
+			}
+
+			if addr, err := mail.ParseAddress(row.Email); err != nil || addr.Address != row.Email {
+				reject(importFailed, ".email", "email", "must be a valid email address")
+			} else if first, ok := seen[strings.ToLower(row.Email)]; ok {
+				reject(importSkipped, ".email", "duplicate", fmt.Sprintf("repeats row %d", first))
+			} else {
+				seen[strings.ToLower(row.Email)] = row.Row
+				user, attendee, err := app.importAttendee(c, tx, event.Id, membership, form, file, record, createAccounts, &row, reject)
+				if err != nil {
+					return err
+				}
+				if attendee != nil {
+					added = append(added, attendee)
+				}
+				if user != nil {
+					invited = append(invited, user)
+				}
+				if dryRun && row.Status == importInvited {
+					// The account is rolled back with the preview.
+					row.UserId = 0
+				}
+			}
+
+			switch row.Status {
+			case importAdded:
+				report.Added++
+			case importInvited:
+				report.Invited++
+			case importSkipped:
+				report.Skipped++
+			case importFailed:
+				report.Failed++
+			}
+			report.Rows = append(report.Rows, row)
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		if report.Failed > 0 {
+			var errs []FieldError
+			for _, row := range report.Rows {
+				if row.Status == importFailed {
+					errs = append(errs, FieldError{Field: row.Field, Code: row.Code, Message: row.Message})
+				}
+			}
+			return &InvalidFieldsError{Detail: fmt.Sprintf("%d of %d rows can't be imported; nothing was imported", report.Failed, len(report.Rows)), Errors: errs}
+		}
+		return nil
+	})
+	switch err {
+	case nil, errDryRun:
+	case errNotAcceptingAttendees:
+		ErrorResponse(c, http.StatusConflict, "Event is "+event.Status)
+		return
+	default:
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	if !dryRun {
+		for _, user := range invited {
+			app.sendInvitation(event.Id, user)
+		}
+		app.sendTickets(added)
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// importAttendee adds the user of a row of an import to an event, creating
+// an account for them if allowed, and sets the outcome of the row. The
+// account is returned if it was created. Rows
+// that can't be imported are reported with reject; the error is only set for
+// failures of the transaction.
+func (app *application) importAttendee(c *gin.Context, tx database.Models, eventId int, membership *database.Membership, form *database.RegistrationForm,
+	file *importFile, record []string, createAccounts bool, row *importRow, reject func(status, field, code, message string)) (*database.User, *database.Attendee, error) {
+	user, err := tx.Users.FindByEmail(row.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil && !createAccounts {
+		reject(importFailed, ".email", "exists", "has no account; allow creating accounts to invite them")
+		return nil, nil, nil
+	}
+	if membership != nil {
+		// Accounts created here aren't members, so unknown emails can't be
+		// imported into organization events.
+		member := false
+		if user != nil {
+			m, err := tx.Organizations.GetMembership(membership.OrganizationId, user.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			member = m != nil
+		}
+		if !member {
+			reject(importFailed, ".email", "member", "is not a member of this organization")
+			return nil, nil, nil
+		}
+	}
+	if user != nil {
+		row.UserId = user.ID
+		existing, err := tx.Attendees.GetByEventAndAttendee(eventId, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if existing != nil {
+			reject(importSkipped, ".email", "attending", "already attends the event")
+			return nil, nil, nil
+		}
+	}
+
+	answers := database.Answers{}
+	for _, key := range file.keys {
+		if v := parseAnswer(form.Question(key), record[file.answers[key]]); v != nil {
+			answers[key] = v
+		}
+	}
+	checked, err := checkAnswers(form, answers, "answers")
+	var fieldErr *InvalidFieldError
+	if errors.As(err, &fieldErr) {
+		reject(importFailed, "."+fieldErr.Field, fieldErr.Code, fieldErr.Message)
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch err := checkCapacity(tx, eventId, 1); err {
+	case nil:
+	case errEventFull:
+		reject(importFailed, "", "event_full", "exceeds the capacity of the event")
+		return nil, nil, nil
+	default:
+		return nil, nil, err
+	}
+
+	var invited *database.User
+	row.Status = importAdded
+	if user == nil {
+		name := row.Email[:strings.Index(row.Email, "@")]
+		if file.name >= 0 && strings.TrimSpace(record[file.name]) != "" {
+			name = strings.TrimSpace(record[file.name])
+		}
+		if len([]rune(name)) < 2 || len([]rune(name)) > 100 {
+			reject(importFailed, ".name", "len", "must be 2 to 100 characters long for new accounts")
+			return nil, nil, nil
+		}
+		user = &database.User{Email: row.Email, Name: name}
+		if err := tx.Users.InsertInvited(user); err != nil {
+			return nil, nil, err
+		}
+		if err := app.audit(c, tx, database.AuditCreate, database.ResourceUser, user.ID, nil, user); err != nil {
+			return nil, nil, err
+		}
+		invited = user
+		row.UserId = user.ID
+		row.Status = importInvited
+	}
+
+	attendee := &database.Attendee{EventId: eventId, UserId: user.ID}
+	if err := tx.Attendees.Insert(attendee); err != nil {
+		return nil, nil, err
+	}
+	if err := saveAnswers(tx, form, attendee, checked); err != nil {
+		return nil, nil, err
+	}
+	if err := app.audit(c, tx, database.AuditCreate, database.ResourceAttendee, attendee.ID, nil, attendee); err != nil {
+		return nil, nil, err
+	}
+	return invited, attendee, nil
+}
+
+// readImportOrAbort reads the CSV file of an attendee import from the
+// "file" field of a multipart upload and finds its columns.
+func readImportOrAbort(c *gin.Context) *importFile {
+	// Leave room for the multipart framing around the file.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize+64<<10)
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || err == nil && header.Size > maxImportSize {
+		ErrorResponse(c, http.StatusRequestEntityTooLarge, "The file must be at most "+strconv.Itoa(maxImportSize>>20)+" MB")
+		return nil
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Send the file as the multipart form field \"file\"")
+		return nil
+	}
+	f, err := header.Open()
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return nil
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		ServerErrorResponse(c, &InvalidFieldError{Field: "file", Code: "csv", Message: "is not valid CSV: " + parseErr.Error()})
+		return nil
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return nil
+	}
+	if len(records) == 0 {
+		ServerErrorResponse(c, &InvalidFieldError{Field: "file", Code: "required", Message: "must start with a header row"})
+		return nil
+	}
+	if len(records)-1 > maxImportRows {
+		ServerErrorResponse(c, &InvalidFieldError{Field: "file", Code: "max", Message: fmt.Sprintf("must have at most %d rows", maxImportRows)})
+		return nil
+	}
+
+	file := &importFile{rows: records[1:], email: -1, name: -1, answers: map[string]int{}}
+	for i, column := range records[0] {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if column == "email" && file.email < 0 {
+			file.email = i
+		} else if column == "name" && file.name < 0 {
+			file.name = i
+		} else if _, ok := file.answers[column]; ok || column == "email" || column == "name" {
+			ServerErrorResponse(c, &InvalidFieldError{Field: "file", Code: "columns", Message: fmt.Sprintf("has the column %q twice", column)})
+			return nil
+		} else {
+			file.answers[column] = i
+			file.keys = append(file.keys, column)
+		}
+	}
+	if file.email < 0 {
+		ServerErrorResponse(c, &InvalidFieldError{Field: "file", Code: "columns", Message: "must have an email column"})
+		return nil
+	}
+	return file
+}
+
+// parseAnswer turns a cell of an import into an answer to q, the way
+// formatAnswer writes it for exports: choices separated by semicolons and
+// checkboxes as yes or no. Values that don't fit are passed on as text for
+// checkAnswers to reject; empty cells are no answer.
+func parseAnswer(q *database.Question, cell string) any {
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return nil
+	}
+	switch q.Type {
+	case database.QuestionMultiChoice:
+		var choices []any
+		for _, choice := range strings.Split(cell, ";") {
+			if choice = strings.TrimSpace(choice); choice != "" {
+				choices = append(choices, choice)
+			}
+		}
+		return choices
+	case database.QuestionCheckbox:
+		switch strings.ToLower(cell) {
+		case "yes", "true", "1", "x":
+			return true
+		case "no", "false", "0":
+			return false
+		}
+	}
+	return cell
+}
+
+// sendInvitation queues the email inviting an account created by an import
+// of an event to claim it.
+func (app *application) sendInvitation(eventId int, user *database.User) {
+	_, _, err := jobs.Enqueue(&app.models.Jobs, jobSendInvitation, invitationEmail{UserId: user.ID, EventId: eventId},
+		jobs.Options{UniqueKey: fmt.Sprintf("%s:%d", jobSendInvitation, user.ID)})
+	if err != nil {
+		log.Printf("queue invitation of user %d: %v", user.ID, err)
+	}
+}
+
+// mailInvitation emails an invited account a new token to claim it with.
+// Nothing is sent once the account was claimed or deleted, or when the
+// event is gone.
+func (app *application) mailInvitation(ctx context.Context, i invitationEmail) error {
+	models := app.models.ForOrganization(database.AllOrganizations)
+	user, err := models.Users.Get(i.UserId)
+	if err != nil || user == nil || !user.Invited {
+		return err
+	}
+	event, err := models.Events.Get(i.EventId)
+	if err == database.ErrEventNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Every attempt replaces the token, so only the one last sent works.
+	token, tokenHash, err := NewToken()
+	if err != nil {
+		return err
+	}
+	err = models.Users.SetInviteToken(user.ID, tokenHash, time.Now().Add(inviteTokenTTL))
+	if err == database.ErrNoRowsAffected {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: fmt.Sprintf("You're invited to %s", event.Name),
+		Body: fmt.Sprintf("Hi %s,\n\nYou were added to %s on %s. An account was created for you; set its password with this token at %s/api/v1/auth/accept-invite:\n\n%s\n\nIt expires in %s.",
+			user.Name, event.Name, event.Date, app.baseURL, token, inviteTokenTTL),
+	})
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+const inviteLinkPurpose = "event-invite-link"
+
+type createInviteLinkRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+	MaxUses   *int       `json:"maxUses" binding:"omitempty,min=1"`
+}
+
+type inviteLinkResponse struct {
+	*database.InviteLink
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// GetEventOrganizers returns the organizers of an event
+//
+//	@Summary		Returns the organizers of an event
+//	@Description	Returns the users the owner appointed as organizers. Organizers only.
+//	@Tags			organizers
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]database.User
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/organizers [get]
+//	@Security		BearerAuth
+func (app *application) getEventOrganizers(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	organizers, err := app.modelsFor(c).Events.GetOrganizers(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, organizers)
+}
+
+// AddEventOrganizer appoints an organizer
+//
+//	@Summary		Appoints an organizer
+//	@Description	Lets a user manage attendees and invite links of the event. Event owner only.
+//	@Tags			organizers
+//	@Produce		json
+//	@Param			id				path	int		true	"Event ID"
+//	@Param			userId			path	int		true	"User ID"
+//	@Param			Idempotency-Key	header	string	false	"Unique key that makes retries safe"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/organizers/{userId} [post]
+//	@Security		BearerAuth
+func (app *application) addEventOrganizer(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	userId, err := GetIDFromParam(c, "userId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid userId")
+		return
+	}
+
+	if !app.canManageEvent(c, GetUserFromContext(c), event) {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
+		return
+	}
+
+	if app.getUserOrAbort(c, userId) == nil {
+		return
+	}
+
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Events.AddOrganizer(event.Id, userId); err != nil {
+			return err
+		}
+		// Organizers are identified by their event in the audit log.
+		return app.audit(c, tx, database.AuditCreate, database.ResourceEventOrganizer, event.Id, nil, gin.H{"userId": userId})
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveEventOrganizer removes an organizer
+//
+//	@Summary		Removes an organizer
+//	@Description	Removes an organizer from the event. Event owner only.
+//	@Tags			organizers
+//	@Produce		json
+//	@Param			id		path	int	true	"Event ID"
+//	@Param			userId	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/organizers/{userId} [delete]
+//	@Security		BearerAuth
+func (app *application) removeEventOrganizer(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	userId, err := GetIDFromParam(c, "userId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid userId")
+		return
+	}
+
+	if !app.canManageEvent(c, GetUserFromContext(c), event) {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
+		return
+	}
+
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Events.RemoveOrganizer(event.Id, userId); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceEventOrganizer, event.Id, gin.H{"userId": userId}, nil)
+	})
+	if err == database.ErrNoRowsAffected {
+		ErrorResponse(c, http.StatusNotFound, "organizer not found")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateInviteLink creates a shareable invite link
+//
+//	@Summary		Creates a shareable invite link
+//	@Description	Creates a signed link that lets logged-in users join the event, with an optional expiry and maximum number of uses. Organizers only.
+//	@Tags			invites
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path		int						true	"Event ID"
+//	@Param			link			body		createInviteLinkRequest	false	"Link options"
+//	@Param			Idempotency-Key	header		string					false	"Unique key that makes retries safe"
+//	@Success		201				{object}	inviteLinkResponse
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/invite-links [post]
+//	@Security		BearerAuth
+func (app *application) createInviteLink(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	user := GetUserFromContext(c)
+	if !app.requireOrganizer(c, user, event) {
+		return
+	}
+
+	var req createInviteLinkRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			BindErrorResponse(c, err)
+			return
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		ErrorResponse(c, http.StatusBadRequest, "expiresAt must be in the future")
+		return
+	}
+
+	link := database.InviteLink{
+		EventId:   event.Id,
+		CreatedBy: user.ID,
+		ExpiresAt: req.ExpiresAt,
+		MaxUses:   req.MaxUses,
+	}
+	if err := app.models.InviteLinks.Insert(&link); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	noStore(c)
+	c.JSON(http.StatusCreated, app.inviteLinkResponse(&link))
+}
+
+// GetInviteLinks returns the invite links of an event
+//
+//	@Summary		Returns the invite links of an event
+//	@Description	Returns every invite link of the event including revoked ones. Organizers only.
+//	@Tags			invites
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]inviteLinkResponse
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/invite-links [get]
+//	@Security		BearerAuth
+func (app *application) getInviteLinks(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	links, err := app.models.InviteLinks.GetByEvent(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	res := make([]inviteLinkResponse, 0, len(links))
+	for _, link := range links {
+		res = append(res, app.inviteLinkResponse(link))
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// RevokeInviteLink revokes an invite link
+//
+//	@Summary		Revokes an invite link
+//	@Description	Revokes an invite link so it can no longer be used. Organizers only.
+//	@Tags			invites
+//	@Produce		json
+//	@Param			id		path	int	true	"Event ID"
+//	@Param			linkId	path	int	true	"Invite link ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/invite-links/{linkId} [delete]
+//	@Security		BearerAuth
+func (app *application) revokeInviteLink(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	linkId, err := GetIDFromParam(c, "linkId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid linkId")
+		return
+	}
+
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	err = app.models.InviteLinks.Revoke(event.Id, linkId)
+	if err == database.ErrNoRowsAffected {
+		ErrorResponse(c, http.StatusNotFound, "invite link not found")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// JoinWithInviteLink joins an event through an invite link
+//
+//	@Summary		Joins an event through an invite link
+//	@Description	Adds the authenticated user as an attendee of the event the link was created for. Events with ticket types can only be joined by ordering a ticket (409 ticket_required).
+//	@Tags			invites
+//	@Produce		json
+//	@Param			token			path		string				true	"Invite link token"
+//	@Param			Idempotency-Key	header		string				false	"Unique key that makes retries safe"
+//	@Param			registration	body		registrationRequest	false	"Answers to the registration form"
+//	@Success		201				{object}	database.Attendee
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/invites/{token}/join [post]
+//	@Security		BearerAuth
+func (app *application) joinWithInviteLink(c *gin.Context) {
+	value, ok := VerifySignedValue(app.jwtSecret, inviteLinkPurpose, c.Param("token"))
+	linkId, err := strconv.Atoi(value)
+	if !ok || err != nil {
+		ErrorResponse(c, http.StatusNotFound, "invite link not found")
+		return
+	}
+
+	link, err := app.models.InviteLinks.Get(linkId)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	if link == nil {
+		ErrorResponse(c, http.StatusNotFound, "invite link not found")
+		return
+	}
+
+	allModels := app.models.ForOrganization(database.AllOrganizations)
+	event, err := allModels.Events.Get(link.EventId)
+	if err != nil {
+		ErrorResponse(c, http.StatusNotFound, "event not found")
+		return
+	}
+
+	// Links do not cross tenant boundaries: organization events can only be
+	// joined by members.
+	user := GetUserFromContext(c)
+	models := app.models
+	if event.OrganizationId != nil {
+		membership, err := app.models.Organizations.GetMembership(*event.OrganizationId, user.ID)
+		if err != nil {
+			ServerErrorResponse(c, err)
+			return
+		}
+		if membership == nil {
+			ErrorResponse(c, http.StatusForbidden, "Only members of the organization can join this event")
+			return
+		}
+		models = models.ForOrganization(*event.OrganizationId)
+	}
+
+	answers, ok := bindAnswersOrAbort(c)
+	if !ok {
+		return
+	}
+
+	attendee := database.Attendee{
+		EventId: event.Id,
+		UserId:  user.ID,
+	}
+	err = models.WithTx(func(tx database.Models) error {
+		current, err := tx.Events.Get(event.Id)
+		if err != nil {
+			return err
+		}
+		if current.Status != database.StatusPublished {
+			return errNotAcceptingAttendees
+		}
+		// Tickets of paid events are sold through orders only.
+		ticketTypes, err := tx.TicketTypes.GetForEvent(event.Id)
+		if err != nil {
+			return err
+		}
+		if len(ticketTypes) > 0 {
+			return errTicketRequired
+		}
+		form, err := currentForm(tx, event.Id)
+		if err != nil {
+			return err
+		}
+		checked, err := checkAnswers(form, answers, "answers")
+		if err != nil {
+			return err
+		}
+		if err := tx.InviteLinks.Redeem(link.ID); err != nil {
+			return err
+		}
+		if err := checkCapacity(tx, event.Id, 1); err != nil {
+			return err
+		}
+		if err := tx.Attendees.Insert(&attendee); err != nil {
+			return err
+		}
+		if err := saveAnswers(tx, form, &attendee, checked); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourceAttendee, attendee.ID, nil, attendee)
+	})
+	if err == errNotAcceptingAttendees {
+		ErrorResponse(c, http.StatusGone, "Event is not open for registration")
+		return
+	}
+	if err == errTicketRequired {
+		ProblemResponse(c, http.StatusConflict, CodeTicketRequired, "This event sells tickets; order one to attend")
+		return
+	}
+	if err == database.ErrInvalidToken {
+		ErrorResponse(c, http.StatusGone, "Invite link expired, revoked or used up")
+		return
+	}
+	if err == database.ErrAttendeeExists {
+		ProblemResponse(c, http.StatusConflict, CodeAlreadyExists, "Attendee exists")
+		return
+	}
+	if err == errEventFull {
+		ProblemResponse(c, http.StatusConflict, CodeEventFull, "Event is full")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	app.sendTicket(&attendee)
+	c.JSON(http.StatusCreated, attendee)
+}
+
+func (app *application) inviteLinkResponse(link *database.InviteLink) inviteLinkResponse {
+	token := SignValue(app.jwtSecret, inviteLinkPurpose, strconv.Itoa(link.ID))
+	return inviteLinkResponse{
+		InviteLink: link,
+		Token:      token,
+		URL:        fmt.Sprintf("%s/api/v1/invites/%s/join", app.baseURL, token),
+	}
+}
+
+func (app *application) getEventFromParamOrAbort(c *gin.Context) *database.Event {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid eventId")
+		return nil
+	}
+	return app.getEventOrAbort(c, id)
+}
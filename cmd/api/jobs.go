@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/LeeDat03/gin-event-app/internal/jobs"
+	"github.com/LeeDat03/gin-event-app/internal/mailer"
+	"github.com/gin-gonic/gin"
+)
+
+// Kinds of background jobs.
+const (
+	// jobSendEmail delivers a mailer.Message.
+	jobSendEmail = "send_email"
+	// jobEventReminder reminds an attendee of an event, see eventReminder.
+	jobEventReminder = "event_reminder"
+	// jobRefundPayment refunds the payment of an order, see refundPayment.
+	jobRefundPayment = "refund_payment"
+	// jobSendTicket emails an attendee their ticket, see mailTicket.
+	jobSendTicket = "send_ticket"
+	// jobSendInvitation emails an account created by an import the token it
+	// is claimed with, see mailInvitation.
+	jobSendInvitation = "send_invitation"
+)
+
+const (
+	// jobPollInterval is how often an idle worker looks for due jobs, and
+	// jobTimeout how long an attempt may take.
+	jobPollInterval = 2 * time.Second
+	jobTimeout      = time.Minute
+
+	defaultJobPageSize = 50
+	maxJobPageSize     = 200
+)
+
+type jobPage struct {
+	Items    []*database.Job `json:"items"`
+	Total    int             `json:"total"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"pageSize"`
+}
+
+// newWorker returns the worker running the background jobs of the app with
+// a handler for every kind.
+func (app *application) newWorker() *jobs.Worker {
+	w := &jobs.Worker{
+		Jobs:         &app.models.Jobs,
+		Concurrency:  app.jobWorkers,
+		PollInterval: jobPollInterval,
+		Timeout:      jobTimeout,
+	}
+	jobs.Register(w, jobSendEmail, func(ctx context.Context, msg mailer.Message) error {
+		return app.mailer.Send(msg)
+	})
+	jobs.Register(w, jobEventReminder, app.sendEventReminder)
+	jobs.Register(w, jobRefundPayment, app.refundPayment)
+	jobs.Register(w, jobSendTicket, app.mailTicket)
+	jobs.Register(w, jobSendInvitation, app.mailInvitation)
+	return w
+}
+
+// enqueueEmail queues msg to be sent by a worker, which retries failed
+// deliveries. uniqueKey, if not empty, makes sure the message is only sent
+// once. Messages are stored until sent, so they must not carry secrets
+// such as tokens.
+func (app *application) enqueueEmail(msg mailer.Message, uniqueKey string) error {
+	_, _, err := jobs.Enqueue(&app.models.Jobs, jobSendEmail, msg, jobs.Options{UniqueKey: uniqueKey})
+	return err
+}
+
+// AdminGetJobs lists background jobs
+//
+//	@Summary		Lists background jobs
+//	@Description	Admin only. Returns background jobs, newest first. Dead jobs ran out of attempts; their lastError says why.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			status		query		string	false	"Status"	Enums(queued, running, succeeded, dead)
+//	@Param			kind		query		string	false	"Kind of job"
+//	@Param			page		query		int		false	"Page number, starting at 1"
+//	@Param			pageSize	query		int		false	"Jobs per page (max 200)"
+//	@Success		200			{object}	jobPage
+//	@Failure		default		{object}	helpers.Problem
+//	@Router			/api/v1/admin/jobs [get]
+//	@Security		BearerAuth
+func (app *application) adminGetJobs(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", database.JobQueued, database.JobRunning, database.JobSucceeded, database.JobDead:
+	default:
+		ErrorResponse(c, http.StatusBadRequest, "status must be one of queued, running, succeeded, dead")
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		ErrorResponse(c, http.StatusBadRequest, "page must be a positive number")
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultJobPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxJobPageSize {
+		ErrorResponse(c, http.StatusBadRequest, "pageSize must be between 1 and 200")
+		return
+	}
+
+	items, total, err := app.models.Jobs.Query(status, c.Query("kind"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, jobPage{
+		Items:    items,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	})
+}
+
+// AdminRetryJob retries a dead background job
+//
+//	@Summary		Retries a dead background job
+//	@Description	Admin only. Queues a job that ran out of attempts again, with all its attempts, to run right away.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id				path		int		true	"Job ID"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Job
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/admin/jobs/{id}/retry [post]
+//	@Security		BearerAuth
+func (app *application) adminRetryJob(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var job *database.Job
+	err = app.models.WithTx(func(tx database.Models) error {
+		var err error
+		if job, err = tx.Jobs.Retry(id); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceJob, job.ID, gin.H{"status": database.JobDead}, gin.H{"status": job.Status})
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
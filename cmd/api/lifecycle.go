@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// publishInterval is how often scheduled drafts are checked for publishing.
+const publishInterval = time.Minute
+
+type publishEventRequest struct {
+	PublishAt *time.Time `json:"publishAt"`
+}
+
+// PublishEvent publishes a draft
+//
+//	@Summary		Publishes a draft
+//	@Description	Publishes a draft right away, or schedules it when publishAt is in the future. Sending a draft without publishAt again clears its schedule and publishes it. Event owner only.
+//	@Tags			lifecycle
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path		int					true	"Event ID"
+//	@Param			publish			body		publishEventRequest	false	"Scheduled publish time"
+//	@Param			Idempotency-Key	header		string				false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Event
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/publish [post]
+//	@Security		BearerAuth
+func (app *application) publishEvent(c *gin.Context) {
+	var req publishEventRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			BindErrorResponse(c, err)
+			return
+		}
+	}
+
+	if req.PublishAt == nil || !req.PublishAt.After(time.Now()) {
+		if event := app.transitionEvent(c, database.StatusPublished); event != nil {
+			c.JSON(http.StatusOK, event)
+		}
+		return
+	}
+
+	event := app.getManagedEventOrAbort(c)
+	if event == nil {
+		return
+	}
+	if event.Status != database.StatusDraft {
+		ProblemResponse(c, http.StatusConflict, CodeInvalidTransition, "Only drafts can be scheduled")
+		return
+	}
+
+	publishAt := req.PublishAt.UTC()
+	scheduled := *event
+	scheduled.PublishAt = &publishAt
+	scheduled.Version++
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Events.SchedulePublish(event.Id, &publishAt); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceEvent, event.Id, event, scheduled)
+	})
+	if err == database.ErrNoRowsAffected {
+		ProblemResponse(c, http.StatusConflict, CodeInvalidTransition, "Only drafts can be scheduled")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+// CancelEvent cancels a published event
+//
+//	@Summary		Cancels a published event
+//	@Description	Cancels a published event. RSVPs are kept and every attendee is notified by email. Pending orders expire and paid orders are refunded. Event owner only.
+//	@Tags			lifecycle
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Event
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/cancel [post]
+//	@Security		BearerAuth
+func (app *application) cancelEvent(c *gin.Context) {
+	event := app.transitionEvent(c, database.StatusCancelled)
+	if event == nil {
+		return
+	}
+
+	attendees, err := app.modelsFor(c).Attendees.GetAttendeesByEvent(event.Id)
+	if err != nil {
+		log.Printf("get attendees of cancelled event %d: %v", event.Id, err)
+	} else {
+		app.notifyEventCancelled(event, attendees)
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// CompleteEvent marks a published event as completed
+//
+//	@Summary		Marks a published event as completed
+//	@Description	Marks a published event as having taken place. Event owner only.
+//	@Tags			lifecycle
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Event
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/complete [post]
+//	@Security		BearerAuth
+func (app *application) completeEvent(c *gin.Context) {
+	if event := app.transitionEvent(c, database.StatusCompleted); event != nil {
+		c.JSON(http.StatusOK, event)
+	}
+}
+
+// ArchiveEvent archives a cancelled or completed event
+//
+//	@Summary		Archives a cancelled or completed event
+//	@Description	Archives a cancelled or completed event. Archived events are read-only. Event owner only.
+//	@Tags			lifecycle
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Event
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/archive [post]
+//	@Security		BearerAuth
+func (app *application) archiveEvent(c *gin.Context) {
+	if event := app.transitionEvent(c, database.StatusArchived); event != nil {
+		c.JSON(http.StatusOK, event)
+	}
+}
+
+// transitionEvent moves the event in the route to status to, or writes an
+// error response and returns nil.
+func (app *application) transitionEvent(c *gin.Context, to string) *database.Event {
+	event := app.getManagedEventOrAbort(c)
+	if event == nil {
+		return nil
+	}
+
+	updated := *event
+	updated.Status = to
+	updated.Version++
+	if to == database.StatusPublished {
+		updated.PublishAt = nil
+	}
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Events.SetStatus(event.Id, event.Status, to); err != nil {
+			return err
+		}
+		if to == database.StatusCancelled {
+			if err := app.settleCancelledOrders(c, tx, event.Id); err != nil {
+				return err
+			}
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceEvent, event.Id, event, updated)
+	})
+	if err == database.ErrInvalidTransition || err == database.ErrNoRowsAffected {
+		ProblemResponse(c, http.StatusConflict, CodeInvalidTransition, fmt.Sprintf("Cannot move a %s event to %s", event.Status, to))
+		return nil
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return nil
+	}
+
+	return &updated
+}
+
+// getManagedEventOrAbort returns the event in the route if the current user
+// may manage it.
+func (app *application) getManagedEventOrAbort(c *gin.Context) *database.Event {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return nil
+	}
+
+	if !app.canManageEvent(c, GetUserFromContext(c), event) {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
+		return nil
+	}
+	return event
+}
+
+// publishScheduledEvents publishes due drafts every publishInterval until ctx
+// is done.
+func (app *application) publishScheduledEvents(ctx context.Context) {
+	models := app.models.ForOrganization(database.AllOrganizations)
+
+	ticker := time.NewTicker(publishInterval)
+	defer ticker.Stop()
+
+	for {
+		var ids []int
+		err := models.WithTx(func(tx database.Models) error {
+			var err error
+			if ids, err = tx.Events.PublishDue(time.Now()); err != nil {
+				return err
+			}
+			for _, id := range ids {
+				entry := database.AuditEntry{Action: database.AuditUpdate, ResourceType: database.ResourceEvent, ResourceId: id}
+				entry.SetChanges(map[string]string{"status": database.StatusDraft}, map[string]string{"status": database.StatusPublished})
+				if err := tx.AuditLog.Insert(&entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("publish scheduled events: %v", err)
+		} else if len(ids) > 0 {
+			log.Printf("published %d scheduled events", len(ids))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	_ "github.com/LeeDat03/gin-event-app/docs"
 	"github.com/LeeDat03/gin-event-app/internal/database"
 	"github.com/LeeDat03/gin-event-app/internal/env"
+	"github.com/LeeDat03/gin-event-app/internal/geo"
+	"github.com/LeeDat03/gin-event-app/internal/mailer"
+	"github.com/LeeDat03/gin-event-app/internal/payment"
+	"github.com/LeeDat03/gin-event-app/internal/storage"
 	_ "github.com/joho/godotenv/autoload"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -28,8 +38,25 @@ import (
 
 type application struct {
 	port      int
+	baseURL   string
 	jwtSecret string
 	models    database.Models
+	mailer    mailer.Mailer
+	geocoder  geo.Geocoder
+	blobs     storage.BlobStore
+	payments  payment.Provider
+	// retention is how long deleted events and users can be restored
+	// before they are purged.
+	retention time.Duration
+	// idempotencyTTL is how long responses to requests sent with an
+	// Idempotency-Key are kept for replay.
+	idempotencyTTL time.Duration
+	// orderHold is how long a pending order reserves its tickets for the
+	// buyer to pay.
+	orderHold time.Duration
+	// jobWorkers is how many background jobs this process runs at once; 0
+	// leaves them to other instances.
+	jobWorkers int
 }
 
 func main() {
@@ -41,14 +68,59 @@ func main() {
 
 	models := database.NewModels(db)
 
+	baseURL := env.GetEnvString("APP_URL", "http://localhost:8000")
 	app := &application{
-		port:      env.GetEnvInt("PORT", 8000),
-		jwtSecret: env.GetEnvString("JWT_SECRET", "secret-123123"),
-		models:    models,
+		port:           env.GetEnvInt("PORT", 8000),
+		baseURL:        baseURL,
+		jwtSecret:      env.GetEnvString("JWT_SECRET", "secret-123123"),
+		models:         models,
+		mailer:         mailer.LogMailer{},
+		geocoder:       geo.StubGeocoder{},
+		blobs:          newBlobStore(),
+		payments:       newPaymentProvider(baseURL),
+		retention:      time.Duration(env.GetEnvInt("RETENTION_DAYS", 30)) * 24 * time.Hour,
+		idempotencyTTL: time.Duration(env.GetEnvInt("IDEMPOTENCY_TTL_HOURS", 24)) * time.Hour,
+		orderHold:      time.Duration(env.GetEnvInt("ORDER_HOLD_MINUTES", 15)) * time.Minute,
+		jobWorkers:     env.GetEnvInt("JOB_WORKERS", 4),
 	}
 
-	if err := serve(app); err != nil {
+	// Stop on SIGINT or SIGTERM: the server finishes the requests in flight
+	// and the worker the jobs it is running.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go app.publishScheduledEvents(ctx)
+	go app.purgeDeleted(ctx)
+	go app.expireOrders(ctx)
+	go app.queueReminders(ctx)
+
+	var worker sync.WaitGroup
+	if app.jobWorkers > 0 {
+		worker.Add(1)
+		go func() {
+			defer worker.Done()
+			app.newWorker().Run(ctx)
+		}()
+	}
+
+	if err := serve(ctx, app); err != nil {
 		log.Fatal(err)
 	}
+	worker.Wait()
+	log.Printf("Stopped")
+}
 
+// newBlobStore returns the store for uploaded files: an S3-compatible bucket
+// when BLOB_STORE is "s3", files under BLOB_DIR otherwise.
+func newBlobStore() storage.BlobStore {
+	if env.GetEnvString("BLOB_STORE", "local") == "s3" {
+		return storage.S3Store{
+			Endpoint:  env.GetEnvString("S3_ENDPOINT", "http://localhost:9000"),
+			Region:    env.GetEnvString("S3_REGION", "us-east-1"),
+			Bucket:    env.GetEnvString("S3_BUCKET", "gin-event-app"),
+			AccessKey: env.GetEnvString("S3_ACCESS_KEY", ""),
+			SecretKey: env.GetEnvString("S3_SECRET_KEY", ""),
+		}
+	}
+	return storage.LocalStore{Dir: env.GetEnvString("BLOB_DIR", "./uploads")}
 }
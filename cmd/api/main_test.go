@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/file"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestApp returns an app on a database in a temporary directory with
+// every migration applied. Binaries built without the FTS5 module can't run
+// the migrations, so the test is skipped for them.
+func newTestApp(t *testing.T) *application {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	instance, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := (&file.File{}).Open("../migrate/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithInstance("file", src, "sqlite3", instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			t.Skip("migrations need the FTS5 module: go test -tags sqlite_fts5")
+		}
+		t.Fatal(err)
+	}
+
+	return &application{
+		baseURL:        "http://localhost:8000",
+		jwtSecret:      "test-secret",
+		models:         database.NewModels(db),
+		idempotencyTTL: time.Hour,
+		orderHold:      15 * time.Minute,
+	}
+}
+
+// newTestUser adds an account with the given email.
+func newTestUser(t *testing.T, app *application, email string) *database.User {
+	t.Helper()
+	user := &database.User{Name: email[:strings.Index(email, "@")], Email: email, Password: "hash"}
+	if err := app.models.Users.Insert(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
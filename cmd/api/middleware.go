@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"strings"
 
+	"github.com/LeeDat03/gin-event-app/internal/database"
 	. "github.com/LeeDat03/gin-event-app/internal/helpers"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
@@ -18,43 +21,112 @@ func (app *application) AuthMiddleWare() gin.HandlerFunc {
 			return
 		}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenStr == authHeader {
-			ErrorResponse(ctx, http.StatusUnauthorized, "Bearer token not set")
+		user := app.authenticate(ctx, authHeader)
+		if user == nil {
 			ctx.Abort()
 			return
 		}
 
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(app.jwtSecret), nil
-		})
+		// set user
+		ctx.Set("user", user)
+		ctx.Next()
+	}
+}
 
-		if err != nil || !token.Valid {
-			ErrorResponse(ctx, http.StatusUnauthorized, "Invalid token")
-			ctx.Abort()
+// OptionalAuthMiddleware sets the user when a bearer token is sent, so public
+// routes can show more to logged-in users. An invalid token is still rejected.
+func (app *application) OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authHeader := ctx.GetHeader("Authorization")
+		if authHeader == "" {
+			ctx.Next()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			ErrorResponse(ctx, http.StatusUnauthorized, "Invalid token")
+		user := app.authenticate(ctx, authHeader)
+		if user == nil {
 			ctx.Abort()
 			return
 		}
 
-		userId := claims["userId"].(float64)
+		ctx.Set("user", user)
+		ctx.Next()
+	}
+}
 
-		user := app.getUserOrAbort(ctx, int(userId))
-		if user == nil {
+// authenticate returns the user of the bearer token, or writes an error
+// response and returns nil.
+func (app *application) authenticate(ctx *gin.Context, authHeader string) *database.User {
+	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenStr == authHeader {
+		ErrorResponse(ctx, http.StatusUnauthorized, "Bearer token not set")
+		return nil
+	}
+
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(app.jwtSecret), nil
+	})
+
+	if err != nil || !token.Valid {
+		ErrorResponse(ctx, http.StatusUnauthorized, "Invalid token")
+		return nil
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		ErrorResponse(ctx, http.StatusUnauthorized, "Invalid token")
+		return nil
+	}
+
+	userId, ok := claims["userId"].(float64)
+	if !ok {
+		ErrorResponse(ctx, http.StatusUnauthorized, "Invalid token")
+		return nil
+	}
+
+	user := app.getUserOrAbort(ctx, int(userId))
+	if user == nil {
+		return nil
+	}
+	if user.AnonymizedAt != nil {
+		ErrorResponse(ctx, http.StatusUnauthorized, "Invalid token")
+		return nil
+	}
+
+	return user
+}
+
+// AdminMiddleware must run after AuthMiddleWare.
+func (app *application) AdminMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user := GetUserFromContext(ctx)
+		if !user.IsAdmin() {
+			ErrorResponse(ctx, http.StatusForbidden, "Admin only")
 			ctx.Abort()
 			return
 		}
+		ctx.Next()
+	}
+}
 
-		// set user
-		ctx.Set("user", user)
+const requestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware tags every request with an ID, taken from the
+// X-Request-ID header when the client sends one, and echoes it back.
+func (app *application) RequestIDMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		ctx.Set("requestId", id)
+		ctx.Header(requestIDHeader, id)
 		ctx.Next()
 	}
 }
@@ -0,0 +1,655 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/LeeDat03/gin-event-app/internal/jobs"
+	"github.com/LeeDat03/gin-event-app/internal/payment"
+	"github.com/gin-gonic/gin"
+)
+
+// orderExpiryInterval is how often pending orders are checked for
+// reservations that ran out.
+const orderExpiryInterval = time.Minute
+
+var (
+	errNotOnSale = errors.New("ticket type is not on sale")
+	errSoldOut   = errors.New("ticket type is sold out")
+)
+
+type orderItemRequest struct {
+	TicketTypeId int `json:"ticketTypeId" binding:"required"`
+	// UserId is who the ticket is for; the buyer when omitted. Only those
+	// who manage the event may buy tickets for other users.
+	UserId int `json:"userId"`
+	// Answers are the ticket holder's answers to the registration form.
+	Answers database.Answers `json:"answers,omitempty"`
+}
+
+type createOrderRequest struct {
+	// Items are the tickets to buy, at most 10 per order.
+	Items []orderItemRequest `json:"items" binding:"required,min=1,max=10,dive"`
+	// PromoCode is a promo code of the event to redeem, in any case.
+	PromoCode string `json:"promoCode,omitempty" binding:"max=32"`
+}
+
+// CreateOrder orders tickets for an event
+//
+//	@Summary		Orders tickets for an event
+//	@Description	Reserves one ticket per item for the given users, the buyer by default, and starts a payment. Only the owner of the event and admins of its organization may buy tickets for other users. The buyer pays at checkoutUrl; once the payment provider confirms the payment the order is paid and every ticket holder becomes an attendee. Unpaid orders expire after a while and release their tickets. A promo code discounts the tickets it applies to and counts as redeemed while the order holds its tickets. Free orders are paid right away.
+//	@Tags			orders
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path		int					true	"Event ID"
+//	@Param			Idempotency-Key	header		string				false	"Unique key that makes retries safe"
+//	@Param			order			body		createOrderRequest	true	"Tickets to buy"
+//	@Success		201				{object}	database.Order
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/orders [post]
+//	@Security		BearerAuth
+func (app *application) createOrder(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid eventId")
+		return
+	}
+	event := app.getVisibleEventOrAbort(c, id)
+	if event == nil {
+		return
+	}
+
+	var req createOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	user := GetUserFromContext(c)
+	membership := GetMembershipFromContext(c)
+	// Tickets for others make them attendees, which they don't get a say
+	// in, so only those who could add them as attendees may buy them.
+	canManage := app.canManageEvent(c, user, event)
+	now := time.Now().UTC()
+	order := database.Order{EventId: event.Id, UserId: &user.ID, ExpiresAt: now.Add(app.orderHold)}
+	var failed *database.TicketType
+	var attendees []*database.Attendee
+
+	// Availability is checked in the transaction, so concurrent orders can't
+	// reserve the same tickets.
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		current, err := tx.Events.Get(event.Id)
+		if err != nil {
+			return err
+		}
+		if current.Status != database.StatusPublished {
+			event = current
+			return errNotAcceptingAttendees
+		}
+
+		order.Status = database.OrderPending
+		order.Total = 0
+		order.Discount = 0
+		order.Currency = ""
+		order.PromoCodeId = nil
+		order.Items = nil
+
+		form, err := currentForm(tx, event.Id)
+		if err != nil {
+			return err
+		}
+
+		var promo *database.PromoCode
+		if req.PromoCode != "" {
+			if promo, err = checkPromoCodeRedemption(tx, event.Id, req.PromoCode, user.ID, now); err != nil {
+				return err
+			}
+			order.PromoCodeId = &promo.ID
+		}
+
+		requested := map[int]int{}
+		holders := map[int]bool{}
+		for i, item := range req.Items {
+			field := fmt.Sprintf("items[%d]", i)
+			userId := item.UserId
+			if userId == 0 {
+				userId = user.ID
+			}
+			if userId != user.ID && !canManage {
+				return &InvalidFieldError{Field: field + ".userId", Code: "forbidden", Message: "must be yourself unless you manage the event"}
+			}
+			if err := checkTicketHolder(tx, membership, event.Id, userId, holders, field+".userId"); err != nil {
+				return err
+			}
+			holders[userId] = true
+			answers, err := checkAnswers(form, item.Answers, field+".answers")
+			if err != nil {
+				return err
+			}
+
+			ticketType, err := tx.TicketTypes.Get(event.Id, item.TicketTypeId)
+			if err == database.ErrTicketTypeNotFound {
+				return &InvalidFieldError{Field: field + ".ticketTypeId", Code: "exists", Message: "is not a ticket type of this event"}
+			}
+			if err != nil {
+				return err
+			}
+			if !ticketType.OnSale(now) {
+				failed = ticketType
+				return errNotOnSale
+			}
+			requested[ticketType.ID]++
+			if requested[ticketType.ID] > ticketType.Available {
+				failed = ticketType
+				return errSoldOut
+			}
+			if order.Currency == "" {
+				order.Currency = ticketType.Currency
+			} else if ticketType.Currency != order.Currency {
+				return &InvalidFieldError{Field: field + ".ticketTypeId", Code: "currency", Message: "must be priced in " + order.Currency + " like the other items"}
+			}
+
+			var discount int64
+			if promo != nil {
+				discount = promo.Discount(ticketType)
+			}
+			order.Total += ticketType.Price - discount
+			order.Discount += discount
+			orderItem := &database.OrderItem{TicketTypeId: ticketType.ID, UserId: &userId, UnitPrice: ticketType.Price, Discount: discount, Answers: answers}
+			if answers != nil {
+				orderItem.FormVersion = &form.Version
+			}
+			order.Items = append(order.Items, orderItem)
+		}
+		if promo != nil && order.Discount == 0 {
+			return &InvalidFieldError{Field: "promoCode", Code: "applies", Message: "does not apply to the tickets of this order"}
+		}
+		if err := checkCapacity(tx, event.Id, len(order.Items)); err != nil {
+			return err
+		}
+
+		if err := tx.Orders.Insert(&order); err != nil {
+			return err
+		}
+		if err := app.audit(c, tx, database.AuditCreate, database.ResourceOrder, order.ID, nil, order); err != nil {
+			return err
+		}
+		if order.Total > 0 {
+			return nil
+		}
+		attendees, err = app.fulfilOrder(c, tx, &order, now)
+		return err
+	})
+	switch err {
+	case nil:
+	case errNotAcceptingAttendees:
+		ErrorResponse(c, http.StatusConflict, "Event is "+event.Status)
+		return
+	case errNotOnSale:
+		ErrorResponse(c, http.StatusConflict, failed.Name+" tickets are not on sale")
+		return
+	case errSoldOut:
+		detail := failed.Name + " tickets are sold out"
+		if failed.Available > 0 {
+			detail = fmt.Sprintf("Only %d %s tickets are left", failed.Available, failed.Name)
+		}
+		ProblemResponse(c, http.StatusConflict, CodeSoldOut, detail)
+		return
+	case errEventFull:
+		ProblemResponse(c, http.StatusConflict, CodeEventFull, "Event is full")
+		return
+	default:
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	if order.Status == database.OrderPaid {
+		app.sendTickets(attendees)
+		c.JSON(http.StatusCreated, order)
+		return
+	}
+
+	// The payment is started once the order is saved, as the transaction may
+	// run more than once. If that fails the order is expired right away, so
+	// its tickets are not held for nothing.
+	p, err := app.payments.CreatePayment(c.Request.Context(), payment.Request{
+		OrderId:     order.ID,
+		Amount:      order.Total,
+		Currency:    order.Currency,
+		Description: "Tickets for " + event.Name,
+	})
+	if err != nil {
+		app.expireOrder(c, &order)
+		ServerErrorResponse(c, fmt.Errorf("create payment for order %d: %w", order.ID, err))
+		return
+	}
+	if err := app.modelsFor(c).Orders.SetPayment(order.ID, p.ID, p.CheckoutURL); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	order.PaymentId = &p.ID
+	order.CheckoutURL = p.CheckoutURL
+	c.JSON(http.StatusCreated, order)
+}
+
+// checkTicketHolder returns an InvalidFieldError for field unless the user
+// may get a ticket for the event: an existing user, a member for events of an
+// organization, who is not in the order yet and has no ticket already.
+func checkTicketHolder(tx database.Models, membership *database.Membership, eventId, userId int, holders map[int]bool, field string) error {
+	if holders[userId] {
+		return &InvalidFieldError{Field: field, Code: "unique", Message: "already has a ticket in this order"}
+	}
+
+	holder, err := tx.Users.Get(userId)
+	if err != nil {
+		return err
+	}
+	if holder == nil {
+		return &InvalidFieldError{Field: field, Code: "exists", Message: "is not a user"}
+	}
+	if membership != nil {
+		member, err := tx.Organizations.GetMembership(membership.OrganizationId, userId)
+		if err != nil {
+			return err
+		}
+		if member == nil {
+			return &InvalidFieldError{Field: field, Code: "member", Message: "is not a member of this organization"}
+		}
+	}
+
+	attendee, err := tx.Attendees.GetByEventAndAttendee(eventId, userId)
+	if err != nil {
+		return err
+	}
+	if attendee != nil {
+		return &InvalidFieldError{Field: field, Code: "unique", Message: "already attends this event"}
+	}
+	reserved, err := tx.Orders.HasReservation(eventId, userId)
+	if err != nil {
+		return err
+	}
+	if reserved {
+		return &InvalidFieldError{Field: field, Code: "unique", Message: "already has a ticket in a pending order"}
+	}
+	return nil
+}
+
+// checkPromoCodeRedemption returns the promo code of the event the buyer typed,
+// or an InvalidFieldError unless it can be redeemed now. Redemptions are
+// counted in the order's transaction, so concurrent orders can't exceed the
+// limits of the code.
+func checkPromoCodeRedemption(tx database.Models, eventId int, code string, userId int, now time.Time) (*database.PromoCode, error) {
+	promo, err := tx.PromoCodes.GetByCode(eventId, code)
+	if err == database.ErrPromoCodeNotFound {
+		return nil, &InvalidFieldError{Field: "promoCode", Code: "exists", Message: "is not a promo code of this event"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !promo.ValidAt(now) {
+		if promo.StartsAt != nil && now.Before(*promo.StartsAt) {
+			return nil, &InvalidFieldError{Field: "promoCode", Code: "valid", Message: "is not valid yet"}
+		}
+		return nil, &InvalidFieldError{Field: "promoCode", Code: "valid", Message: "has expired"}
+	}
+
+	total, byUser, err := tx.PromoCodes.CountUses(promo.ID, userId)
+	if err != nil {
+		return nil, err
+	}
+	if promo.MaxUses != nil && total >= *promo.MaxUses {
+		return nil, &InvalidFieldError{Field: "promoCode", Code: "max_uses", Message: "has been used up"}
+	}
+	if promo.MaxUsesPerUser != nil && byUser >= *promo.MaxUsesPerUser {
+		return nil, &InvalidFieldError{Field: "promoCode", Code: "max_uses_per_user", Message: "was already used by this buyer as often as allowed"}
+	}
+	return promo, nil
+}
+
+// fulfilOrder marks a pending order paid and makes every ticket holder an
+// attendee with the answers given with the order, returning the new
+// attendees. Holders who attend already, e.g.
+// because an organizer added them meanwhile, keep their RSVP.
+func (app *application) fulfilOrder(c *gin.Context, tx database.Models, order *database.Order, at time.Time) ([]*database.Attendee, error) {
+	if err := tx.Orders.SetStatus(order.ID, database.OrderPending, database.OrderPaid, at); err != nil {
+		return nil, err
+	}
+	before := map[string]string{"status": order.Status}
+	order.Status = database.OrderPaid
+	order.PaidAt = &at
+	if err := app.audit(c, tx, database.AuditUpdate, database.ResourceOrder, order.ID, before, map[string]string{"status": order.Status}); err != nil {
+		return nil, err
+	}
+
+	var attendees []*database.Attendee
+	for _, item := range order.Items {
+		if item.UserId == nil {
+			continue
+		}
+		attendee := database.Attendee{EventId: order.EventId, UserId: *item.UserId}
+		err := tx.Attendees.Insert(&attendee)
+		if err == database.ErrAttendeeExists {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Orders.SetItemAttendee(item.ID, attendee.ID); err != nil {
+			return nil, err
+		}
+		item.AttendeeId = &attendee.ID
+		if item.Answers != nil && item.FormVersion != nil {
+			err := tx.RegistrationForms.SaveAnswers(&database.RegistrationAnswers{
+				EventId:     attendee.EventId,
+				UserId:      attendee.UserId,
+				FormVersion: *item.FormVersion,
+				Answers:     item.Answers,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := app.audit(c, tx, database.AuditCreate, database.ResourceAttendee, attendee.ID, nil, attendee); err != nil {
+			return nil, err
+		}
+		attendees = append(attendees, &attendee)
+	}
+	return attendees, nil
+}
+
+// expireOrder releases the tickets of a pending order whose payment could
+// not be started. Failures are logged: the order expires on its own anyway.
+func (app *application) expireOrder(c *gin.Context, order *database.Order) {
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Orders.SetStatus(order.ID, database.OrderPending, database.OrderExpired, time.Now()); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceOrder, order.ID,
+			map[string]string{"status": database.OrderPending}, map[string]string{"status": database.OrderExpired})
+	})
+	if err != nil {
+		log.Printf("expire order %d: %v", order.ID, err)
+	}
+}
+
+// refundPayment is the payload of a jobRefundPayment job.
+type refundPayment struct {
+	OrderId   int    `json:"orderId"`
+	PaymentId string `json:"paymentId"`
+	Amount    int64  `json:"amount"`
+}
+
+// settleCancelledOrders expires the pending orders of a cancelled event and
+// refunds its paid ones. Their RSVPs are kept, like those of everyone else.
+// The money is sent back by a job, as tx may be retried.
+func (app *application) settleCancelledOrders(c *gin.Context, tx database.Models, eventId int) error {
+	orders, err := tx.Orders.GetForEvent(eventId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, order := range orders {
+		to := database.OrderExpired
+		switch order.Status {
+		case database.OrderPending:
+		case database.OrderPaid:
+			to = database.OrderRefunded
+		default:
+			continue
+		}
+		if err := tx.Orders.SetStatus(order.ID, order.Status, to, now); err != nil {
+			return err
+		}
+		if err := app.audit(c, tx, database.AuditUpdate, database.ResourceOrder, order.ID,
+			map[string]string{"status": order.Status}, map[string]string{"status": to}); err != nil {
+			return err
+		}
+		if to != database.OrderRefunded || order.PaymentId == nil || order.Total == 0 {
+			continue
+		}
+		_, _, err := jobs.Enqueue(&tx.Jobs, jobRefundPayment,
+			refundPayment{OrderId: order.ID, PaymentId: *order.PaymentId, Amount: order.Total},
+			jobs.Options{UniqueKey: fmt.Sprintf("%s:%d", jobRefundPayment, order.ID)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundPayment sends back the money of an order refunded without the
+// organizer asking for it. Payments the provider can no longer refund are
+// not retried.
+func (app *application) refundPayment(ctx context.Context, r refundPayment) error {
+	err := app.payments.Refund(ctx, r.PaymentId, r.Amount)
+	if err == payment.ErrInvalidState {
+		return jobs.Permanent(fmt.Errorf("refund payment %s of order %d: %w", r.PaymentId, r.OrderId, err))
+	}
+	return err
+}
+
+// GetOrders returns the orders of an event
+//
+//	@Summary		Returns the orders of an event
+//	@Description	Organizers only. Returns every order placed for the event, newest first.
+//	@Tags			orders
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]database.Order
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/orders [get]
+//	@Security		BearerAuth
+func (app *application) getOrders(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	orders, err := app.modelsFor(c).Orders.GetForEvent(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+// GetOrder returns an order
+//
+//	@Summary		Returns an order
+//	@Description	Returns an order to its buyer or to the organizers of the event
+//	@Tags			orders
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Param			orderId	path		int	true	"Order ID"
+//	@Success		200		{object}	database.Order
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/orders/{orderId} [get]
+//	@Security		BearerAuth
+func (app *application) getOrder(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	order := app.getOrderOrAbort(c, event)
+	if order == nil {
+		return
+	}
+
+	user := GetUserFromContext(c)
+	if order.UserId == nil || *order.UserId != user.ID {
+		ok, err := app.isOrganizer(c, user, event)
+		if err != nil {
+			ServerErrorResponse(c, err)
+			return
+		}
+		if !ok {
+			ErrorResponse(c, http.StatusNotFound, "order not found")
+			return
+		}
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// RefundOrder refunds a paid order
+//
+//	@Summary		Refunds a paid order
+//	@Description	Only the owner of the event or an admin of its organization may refund orders. The payment is refunded in full and the attendees the order created are removed.
+//	@Tags			orders
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			orderId			path		int		true	"Order ID"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Order
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/orders/{orderId}/refund [post]
+//	@Security		BearerAuth
+func (app *application) refundOrder(c *gin.Context) {
+	event := app.getManagedEventOrAbort(c)
+	if event == nil {
+		return
+	}
+	order := app.getOrderOrAbort(c, event)
+	if order == nil {
+		return
+	}
+	if order.Status != database.OrderPaid {
+		ProblemResponse(c, http.StatusConflict, CodeInvalidTransition, "Order is "+order.Status)
+		return
+	}
+
+	// The money is sent back first: refunding is what can fail, and an order
+	// marked refunded whose payment was kept would be worse than the reverse.
+	if order.PaymentId != nil {
+		err := app.payments.Refund(c.Request.Context(), *order.PaymentId, order.Total)
+		if err == payment.ErrInvalidState {
+			ErrorResponse(c, http.StatusConflict, "The payment can no longer be refunded")
+			return
+		}
+		if err != nil {
+			ServerErrorResponse(c, fmt.Errorf("refund order %d: %w", order.ID, err))
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Orders.SetStatus(order.ID, database.OrderPaid, database.OrderRefunded, now); err != nil {
+			return err
+		}
+		for _, item := range order.Items {
+			if item.AttendeeId == nil {
+				continue
+			}
+			attendee, err := tx.Attendees.Get(*item.AttendeeId)
+			if err != nil {
+				return err
+			}
+			if attendee == nil {
+				continue
+			}
+			if err := tx.Attendees.Delete(attendee.EventId, attendee.UserId); err != nil {
+				return err
+			}
+			if err := app.audit(c, tx, database.AuditDelete, database.ResourceAttendee, attendee.ID, attendee, nil); err != nil {
+				return err
+			}
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceOrder, order.ID,
+			map[string]string{"status": database.OrderPaid}, map[string]string{"status": database.OrderRefunded})
+	})
+	if err != nil {
+		log.Printf("order %d was refunded by the payment provider but not in the database: %v", order.ID, err)
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	order.Status = database.OrderRefunded
+	order.RefundedAt = &now
+	c.JSON(http.StatusOK, order)
+}
+
+// GetMyOrders returns the orders of the current user
+//
+//	@Summary		Returns your orders
+//	@Description	Returns the orders the current user placed, across all organizations, newest first
+//	@Tags			orders
+//	@Produce		json
+//	@Success		200		{object}	[]database.Order
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/users/me/orders [get]
+//	@Security		BearerAuth
+func (app *application) getMyOrders(c *gin.Context) {
+	models := app.models.ForOrganization(database.AllOrganizations)
+	orders, err := models.Orders.GetByUser(GetUserFromContext(c).ID)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+// getOrderOrAbort returns the order in the route if it belongs to the event.
+func (app *application) getOrderOrAbort(c *gin.Context, event *database.Event) *database.Order {
+	orderId, err := GetIDFromParam(c, "orderId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid orderId")
+		return nil
+	}
+	order, err := app.modelsFor(c).Orders.Get(orderId)
+	if err == nil && order.EventId != event.Id {
+		err = database.ErrOrderNotFound
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return nil
+	}
+	return order
+}
+
+// expireOrders expires pending orders whose reservation ran out every
+// orderExpiryInterval until ctx is done.
+func (app *application) expireOrders(ctx context.Context) {
+	models := app.models.ForOrganization(database.AllOrganizations)
+
+	ticker := time.NewTicker(orderExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		var ids []int
+		err := models.WithTx(func(tx database.Models) error {
+			var err error
+			if ids, err = tx.Orders.ExpireDue(time.Now()); err != nil {
+				return err
+			}
+			for _, id := range ids {
+				entry := database.AuditEntry{Action: database.AuditUpdate, ResourceType: database.ResourceOrder, ResourceId: id}
+				entry.SetChanges(map[string]string{"status": database.OrderPending}, map[string]string{"status": database.OrderExpired})
+				if err := tx.AuditLog.Insert(&entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("expire orders: %v", err)
+		} else if len(ids) > 0 {
+			log.Printf("expired %d unpaid orders", len(ids))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
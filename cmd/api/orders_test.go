@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+)
+
+// TestPromoCodeLimitsUnderConcurrency redeems a promo code from many
+// transactions at once, the way createOrder does, and checks that no more
+// orders than its limits allow hold it.
+func TestPromoCodeLimitsUnderConcurrency(t *testing.T) {
+	limit := 3
+	tests := []struct {
+		name      string
+		promo     database.PromoCode
+		sameBuyer bool
+		wantCode  string
+	}{
+		{"total", database.PromoCode{MaxUses: &limit}, false, "max_uses"},
+		{"per user", database.PromoCode{MaxUsesPerUser: &limit}, true, "max_uses_per_user"},
+	}
+	const buyers = 10
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			owner := newTestUser(t, app, "owner@example.com")
+			event := &database.Event{OwnerId: owner.ID, Name: "Party", Description: "A party", Date: "2030-01-01", Location: "Hall"}
+			if err := app.models.Events.Insert(event); err != nil {
+				t.Fatal(err)
+			}
+			promo := tt.promo
+			promo.EventId, promo.Code, promo.DiscountType, promo.Amount = event.Id, "SAVE", "percent", 10
+			if err := app.models.PromoCodes.Insert(&promo); err != nil {
+				t.Fatal(err)
+			}
+			users := make([]*database.User, buyers)
+			for i := range users {
+				users[i] = owner
+				if !tt.sameBuyer {
+					users[i] = newTestUser(t, app, fmt.Sprintf("buyer%d@example.com", i))
+				}
+			}
+
+			start := make(chan struct{})
+			errs := make([]error, buyers)
+			var wg sync.WaitGroup
+			for i, user := range users {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					errs[i] = app.models.WithTx(func(tx database.Models) error {
+						promo, err := checkPromoCodeRedemption(tx, event.Id, "save", user.ID, time.Now())
+						if err != nil {
+							return err
+						}
+						return tx.Orders.Insert(&database.Order{EventId: event.Id, UserId: &user.ID, Status: database.OrderPending,
+							Currency: "USD", PromoCodeId: &promo.ID, ExpiresAt: time.Now().Add(app.orderHold)})
+					})
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			redeemed := 0
+			for _, err := range errs {
+				var fieldErr *InvalidFieldError
+				switch {
+				case err == nil:
+					redeemed++
+				case errors.As(err, &fieldErr) && fieldErr.Code == tt.wantCode:
+				default:
+					t.Errorf("redeem = %v, want nil or %s", err, tt.wantCode)
+				}
+			}
+			if redeemed != limit {
+				t.Errorf("%d orders redeemed the code, want %d", redeemed, limit)
+			}
+			total, _, err := app.models.PromoCodes.CountUses(promo.ID, owner.ID)
+			if err != nil || total != limit {
+				t.Errorf("CountUses() = %d, %v, want %d", total, err, limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/LeeDat03/gin-event-app/internal/mailer"
+	"github.com/gin-gonic/gin"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+type createInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=admin member"`
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type updateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+// CreateOrganization creates a new organization
+//
+//	@Summary		Creates a new organization
+//	@Description	Creates a new organization with the authenticated user as its owner
+//	@Tags			organizations
+//	@Accept			json
+//	@Produce		json
+//	@Param			organization	body		database.Organization	true	"Organization"
+//	@Param			Idempotency-Key	header		string					false	"Unique key that makes retries safe"
+//	@Success		201				{object}	database.Organization
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/orgs [post]
+//	@Security		BearerAuth
+func (app *application) createOrganization(c *gin.Context) {
+	var org database.Organization
+	if err := c.ShouldBindJSON(&org); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	user := GetUserFromContext(c)
+	if err := app.models.Organizations.Insert(&org, user.ID); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// GetMyOrganizations returns the organizations of the authenticated user
+//
+//	@Summary		Returns the organizations of the authenticated user
+//	@Description	Returns every organization the authenticated user is a member of
+//	@Tags			organizations
+//	@Produce		json
+//	@Success		200		{object}	[]database.Organization
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/orgs [get]
+//	@Security		BearerAuth
+func (app *application) getMyOrganizations(c *gin.Context) {
+	user := GetUserFromContext(c)
+	orgs, err := app.models.Organizations.GetForUser(user.ID)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, orgs)
+}
+
+// GetOrganization returns a single organization
+//
+//	@Summary		Returns a single organization
+//	@Description	Returns a single organization. Members only.
+//	@Tags			organizations
+//	@Produce		json
+//	@Param			orgId	path		int	true	"Organization ID"
+//	@Success		200		{object}	database.Organization
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/orgs/{orgId} [get]
+//	@Security		BearerAuth
+func (app *application) getOrganization(c *gin.Context) {
+	org, err := app.models.Organizations.Get(GetMembershipFromContext(c).OrganizationId)
+	if err != nil || org == nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// GetOrganizationMembers returns the members of an organization
+//
+//	@Summary		Returns the members of an organization
+//	@Description	Returns the members of an organization with their roles. Members only.
+//	@Tags			organizations
+//	@Produce		json
+//	@Param			orgId	path		int	true	"Organization ID"
+//	@Success		200		{object}	[]database.Membership
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/orgs/{orgId}/members [get]
+//	@Security		BearerAuth
+func (app *application) getOrganizationMembers(c *gin.Context) {
+	members, err := app.models.Organizations.GetMembers(GetMembershipFromContext(c).OrganizationId)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// UpdateOrganizationMember changes the role of a member
+//
+//	@Summary		Changes the role of a member
+//	@Description	Changes the role of a member. Only owners can grant or revoke the owner role.
+//	@Tags			organizations
+//	@Accept			json
+//	@Produce		json
+//	@Param			orgId	path		int					true	"Organization ID"
+//	@Param			userId	path		int					true	"User ID"
+//	@Param			member	body		updateMemberRequest	true	"Role"
+//	@Success		200		{object}	database.Membership
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/orgs/{orgId}/members/{userId} [put]
+//	@Security		BearerAuth
+func (app *application) updateOrganizationMember(c *gin.Context) {
+	userId, err := GetIDFromParam(c, "userId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid userId")
+		return
+	}
+
+	membership := GetMembershipFromContext(c)
+	if !membership.CanManage() {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to change roles")
+		return
+	}
+
+	var req updateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	var member *database.Membership
+	err = app.models.WithTx(func(tx database.Models) error {
+		var err error
+		if member, err = getMember(tx, membership.OrganizationId, userId); err != nil {
+			return err
+		}
+		if (req.Role == database.OrgRoleOwner || member.Role == database.OrgRoleOwner) && membership.Role != database.OrgRoleOwner {
+			return errNotOwner
+		}
+		if member.Role == database.OrgRoleOwner && req.Role != database.OrgRoleOwner {
+			if err := requireAnotherOwner(tx, member); err != nil {
+				return err
+			}
+		}
+		return tx.Organizations.SetMemberRole(membership.OrganizationId, userId, req.Role)
+	})
+	if err == errNotOwner {
+		ErrorResponse(c, http.StatusForbidden, "Only owners can change ownership")
+		return
+	}
+	if !memberErrorResponse(c, err) {
+		return
+	}
+
+	member.Role = req.Role
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveOrganizationMember removes a member from an organization
+//
+//	@Summary		Removes a member from an organization
+//	@Description	Removes a member. Admins can remove members, members can remove themselves. The last owner cannot leave.
+//	@Tags			organizations
+//	@Produce		json
+//	@Param			orgId	path	int	true	"Organization ID"
+//	@Param			userId	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/orgs/{orgId}/members/{userId} [delete]
+//	@Security		BearerAuth
+func (app *application) removeOrganizationMember(c *gin.Context) {
+	userId, err := GetIDFromParam(c, "userId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid userId")
+		return
+	}
+
+	membership := GetMembershipFromContext(c)
+	if userId != membership.UserId && !membership.CanManage() {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to remove members")
+		return
+	}
+
+	err = app.models.WithTx(func(tx database.Models) error {
+		member, err := getMember(tx, membership.OrganizationId, userId)
+		if err != nil {
+			return err
+		}
+		if member.Role == database.OrgRoleOwner {
+			if userId != membership.UserId && membership.Role != database.OrgRoleOwner {
+				return errNotOwner
+			}
+			if err := requireAnotherOwner(tx, member); err != nil {
+				return err
+			}
+		}
+		return tx.Organizations.RemoveMember(membership.OrganizationId, userId)
+	})
+	if err == errNotOwner {
+		ErrorResponse(c, http.StatusForbidden, "Only owners can remove owners")
+		return
+	}
+	if !memberErrorResponse(c, err) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateOrganizationInvitation invites someone to an organization by email
+//
+//	@Summary		Invites someone to an organization
+//	@Description	Sends an invitation token to the given email. Owners and admins only.
+//	@Tags			organizations
+//	@Accept			json
+//	@Produce		json
+//	@Param			orgId			path		int						true	"Organization ID"
+//	@Param			invitation		body		createInvitationRequest	true	"Invitation"
+//	@Param			Idempotency-Key	header		string					false	"Unique key that makes retries safe"
+//	@Success		201				{object}	database.Invitation
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/orgs/{orgId}/invitations [post]
+//	@Security		BearerAuth
+func (app *application) createOrganizationInvitation(c *gin.Context) {
+	membership := GetMembershipFromContext(c)
+	if !membership.CanManage() {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to invite members")
+		return
+	}
+
+	var req createInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	org, err := app.models.Organizations.Get(membership.OrganizationId)
+	if err != nil || org == nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	token, tokenHash, err := NewToken()
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	inv := database.Invitation{
+		OrganizationId: org.ID,
+		Email:          req.Email,
+		Role:           req.Role,
+		InvitedBy:      membership.UserId,
+		ExpiresAt:      time.Now().Add(invitationTTL).UTC(),
+	}
+	if err := app.models.Organizations.CreateInvitation(&inv, tokenHash); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	err = app.mailer.Send(mailer.Message{
+		To:      req.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", org.Name),
+		Body:    fmt.Sprintf("You have been invited to join %s as %s.\nSign up or log in with this email and accept the invitation with this token: %s\nIt expires in %s.", org.Name, req.Role, token, invitationTTL),
+	})
+	if err != nil {
+		log.Printf("send invitation %d: %v", inv.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, inv)
+}
+
+// GetOrganizationInvitations returns the pending invitations of an organization
+//
+//	@Summary		Returns the pending invitations of an organization
+//	@Description	Returns invitations that have not been accepted or expired. Owners and admins only.
+//	@Tags			organizations
+//	@Produce		json
+//	@Param			orgId	path		int	true	"Organization ID"
+//	@Success		200		{object}	[]database.Invitation
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/orgs/{orgId}/invitations [get]
+//	@Security		BearerAuth
+func (app *application) getOrganizationInvitations(c *gin.Context) {
+	membership := GetMembershipFromContext(c)
+	if !membership.CanManage() {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to view invitations")
+		return
+	}
+
+	invitations, err := app.models.Organizations.GetPendingInvitations(membership.OrganizationId)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// DeleteOrganizationInvitation revokes a pending invitation
+//
+//	@Summary		Revokes a pending invitation
+//	@Description	Revokes a pending invitation. Owners and admins only.
+//	@Tags			organizations
+//	@Produce		json
+//	@Param			orgId			path	int	true	"Organization ID"
+//	@Param			invitationId	path	int	true	"Invitation ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/orgs/{orgId}/invitations/{invitationId} [delete]
+//	@Security		BearerAuth
+func (app *application) deleteOrganizationInvitation(c *gin.Context) {
+	membership := GetMembershipFromContext(c)
+	if !membership.CanManage() {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to revoke invitations")
+		return
+	}
+
+	id, err := GetIDFromParam(c, "invitationId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid invitationId")
+		return
+	}
+
+	err = app.models.Organizations.DeleteInvitation(membership.OrganizationId, id)
+	if err == database.ErrNoRowsAffected {
+		ErrorResponse(c, http.StatusNotFound, "invitation not found")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AcceptOrganizationInvitation accepts an invitation to an organization
+//
+//	@Summary		Accepts an invitation to an organization
+//	@Description	Joins the organization with the emailed token. The invitation must have been sent to the authenticated user's email.
+//	@Tags			organizations
+//	@Accept			json
+//	@Produce		json
+//	@Param			invitation		body		acceptInvitationRequest	true	"Invitation token"
+//	@Param			Idempotency-Key	header		string					false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Membership
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/invitations/accept [post]
+//	@Security		BearerAuth
+func (app *application) acceptOrganizationInvitation(c *gin.Context) {
+	var req acceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	user := GetUserFromContext(c)
+	membership, err := app.models.Organizations.AcceptInvitation(HashToken(req.Token), user)
+	switch err {
+	case nil:
+	case database.ErrInvalidToken:
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	case database.ErrInvitationEmailMismatch:
+		ErrorResponse(c, http.StatusForbidden, err.Error())
+		return
+	default:
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, membership)
+}
+
+// OrganizationMiddleware loads the current user's membership of the
+// organization in the route and rejects non-members. It must run after
+// AuthMiddleWare.
+func (app *application) OrganizationMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		orgId, err := GetIDFromParam(ctx, "orgId")
+		if err != nil {
+			ErrorResponse(ctx, http.StatusBadRequest, "not valid orgId")
+			ctx.Abort()
+			return
+		}
+
+		user := GetUserFromContext(ctx)
+		membership, err := app.models.Organizations.GetMembership(orgId, user.ID)
+		if err != nil {
+			ServerErrorResponse(ctx, err)
+			ctx.Abort()
+			return
+		}
+		if membership == nil {
+			// Do not reveal whether the organization exists.
+			ErrorResponse(ctx, http.StatusNotFound, "organization not found")
+			ctx.Abort()
+			return
+		}
+
+		ctx.Set("membership", membership)
+		ctx.Next()
+	}
+}
+
+var (
+	errMemberNotFound = errors.New("member not found")
+	errNotOwner       = errors.New("only owners can change owners")
+	errLastOwner      = errors.New("organization needs at least one owner")
+)
+
+// getMember returns the membership of userId, or errMemberNotFound.
+func getMember(models database.Models, orgId, userId int) (*database.Membership, error) {
+	member, err := models.Organizations.GetMembership(orgId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, errMemberNotFound
+	}
+	return member, nil
+}
+
+// requireAnotherOwner returns errLastOwner when member is the only owner of
+// the organization.
+func requireAnotherOwner(models database.Models, member *database.Membership) error {
+	members, err := models.Organizations.GetMembers(member.OrganizationId)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if m.Role == database.OrgRoleOwner && m.UserId != member.UserId {
+			return nil
+		}
+	}
+	return errLastOwner
+}
+
+// memberErrorResponse writes the response for an error of a membership
+// change and returns whether there was none.
+func memberErrorResponse(c *gin.Context, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case errMemberNotFound:
+		ErrorResponse(c, http.StatusNotFound, "member not found")
+	case errLastOwner:
+		ErrorResponse(c, http.StatusConflict, "Organization needs at least one owner")
+	default:
+		ServerErrorResponse(c, err)
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	"github.com/LeeDat03/gin-event-app/internal/env"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/LeeDat03/gin-event-app/internal/payment"
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookSize bounds the body of webhook requests.
+const maxWebhookSize = 64 << 10
+
+type fakeCheckoutRequest struct {
+	Outcome string `json:"outcome" binding:"required,oneof=succeeded failed" enums:"succeeded,failed"`
+}
+
+// newPaymentProvider returns the provider orders are paid through. Only the
+// fake provider, which moves no money, is built in; it calls back the webhook
+// of this server, so APP_URL must reach it.
+func newPaymentProvider(baseURL string) payment.Provider {
+	if name := env.GetEnvString("PAYMENT_PROVIDER", "fake"); name != "fake" {
+		log.Fatalf("unknown PAYMENT_PROVIDER %q", name)
+	}
+	return payment.NewFakeProvider(
+		baseURL+"/api/v1/payments/fake",
+		baseURL+"/api/v1/payments/webhook",
+		env.GetEnvString("PAYMENT_WEBHOOK_SECRET", "whsec-123123"),
+	)
+}
+
+// PaymentWebhook receives payment events from the payment provider
+//
+//	@Summary		Receives payment events from the payment provider
+//	@Description	Called by the payment provider, which signs its requests. A succeeded payment marks its order paid and makes the ticket holders attendees; a failed one expires the order. Deliveries may be repeated safely. Payments that arrive after their order expired are refunded.
+//	@Tags			orders
+//	@Accept			json
+//	@Param			event	body	payment.Event	true	"Payment event"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/payments/webhook [post]
+func (app *application) paymentWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookSize))
+	if err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	event, err := app.payments.ParseWebhook(c.Request.Header, body)
+	if err == payment.ErrInvalidSignature {
+		ErrorResponse(c, http.StatusUnauthorized, "Webhook signature is not valid")
+		return
+	}
+	if err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	models := app.models.ForOrganization(database.AllOrganizations)
+	order, err := models.Orders.GetByPayment(event.PaymentId)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	if event.Amount != order.Total || event.Currency != order.Currency {
+		log.Printf("payment %s of order %d: paid %d %s, expected %d %s", event.PaymentId, order.ID, event.Amount, event.Currency, order.Total, order.Currency)
+		ErrorResponse(c, http.StatusBadRequest, "Payment does not match the order")
+		return
+	}
+
+	switch event.Type {
+	case payment.EventSucceeded:
+		err = app.confirmPayment(c, models, order)
+	case payment.EventFailed:
+		err = app.failPayment(c, models, order)
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// confirmPayment fulfils the order of a succeeded payment. Orders that are
+// not pending anymore were either fulfilled by an earlier delivery of the
+// event or expired first; the payment of the latter is refunded, as their
+// tickets may have been sold to someone else. So is the payment of an order
+// whose event was deleted or is no longer published meanwhile.
+func (app *application) confirmPayment(c *gin.Context, models database.Models, order *database.Order) error {
+	var event *database.Event
+	var attendees []*database.Attendee
+	refund := false
+	err := models.WithTx(func(tx database.Models) error {
+		attendees, refund = nil, false
+		current, err := tx.Orders.Get(order.ID)
+		if err != nil {
+			return err
+		}
+		if current.Status == database.OrderExpired {
+			refund = true
+			return nil
+		}
+		if current.Status != database.OrderPending {
+			return nil
+		}
+
+		event, err = tx.Events.Get(current.EventId)
+		if err == database.ErrEventNotFound || err == nil && event.Status != database.StatusPublished {
+			refund = true
+			if err := tx.Orders.SetStatus(current.ID, database.OrderPending, database.OrderExpired, time.Now()); err != nil {
+				return err
+			}
+			return app.audit(c, tx, database.AuditUpdate, database.ResourceOrder, current.ID,
+				map[string]string{"status": database.OrderPending}, map[string]string{"status": database.OrderExpired})
+		}
+		if err != nil {
+			return err
+		}
+		attendees, err = app.fulfilOrder(c, tx, current, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if refund {
+		if err := app.payments.Refund(c.Request.Context(), *order.PaymentId, order.Total); err != nil {
+			log.Printf("refund payment %s of expired order %d: %v", *order.PaymentId, order.ID, err)
+		} else {
+			log.Printf("refunded payment %s of expired order %d", *order.PaymentId, order.ID)
+		}
+		return nil
+	}
+	app.sendTickets(attendees)
+	return nil
+}
+
+// failPayment expires the order of a failed payment, releasing its tickets.
+// The buyer may place a new order.
+func (app *application) failPayment(c *gin.Context, models database.Models, order *database.Order) error {
+	return models.WithTx(func(tx database.Models) error {
+		err := tx.Orders.SetStatus(order.ID, database.OrderPending, database.OrderExpired, time.Now())
+		if err == database.ErrInvalidTransition {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceOrder, order.ID,
+			map[string]string{"status": database.OrderPending}, map[string]string{"status": database.OrderExpired})
+	})
+}
+
+// GetFakePayment returns a payment of the fake payment provider
+//
+//	@Summary		Returns a payment of the fake payment provider
+//	@Description	The checkout page of the fake payment provider, which is only available when PAYMENT_PROVIDER is fake. Complete the payment with the POST endpoint.
+//	@Tags			orders
+//	@Produce		json
+//	@Param			paymentId	path		string	true	"Payment ID"
+//	@Success		200			{object}	payment.FakePayment
+//	@Failure		default		{object}	helpers.Problem
+//	@Router			/api/v1/payments/fake/{paymentId} [get]
+func (app *application) getFakePayment(c *gin.Context) {
+	p, err := app.payments.(*payment.FakeProvider).Get(c.Param("paymentId"))
+	if err == payment.ErrPaymentNotFound {
+		ErrorResponse(c, http.StatusNotFound, "payment not found")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// CompleteFakePayment completes a payment of the fake payment provider
+//
+//	@Summary		Completes a payment of the fake payment provider
+//	@Description	Plays the buyer paying, or failing to pay, at the checkout of the fake payment provider. The outcome is delivered to the webhook before the response is sent; completing a payment again with the same outcome delivers it again.
+//	@Tags			orders
+//	@Accept			json
+//	@Produce		json
+//	@Param			paymentId	path		string				true	"Payment ID"
+//	@Param			outcome		body		fakeCheckoutRequest	true	"Outcome of the payment"
+//	@Success		200			{object}	payment.FakePayment
+//	@Failure		default		{object}	helpers.Problem
+//	@Router			/api/v1/payments/fake/{paymentId} [post]
+func (app *application) completeFakePayment(c *gin.Context) {
+	var req fakeCheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	provider := app.payments.(*payment.FakeProvider)
+	id := c.Param("paymentId")
+	err := provider.Complete(c.Request.Context(), id, req.Outcome == payment.FakeSucceeded)
+	switch err {
+	case nil:
+	case payment.ErrPaymentNotFound:
+		ErrorResponse(c, http.StatusNotFound, "payment not found")
+		return
+	case payment.ErrInvalidState:
+		ErrorResponse(c, http.StatusConflict, "Payment was already completed with another outcome")
+		return
+	default:
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	p, err := provider.Get(id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// promoCodePattern is what promo codes may consist of once normalized.
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]+$`)
+
+// GetPromoCodes returns the promo codes of an event
+//
+//	@Summary		Returns the promo codes of an event
+//	@Description	Organizers only. Returns the codes of the event with how often each was redeemed: paid orders, pending orders still holding their tickets, and the discount given and revenue of the paid ones.
+//	@Tags			orders
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]database.PromoCode
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/promo-codes [get]
+//	@Security		BearerAuth
+func (app *application) getPromoCodes(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	codes, err := app.modelsFor(c).PromoCodes.GetForEvent(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, codes)
+}
+
+// CreatePromoCode adds a promo code to an event
+//
+//	@Summary		Adds a promo code to an event
+//	@Description	Only the owner of the event or an admin of its organization may add promo codes. Codes are case-insensitive and take a percentage or a fixed amount, in the minor unit of its currency, off every ticket of the event or of one ticket type.
+//	@Tags			orders
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path		int					true	"Event ID"
+//	@Param			Idempotency-Key	header		string				false	"Unique key that makes retries safe"
+//	@Param			promoCode		body		database.PromoCode	true	"Promo code"
+//	@Success		201				{object}	database.PromoCode
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/promo-codes [post]
+//	@Security		BearerAuth
+func (app *application) createPromoCode(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	var code database.PromoCode
+	if err := c.ShouldBindJSON(&code); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	if err := checkPromoCode(&code); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	code.EventId = event.Id
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := checkPromoCodeTicketType(tx, &code); err != nil {
+			return err
+		}
+		if err := tx.PromoCodes.Insert(&code); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourcePromoCode, code.ID, nil, code)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, code)
+}
+
+// UpdatePromoCode updates a promo code
+//
+//	@Summary		Updates a promo code
+//	@Description	Orders already placed keep their discount. Lowering a limit below the redemptions so far only stops further ones.
+//	@Tags			orders
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int					true	"Event ID"
+//	@Param			codeId		path		int					true	"Promo code ID"
+//	@Param			promoCode	body		database.PromoCode	true	"Promo code"
+//	@Success		200			{object}	database.PromoCode
+//	@Failure		default		{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/promo-codes/{codeId} [put]
+//	@Security		BearerAuth
+func (app *application) updatePromoCode(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+	codeId, err := GetIDFromParam(c, "codeId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid codeId")
+		return
+	}
+
+	var updated database.PromoCode
+	if err := c.ShouldBindJSON(&updated); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	if err := checkPromoCode(&updated); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		existing, err := tx.PromoCodes.Get(event.Id, codeId)
+		if err != nil {
+			return err
+		}
+		updated.ID = existing.ID
+		updated.EventId = existing.EventId
+		updated.CreatedAt = existing.CreatedAt
+		updated.Redemptions = existing.Redemptions
+		updated.Reserved = existing.Reserved
+		updated.DiscountGiven = existing.DiscountGiven
+		updated.Revenue = existing.Revenue
+		if err := checkPromoCodeTicketType(tx, &updated); err != nil {
+			return err
+		}
+		if err := tx.PromoCodes.Update(&updated); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourcePromoCode, updated.ID, existing, updated)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeletePromoCode deletes a promo code
+//
+//	@Summary		Deletes a promo code
+//	@Description	Promo codes can only be deleted until the first order is placed with them; set the end of their validity window to stop them instead.
+//	@Tags			orders
+//	@Param			id		path	int	true	"Event ID"
+//	@Param			codeId	path	int	true	"Promo code ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/promo-codes/{codeId} [delete]
+//	@Security		BearerAuth
+func (app *application) deletePromoCode(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+	codeId, err := GetIDFromParam(c, "codeId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid codeId")
+		return
+	}
+
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		existing, err := tx.PromoCodes.Get(event.Id, codeId)
+		if err != nil {
+			return err
+		}
+		if err := tx.PromoCodes.Delete(event.Id, codeId); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourcePromoCode, existing.ID, existing, nil)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkPromoCode normalizes the code and rejects discounts that can't be
+// applied: percentages above 100, fixed amounts without a currency and
+// validity windows that end before they start.
+func checkPromoCode(p *database.PromoCode) error {
+	p.Code = database.NormalizePromoCode(p.Code)
+	if !promoCodePattern.MatchString(p.Code) {
+		return &InvalidFieldError{Field: "code", Code: "alphanum", Message: "may only contain letters, digits, - and _"}
+	}
+	switch p.DiscountType {
+	case database.DiscountPercent:
+		if p.Amount > 100 {
+			return &InvalidFieldError{Field: "amount", Code: "max", Message: "must be at most 100 for percent discounts"}
+		}
+		p.Currency = ""
+	case database.DiscountFixed:
+		if p.Currency == "" {
+			return &InvalidFieldError{Field: "currency", Code: "required", Message: "is required for fixed discounts"}
+		}
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return &InvalidFieldError{Field: "endsAt", Code: "gtfield", Message: "must be after startsAt"}
+	}
+	return nil
+}
+
+// checkPromoCodeTicketType makes sure the ticket type a promo code is
+// restricted to belongs to its event.
+func checkPromoCodeTicketType(tx database.Models, p *database.PromoCode) error {
+	if p.TicketTypeId == nil {
+		return nil
+	}
+	_, err := tx.TicketTypes.Get(p.EventId, *p.TicketTypeId)
+	if err == database.ErrTicketTypeNotFound {
+		return &InvalidFieldError{Field: "ticketTypeId", Code: "exists", Message: "is not a ticket type of this event"}
+	}
+	return err
+}
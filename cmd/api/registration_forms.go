@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// maxTextAnswer bounds the length of answers to text questions.
+const maxTextAnswer = 1000
+
+// questionKeyPattern is what question keys may consist of.
+var questionKeyPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+type registrationFormRequest struct {
+	Questions []database.Question `json:"questions" binding:"max=50,dive"`
+}
+
+type registrationRequest struct {
+	// Answers to the registration form of the event, keyed by question.
+	Answers database.Answers `json:"answers"`
+}
+
+// GetRegistrationForm returns the registration form of an event
+//
+//	@Summary		Returns the registration form of an event
+//	@Description	Returns the questions asked when registering for the event, the current version unless another is given. Answers are passed as answers when joining, being added or ordering tickets.
+//	@Tags			registration
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Param			version	query		int	false	"Form version"
+//	@Success		200		{object}	database.RegistrationForm
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/registration-form [get]
+func (app *application) getRegistrationForm(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid eventId")
+		return
+	}
+	event := app.getVisibleEventOrAbort(c, id)
+	if event == nil {
+		return
+	}
+
+	version := 0
+	if v := c.Query("version"); v != "" {
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			ErrorResponse(c, http.StatusBadRequest, "version must be a positive number")
+			return
+		}
+	}
+
+	form, err := app.modelsFor(c).RegistrationForms.Get(event.Id, version)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, form)
+}
+
+// UpdateRegistrationForm sets the registration form of an event
+//
+//	@Summary		Sets the registration form of an event
+//	@Description	Only the owner of the event or an admin of its organization may change the questions. Once someone answered the form, a change adds a new version and earlier answers keep the version they were given for. An empty list of questions stops asking.
+//	@Tags			registration
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int							true	"Event ID"
+//	@Param			form	body		registrationFormRequest		true	"Questions"
+//	@Success		200		{object}	database.RegistrationForm
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/registration-form [put]
+//	@Security		BearerAuth
+func (app *application) updateRegistrationForm(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	var req registrationFormRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	if err := checkQuestions(req.Questions); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	user := GetUserFromContext(c)
+	form := database.RegistrationForm{EventId: event.Id, Questions: req.Questions, ChangedBy: &user.ID}
+	if form.Questions == nil {
+		form.Questions = []database.Question{}
+	}
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		before, err := tx.RegistrationForms.Get(event.Id, 0)
+		if err == database.ErrRegistrationFormNotFound {
+			before = nil
+		} else if err != nil {
+			return err
+		}
+		if err := tx.RegistrationForms.Save(&form); err != nil {
+			return err
+		}
+		// Forms are identified by their event in the audit log.
+		if before == nil {
+			return app.audit(c, tx, database.AuditCreate, database.ResourceRegistrationForm, event.Id, nil, form)
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceRegistrationForm, event.Id, before, form)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, form)
+}
+
+// GetRegistrationAnswers returns the registration answers of an event
+//
+//	@Summary		Returns the registration answers of an event
+//	@Description	Organizers only. Returns the answers of every attendee, with the form version they answered, in the order they registered.
+//	@Tags			registration
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]database.RegistrationAnswers
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/registration-answers [get]
+//	@Security		BearerAuth
+func (app *application) getRegistrationAnswers(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	answers, err := app.modelsFor(c).RegistrationForms.GetAnswers(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, answers)
+}
+
+// ExportRegistrationAnswers exports the registration answers of an event
+//
+//	@Summary		Exports the registration answers of an event
+//	@Description	Organizers only. Downloads the answers of every attendee as CSV, one column per question of any form version. Multiple choices are separated by semicolons.
+//	@Tags			registration
+//	@Produce		text/csv
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{file}		file
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/registration-answers/export [get]
+//	@Security		BearerAuth
+func (app *application) exportRegistrationAnswers(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	models := app.modelsFor(c)
+	versions, err := models.RegistrationForms.GetVersions(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	answers, err := models.RegistrationForms.GetAnswers(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	keys, labels := answerColumns(versions)
+
+	filename := fmt.Sprintf("event-%d-registrations-%s.csv", event.Id, time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(append([]string{"user_id", "name", "email", "form_version", "registered_at"}, labels...))
+	for _, a := range answers {
+		row := []string{strconv.Itoa(a.UserId), a.Name, a.Email, strconv.Itoa(a.FormVersion), a.CreatedAt.Format(time.RFC3339)}
+		for _, key := range keys {
+			row = append(row, formatAnswer(a.Answers[key]))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+}
+
+// answerColumns returns the keys and labels of the questions of every
+// version of a form, for exports with a column per question. The questions
+// of the current version come first, followed by those only earlier
+// versions asked; each is labelled as it was last asked.
+func answerColumns(versions []*database.RegistrationForm) (keys, labels []string) {
+	seen := map[string]bool{}
+	for i := len(versions) - 1; i >= 0; i-- {
+		for _, q := range versions[i].Questions {
+			if !seen[q.Key] {
+				seen[q.Key] = true
+				keys = append(keys, q.Key)
+				labels = append(labels, q.Label)
+			}
+		}
+	}
+	return keys, labels
+}
+
+// formatAnswer renders an answer for exports.
+func formatAnswer(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case []any:
+		choices := make([]string, len(v))
+		for i, choice := range v {
+			choices[i] = fmt.Sprint(choice)
+		}
+		return strings.Join(choices, "; ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// checkQuestions rejects forms that can't be answered: duplicate or
+// malformed keys, choice questions without options and options on other
+// questions.
+func checkQuestions(questions []database.Question) error {
+	keys := map[string]bool{}
+	for i, q := range questions {
+		field := fmt.Sprintf("questions[%d]", i)
+		if !questionKeyPattern.MatchString(q.Key) {
+			return &InvalidFieldError{Field: field + ".key", Code: "alphanum", Message: "may only contain lowercase letters, digits and _"}
+		}
+		if keys[q.Key] {
+			return &InvalidFieldError{Field: field + ".key", Code: "unique", Message: "is used by another question"}
+		}
+		keys[q.Key] = true
+
+		choice := q.Type == database.QuestionSingleChoice || q.Type == database.QuestionMultiChoice
+		if choice && len(q.Options) == 0 {
+			return &InvalidFieldError{Field: field + ".options", Code: "required", Message: "are required for choice questions"}
+		}
+		if !choice && len(q.Options) > 0 {
+			return &InvalidFieldError{Field: field + ".options", Code: "excluded", Message: "are only allowed for choice questions"}
+		}
+		for j, option := range q.Options {
+			if slices.Contains(q.Options[:j], option) {
+				return &InvalidFieldError{Field: fmt.Sprintf("%s.options[%d]", field, j), Code: "unique", Message: "is listed twice"}
+			}
+		}
+	}
+	return nil
+}
+
+// bindAnswersOrAbort binds the optional body of a registration.
+func bindAnswersOrAbort(c *gin.Context) (database.Answers, bool) {
+	var req registrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		BindErrorResponse(c, err)
+		return nil, false
+	}
+	return req.Answers, true
+}
+
+// currentForm returns the registration form of an event, or nil if it asks
+// no questions.
+func currentForm(tx database.Models, eventId int) (*database.RegistrationForm, error) {
+	form, err := tx.RegistrationForms.Get(eventId, 0)
+	if err == database.ErrRegistrationFormNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(form.Questions) == 0 {
+		return nil, nil
+	}
+	return form, nil
+}
+
+// checkAnswers validates answers against a registration form and returns
+// them as they are stored: trimmed, without empty answers. Errors are
+// InvalidFieldErrors for the fields under field. It returns nil if the form
+// is nil.
+func checkAnswers(form *database.RegistrationForm, answers database.Answers, field string) (database.Answers, error) {
+	if form == nil {
+		if len(answers) > 0 {
+			return nil, &InvalidFieldError{Field: field, Code: "excluded", Message: "are not asked for by this event"}
+		}
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(answers))
+	for key := range answers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if form.Question(key) == nil {
+			return nil, &InvalidFieldError{Field: field + "." + key, Code: "unknown", Message: "is not a question of this form"}
+		}
+	}
+
+	checked := database.Answers{}
+	for _, q := range form.Questions {
+		f := field + "." + q.Key
+		v := answers[q.Key]
+		switch q.Type {
+		case database.QuestionText, database.QuestionSingleChoice:
+			s, ok := v.(string)
+			if v != nil && !ok {
+				return nil, &InvalidFieldError{Field: f, Code: "string", Message: "must be a string"}
+			}
+			s = strings.TrimSpace(s)
+			if s == "" {
+				break
+			}
+			if q.Type == database.QuestionText && len(s) > maxTextAnswer {
+				return nil, &InvalidFieldError{Field: f, Code: "max", Message: fmt.Sprintf("must be at most %d characters long", maxTextAnswer)}
+			}
+			if q.Type == database.QuestionSingleChoice && !slices.Contains(q.Options, s) {
+				return nil, &InvalidFieldError{Field: f, Code: "oneof", Message: "must be one of the options"}
+			}
+			checked[q.Key] = s
+
+		case database.QuestionMultiChoice:
+			list, ok := v.([]any)
+			if v != nil && !ok {
+				return nil, &InvalidFieldError{Field: f, Code: "array", Message: "must be a list of options"}
+			}
+			var choices []any
+			for _, choice := range list {
+				s, ok := choice.(string)
+				if !ok || !slices.Contains(q.Options, s) {
+					return nil, &InvalidFieldError{Field: f, Code: "oneof", Message: "must only contain options"}
+				}
+				if !slices.Contains(choices, any(s)) {
+					choices = append(choices, s)
+				}
+			}
+			if len(choices) > 0 {
+				checked[q.Key] = choices
+			}
+
+		case database.QuestionCheckbox:
+			b, ok := v.(bool)
+			if v != nil && !ok {
+				return nil, &InvalidFieldError{Field: f, Code: "boolean", Message: "must be true or false"}
+			}
+			if v != nil {
+				checked[q.Key] = b
+			}
+			if q.Required && !b {
+				return nil, &InvalidFieldError{Field: f, Code: "required", Message: "must be checked"}
+			}
+			continue
+		}
+		if q.Required && checked[q.Key] == nil {
+			return nil, &InvalidFieldError{Field: f, Code: "required", Message: "is required"}
+		}
+	}
+	return checked, nil
+}
+
+// saveAnswers stores the checked answers of a new attendee; there are none
+// if the event asks no questions.
+func saveAnswers(tx database.Models, form *database.RegistrationForm, attendee *database.Attendee, answers database.Answers) error {
+	if form == nil || answers == nil {
+		return nil
+	}
+	return tx.RegistrationForms.SaveAnswers(&database.RegistrationAnswers{
+		EventId:     attendee.EventId,
+		UserId:      attendee.UserId,
+		FormVersion: form.Version,
+		Answers:     answers,
+	})
+}
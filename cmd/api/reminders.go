@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/LeeDat03/gin-event-app/internal/jobs"
+	"github.com/LeeDat03/gin-event-app/internal/mailer"
+	"github.com/gin-gonic/gin"
+)
+
+// reminderInterval is how often due reminders are queued.
+const reminderInterval = time.Minute
+
+type eventRemindersRequest struct {
+	// MinutesBefore lists when to remind attendees, in minutes before the
+	// event starts, e.g. [1440, 60] for a day and an hour before.
+	MinutesBefore []int `json:"minutesBefore" binding:"max=5,dive,min=5,max=10080"`
+}
+
+type eventReminders struct {
+	MinutesBefore []int `json:"minutesBefore"`
+}
+
+// eventReminder is the payload of a reminder job: a reminder of an event to
+// one attendee, for the start the event had when it was queued.
+type eventReminder struct {
+	EventId       int       `json:"eventId"`
+	UserId        int       `json:"userId"`
+	MinutesBefore int       `json:"minutesBefore"`
+	StartsAt      time.Time `json:"startsAt"`
+}
+
+// GetEventReminders returns the reminders of an event
+//
+//	@Summary		Returns the reminders of an event
+//	@Description	Organizers only. Returns when attendees are reminded of the event, in minutes before it starts.
+//	@Tags			events
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	eventReminders
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/reminders [get]
+//	@Security		BearerAuth
+func (app *application) getEventReminders(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	minutes, err := app.modelsFor(c).EventReminders.Get(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, eventReminders{MinutesBefore: minutes})
+}
+
+// UpdateEventReminders sets the reminders of an event
+//
+//	@Summary		Sets the reminders of an event
+//	@Description	Only the owner of the event or an admin of its organization may change the reminders. Attendees who didn't opt out get an email at each of the given minutes before the published event starts, at most a week before. Events without a start time start at midnight UTC. Reminders that were sent are not sent again unless the event moves. An empty list stops reminding.
+//	@Tags			events
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int						true	"Event ID"
+//	@Param			reminders	body		eventRemindersRequest	true	"Reminders"
+//	@Success		200			{object}	eventReminders
+//	@Failure		default		{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/reminders [put]
+//	@Security		BearerAuth
+func (app *application) updateEventReminders(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	var req eventRemindersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	minutes := slices.Clone(req.MinutesBefore)
+	slices.Sort(minutes)
+	minutes = slices.Compact(minutes)
+	slices.Reverse(minutes)
+	if minutes == nil {
+		minutes = []int{}
+	}
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		before, err := tx.EventReminders.Get(event.Id)
+		if err != nil {
+			return err
+		}
+		if err := tx.EventReminders.Set(event.Id, minutes); err != nil {
+			return err
+		}
+		// Reminders are identified by their event in the audit log.
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceEventReminders, event.Id,
+			eventReminders{MinutesBefore: before}, eventReminders{MinutesBefore: minutes})
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, eventReminders{MinutesBefore: minutes})
+}
+
+// queueReminders queues a reminder job for every attendee of the events
+// whose reminders are due, every reminderInterval until ctx is done. Jobs
+// are unique per attendee, reminder and start of the event, so a reminder
+// queued again after a restart isn't sent twice, while one of an event that
+// moved is.
+func (app *application) queueReminders(ctx context.Context) {
+	models := app.models.ForOrganization(database.AllOrganizations)
+
+	ticker := time.NewTicker(reminderInterval)
+	defer ticker.Stop()
+
+	for {
+		reminders, err := models.EventReminders.Due(time.Now())
+		if err != nil {
+			log.Printf("find due reminders: %v", err)
+		}
+		for _, r := range reminders {
+			var queued int
+			err := models.WithTx(func(tx database.Models) error {
+				queued = 0
+				attendees, err := tx.Attendees.GetAttendeesByEvent(r.EventId)
+				if err != nil {
+					return err
+				}
+				for _, attendee := range attendees {
+					payload := eventReminder{EventId: r.EventId, UserId: attendee.ID, MinutesBefore: r.MinutesBefore, StartsAt: r.StartsAt}
+					key := fmt.Sprintf("%s:%d:%d:%d:%d", jobEventReminder, r.EventId, r.MinutesBefore, r.StartsAt.Unix(), attendee.ID)
+					_, added, err := jobs.Enqueue(&tx.Jobs, jobEventReminder, payload, jobs.Options{UniqueKey: key})
+					if err != nil {
+						return err
+					}
+					if added {
+						queued++
+					}
+				}
+				return tx.EventReminders.MarkQueued(r)
+			})
+			if err != nil {
+				log.Printf("queue reminders of event %d: %v", r.EventId, err)
+			} else if queued > 0 {
+				log.Printf("queued %d reminders of event %d", queued, r.EventId)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendEventReminder emails a reminder to an attendee, unless it is no longer
+// of use: the event was cancelled, deleted, has started or moved, or the
+// user left it or opted out of reminders since it was queued.
+func (app *application) sendEventReminder(ctx context.Context, r eventReminder) error {
+	models := app.models.ForOrganization(database.AllOrganizations)
+
+	event, err := models.Events.Get(r.EventId)
+	if err == database.ErrEventNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	startsAt, err := database.EventStart(event.Date, event.StartTime)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if event.Status != database.StatusPublished || !startsAt.Equal(r.StartsAt) || !time.Now().Before(startsAt) {
+		return nil
+	}
+
+	attendee, err := models.Attendees.GetByEventAndAttendee(r.EventId, r.UserId)
+	if err != nil || attendee == nil {
+		return err
+	}
+	user, err := models.Users.Get(r.UserId)
+	if err != nil || user == nil || !user.EventReminders {
+		return err
+	}
+
+	// Show the start in the user's time zone; the zone was checked when it
+	// was set.
+	loc, err := time.LoadLocation(user.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	// Reminders queued late, e.g. because they were added after they were
+	// due, say how long is actually left.
+	left := time.Until(startsAt).Round(5 * time.Minute)
+	if left < 5*time.Minute {
+		left = max(time.Until(startsAt).Round(time.Minute), time.Minute)
+	}
+	when := "on " + startsAt.Format("Monday, 2 January 2006")
+	if event.StartTime != "" {
+		when = "on " + startsAt.In(loc).Format("Monday, 2 January 2006 at 15:04 MST")
+	}
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: fmt.Sprintf("Reminder: %s starts in %s", event.Name, formatMinutes(int(left.Minutes()))),
+		Body: fmt.Sprintf("Hi %s,\n\n%s starts %s at %s.\n\nTo stop getting reminders, turn off eventReminders in your profile.",
+			user.Name, event.Name, when, event.Location),
+	})
+}
+
+// formatMinutes renders how long until an event starts, such as "1 hour"
+// or "90 minutes".
+func formatMinutes(n int) string {
+	unit := "minute"
+	if n%60 == 0 {
+		n, unit = n/60, "hour"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+)
+
+// purgeInterval is how often rows deleted longer than the retention window
+// ago are removed for good.
+const purgeInterval = time.Hour
+
+// purgeDeleted hard-deletes expired events and users together with the
+// files uploaded to their events, and removes jobs that succeeded before the
+// retention window and expired idempotency keys, every purgeInterval until
+// ctx is done.
+func (app *application) purgeDeleted(ctx context.Context) {
+	models := app.models.ForOrganization(database.AllOrganizations)
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		before := time.Now().Add(-app.retention)
+
+		var events []int
+		err := models.WithTx(func(tx database.Models) error {
+			var err error
+			if events, err = tx.Events.Purge(before); err != nil {
+				return err
+			}
+			return auditPurge(tx, database.ResourceEvent, events)
+		})
+		if err != nil {
+			log.Printf("purge deleted events: %v", err)
+		} else if len(events) > 0 {
+			log.Printf("purged %d deleted events", len(events))
+		}
+
+		var users *database.UserPurge
+		err = models.WithTx(func(tx database.Models) error {
+			var err error
+			if users, err = tx.Users.Purge(before); err != nil {
+				return err
+			}
+			if err := auditPurge(tx, database.ResourceEvent, users.Events); err != nil {
+				return err
+			}
+			if err := auditPurge(tx, database.ResourceVenue, users.Venues); err != nil {
+				return err
+			}
+			return auditPurge(tx, database.ResourceUser, users.Users)
+		})
+		if err != nil {
+			log.Printf("purge deleted users: %v", err)
+		} else if len(users.Users) > 0 {
+			log.Printf("purged %d deleted users", len(users.Users))
+		}
+
+		app.sweepOrphanedFiles(models)
+
+		if n, err := models.Jobs.DeleteFinished(before); err != nil {
+			log.Printf("delete finished jobs: %v", err)
+		} else if n > 0 {
+			log.Printf("deleted %d finished jobs", n)
+		}
+
+		if n, err := models.Idempotency.DeleteExpired(time.Now()); err != nil {
+			log.Printf("delete expired idempotency keys: %v", err)
+		} else if n > 0 {
+			log.Printf("deleted %d expired idempotency keys", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// auditPurge records that the rows of a resource type with the given ids
+// were purged. The entries have no actor.
+func auditPurge(tx database.Models, resourceType string, ids []int) error {
+	for _, id := range ids {
+		entry := database.AuditEntry{Action: database.AuditPurge, ResourceType: resourceType, ResourceId: id}
+		if err := tx.AuditLog.Insert(&entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+type revisionDiff struct {
+	From    int                    `json:"from"`
+	To      int                    `json:"to"`
+	Changes []database.FieldChange `json:"changes"`
+}
+
+type eventChange struct {
+	Revision  int                    `json:"revision"`
+	ChangedAt time.Time              `json:"changedAt"`
+	Changes   []database.FieldChange `json:"changes"`
+}
+
+// GetEventRevisions returns the revision history of an event
+//
+//	@Summary		Returns the revision history of an event
+//	@Description	Returns a snapshot of the event after its creation and after every update, oldest first. Organizers only.
+//	@Tags			revisions
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]database.EventRevision
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/revisions [get]
+//	@Security		BearerAuth
+func (app *application) getEventRevisions(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	revisions, err := app.modelsFor(c).Events.GetRevisions(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GetEventRevisionDiff compares two revisions of an event
+//
+//	@Summary		Compares two revisions of an event
+//	@Description	Lists the fields that changed between two revisions. to defaults to the latest revision and from to the one before it. Organizers only.
+//	@Tags			revisions
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Param			from	query		int	false	"Older revision"
+//	@Param			to		query		int	false	"Newer revision"
+//	@Success		200		{object}	revisionDiff
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/revisions/diff [get]
+//	@Security		BearerAuth
+func (app *application) getEventRevisionDiff(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	revisions, err := app.modelsFor(c).Events.GetRevisions(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	if len(revisions) == 0 {
+		ErrorResponse(c, http.StatusNotFound, "revision not found")
+		return
+	}
+
+	to, ok := revisionFromQuery(c, "to", len(revisions))
+	if !ok {
+		return
+	}
+	from, ok := revisionFromQuery(c, "from", max(to-1, 1))
+	if !ok {
+		return
+	}
+	if from < 1 || to > len(revisions) || from > to {
+		ErrorResponse(c, http.StatusNotFound, "revision not found")
+		return
+	}
+
+	// Revisions are numbered from 1 without gaps.
+	c.JSON(http.StatusOK, revisionDiff{
+		From:    from,
+		To:      to,
+		Changes: revisions[from-1].Diff(revisions[to-1]),
+	})
+}
+
+// RevertEvent reverts an event to a previous revision
+//
+//	@Summary		Reverts an event to a previous revision
+//	@Description	Restores the name, description, date, location and visibility of a revision. The revert is stored as a new revision. Event owner only.
+//	@Tags			revisions
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			revision		path		int		true	"Revision number"
+//	@Param			If-Match		header		string	false	"ETag of the event"
+//	@Param			Idempotency-Key	header		string	false	"Unique key that makes retries safe"
+//	@Success		200				{object}	database.Event
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/revisions/{revision}/revert [post]
+//	@Security		BearerAuth
+func (app *application) revertEvent(c *gin.Context) {
+	event := app.getManagedEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	revisionNumber, err := GetIDFromParam(c, "revision")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid revision")
+		return
+	}
+
+	if event.Status == database.StatusArchived {
+		ErrorResponse(c, http.StatusConflict, "Archived events cannot be changed")
+		return
+	}
+	if !checkIfMatch(c, event) {
+		return
+	}
+
+	revision, err := app.modelsFor(c).Events.GetRevision(event.Id, revisionNumber)
+	if err == database.ErrRevisionNotFound {
+		ErrorResponse(c, http.StatusNotFound, "revision not found")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	reverted := *event
+	reverted.Name = revision.Name
+	reverted.Description = revision.Description
+	reverted.Date = revision.Date
+	reverted.Location = revision.Location
+	reverted.Visibility = revision.Visibility
+
+	app.saveEventOrAbort(c, event, &reverted)
+}
+
+// GetEventChanges lists changes to the key details of an event
+//
+//	@Summary		Lists changes to the key details of an event
+//	@Description	Lists when the name, date or location of an event changed, newest first, for anyone who can see the event
+//	@Tags			revisions
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]eventChange
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/changes [get]
+func (app *application) getEventChanges(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid eventId")
+		return
+	}
+
+	event := app.getVisibleEventOrAbort(c, id)
+	if event == nil {
+		return
+	}
+
+	revisions, err := app.modelsFor(c).Events.GetRevisions(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	changes := []eventChange{}
+	for i := len(revisions) - 1; i > 0; i-- {
+		var key []database.FieldChange
+		for _, change := range revisions[i-1].Diff(revisions[i]) {
+			if isKeyEventField(change.Field) {
+				key = append(key, change)
+			}
+		}
+		if len(key) > 0 {
+			changes = append(changes, eventChange{
+				Revision:  revisions[i].Revision,
+				ChangedAt: revisions[i].CreatedAt,
+				Changes:   key,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+func isKeyEventField(field string) bool {
+	for _, f := range database.KeyEventFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// revisionFromQuery reads a revision number from the query, or returns def
+// when it is absent.
+func revisionFromQuery(c *gin.Context, name string, def int) (int, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, name+" must be a revision number")
+		return 0, false
+	}
+	return n, true
+}
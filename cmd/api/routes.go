@@ -3,33 +3,224 @@ package main
 import (
 	"net/http"
 
+	"github.com/LeeDat03/gin-event-app/internal/payment"
+
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 func (app *application) routes() http.Handler {
-	g := gin.Default()
+	g := gin.New()
+	g.Use(gin.Logger(), app.RequestIDMiddleware(), gin.CustomRecovery(recoverPanic))
+	g.NoRoute(routeNotFound)
+	idempotent := app.IdempotencyMiddleware()
 	v1 := g.Group("/api/v1")
 	{
-		v1.GET("/events", app.getAllEvents)
-		v1.GET("/events/:id", app.getEventById)
-		v1.GET("/events/:id/attendees", app.getAttendeesForEvent)
-		v1.GET("/attendees/:id/events", app.getEventsByAttendee)
-
+		v1.GET("/errors", app.getErrorCatalog)
 		v1.POST("/auth/register", app.registerUser)
 		v1.POST("/auth/login", app.login)
+		v1.POST("/auth/verify-email", app.verifyEmail)
+		v1.POST("/auth/accept-invite", app.acceptInvite)
+		v1.GET("/files/:token", app.downloadFile)
+		v1.GET("/tickets/:code/qr", app.getTicketQR)
+		v1.POST("/payments/webhook", app.paymentWebhook)
+		if _, ok := app.payments.(*payment.FakeProvider); ok {
+			v1.GET("/payments/fake/:paymentId", app.getFakePayment)
+			v1.POST("/payments/fake/:paymentId", app.completeFakePayment)
+		}
+
+	}
 
+	publicGroup := v1.Group("/")
+	publicGroup.Use(app.OptionalAuthMiddleware())
+	{
+		publicGroup.GET("/events", app.getAllEvents)
+		publicGroup.GET("/events/search", app.searchEvents)
+		publicGroup.GET("/events/nearby", app.nearbyEvents)
+		publicGroup.GET("/events/:id", app.getEventById)
+		publicGroup.GET("/events/:id/attendees", app.getAttendeesForEvent)
+		publicGroup.GET("/events/:id/changes", app.getEventChanges)
+		publicGroup.GET("/events/:id/cover", app.getEventCover)
+		publicGroup.GET("/events/:id/attachments", app.getEventAttachments)
+		publicGroup.GET("/events/:id/ticket-types", app.getTicketTypes)
+		publicGroup.GET("/events/:id/registration-form", app.getRegistrationForm)
+		publicGroup.GET("/attendees/:id/events", app.getEventsByAttendee)
+		publicGroup.GET("/venues", app.getVenues)
+		publicGroup.GET("/venues/:id", app.getVenue)
+		publicGroup.GET("/categories", app.getCategories)
+		publicGroup.GET("/tags", app.getTags)
 	}
 
 	authGroup := v1.Group("/")
-	authGroup.Use(app.AuthMiddleWare())
+	authGroup.Use(app.AuthMiddleWare(), idempotent)
 	{
 		authGroup.POST("/events", app.createEvent)
 		authGroup.PUT("/events/:id", app.updateEvent)
+		authGroup.PATCH("/events/:id", app.patchEvent)
 		authGroup.DELETE("/events/:id", app.deleteEvent)
+		authGroup.POST("/events/:id/publish", app.publishEvent)
+		authGroup.POST("/events/:id/cancel", app.cancelEvent)
+		authGroup.POST("/events/:id/complete", app.completeEvent)
+		authGroup.POST("/events/:id/archive", app.archiveEvent)
+		authGroup.POST("/events/:id/restore", app.restoreEvent)
+		authGroup.PUT("/events/:id/cover", app.uploadEventCover)
+		authGroup.DELETE("/events/:id/cover", app.deleteEventCover)
+		authGroup.POST("/events/:id/attachments", app.uploadEventAttachment)
+		authGroup.DELETE("/events/:id/attachments/:fileId", app.deleteEventAttachment)
+		authGroup.GET("/events/:id/revisions", app.getEventRevisions)
+		authGroup.GET("/events/:id/revisions/diff", app.getEventRevisionDiff)
+		authGroup.POST("/events/:id/revisions/:revision/revert", app.revertEvent)
+		authGroup.GET("/events/:id/attendees/export", app.exportAttendees)
+		authGroup.POST("/events/:id/attendees/import", app.importAttendees)
 		authGroup.POST("/events/:id/attendees/:userId", app.addAttendeeToEvent)
 		authGroup.DELETE("/events/:id/attendees/:userId", app.deleteAttendeeFromEvent)
+		authGroup.GET("/events/:id/ticket", app.getTicket)
+		authGroup.GET("/events/:id/check-in", app.getCheckInStats)
+		authGroup.POST("/events/:id/check-in", app.checkIn)
+		authGroup.DELETE("/events/:id/check-in/:userId", app.undoCheckIn)
+		authGroup.POST("/events/:id/ticket-types", app.createTicketType)
+		authGroup.PUT("/events/:id/ticket-types/:typeId", app.updateTicketType)
+		authGroup.DELETE("/events/:id/ticket-types/:typeId", app.deleteTicketType)
+		authGroup.GET("/events/:id/promo-codes", app.getPromoCodes)
+		authGroup.POST("/events/:id/promo-codes", app.createPromoCode)
+		authGroup.PUT("/events/:id/promo-codes/:codeId", app.updatePromoCode)
+		authGroup.DELETE("/events/:id/promo-codes/:codeId", app.deletePromoCode)
+		authGroup.PUT("/events/:id/registration-form", app.updateRegistrationForm)
+		authGroup.GET("/events/:id/registration-answers", app.getRegistrationAnswers)
+		authGroup.GET("/events/:id/registration-answers/export", app.exportRegistrationAnswers)
+		authGroup.GET("/events/:id/reminders", app.getEventReminders)
+		authGroup.PUT("/events/:id/reminders", app.updateEventReminders)
+		authGroup.GET("/events/:id/orders", app.getOrders)
+		authGroup.POST("/events/:id/orders", app.createOrder)
+		authGroup.GET("/events/:id/orders/:orderId", app.getOrder)
+		authGroup.POST("/events/:id/orders/:orderId/refund", app.refundOrder)
+		authGroup.GET("/events/:id/organizers", app.getEventOrganizers)
+		authGroup.POST("/events/:id/organizers/:userId", app.addEventOrganizer)
+		authGroup.DELETE("/events/:id/organizers/:userId", app.removeEventOrganizer)
+		authGroup.GET("/events/:id/invite-links", app.getInviteLinks)
+		authGroup.POST("/events/:id/invite-links", app.createInviteLink)
+		authGroup.DELETE("/events/:id/invite-links/:linkId", app.revokeInviteLink)
+		authGroup.POST("/invites/:token/join", app.joinWithInviteLink)
+		authGroup.POST("/venues", app.createVenue)
+		authGroup.PUT("/venues/:id", app.updateVenue)
+		authGroup.DELETE("/venues/:id", app.deleteVenue)
+		authGroup.POST("/venues/:id/rooms", app.createRoom)
+		authGroup.PUT("/venues/:id/rooms/:roomId", app.updateRoom)
+		authGroup.DELETE("/venues/:id/rooms/:roomId", app.deleteRoom)
+
+		authGroup.GET("/users/me", app.getCurrentUser)
+		authGroup.PATCH("/users/me", app.updateCurrentUser)
+		authGroup.DELETE("/users/me", app.deleteCurrentUser)
+		authGroup.PUT("/users/me/password", app.changePassword)
+		authGroup.POST("/users/me/email", app.changeEmail)
+		authGroup.GET("/users/me/export", app.exportCurrentUser)
+		authGroup.GET("/users/me/orders", app.getMyOrders)
+		authGroup.POST("/users/me/erase", app.eraseCurrentUser)
+
+		authGroup.GET("/orgs", app.getMyOrganizations)
+		authGroup.POST("/orgs", app.createOrganization)
+		authGroup.POST("/invitations/accept", app.acceptOrganizationInvitation)
+	}
+
+	orgGroup := authGroup.Group("/orgs/:orgId")
+	orgGroup.Use(app.OrganizationMiddleware())
+	{
+		orgGroup.GET("", app.getOrganization)
+		orgGroup.GET("/members", app.getOrganizationMembers)
+		orgGroup.PUT("/members/:userId", app.updateOrganizationMember)
+		orgGroup.DELETE("/members/:userId", app.removeOrganizationMember)
+		orgGroup.GET("/invitations", app.getOrganizationInvitations)
+		orgGroup.POST("/invitations", app.createOrganizationInvitation)
+		orgGroup.DELETE("/invitations/:invitationId", app.deleteOrganizationInvitation)
+
+		// Same handlers as the personal namespace, scoped to the organization.
+		orgGroup.GET("/events", app.getAllEvents)
+		orgGroup.GET("/events/search", app.searchEvents)
+		orgGroup.GET("/events/nearby", app.nearbyEvents)
+		orgGroup.POST("/events", app.createEvent)
+		orgGroup.GET("/events/:id", app.getEventById)
+		orgGroup.PUT("/events/:id", app.updateEvent)
+		orgGroup.PATCH("/events/:id", app.patchEvent)
+		orgGroup.DELETE("/events/:id", app.deleteEvent)
+		orgGroup.POST("/events/:id/publish", app.publishEvent)
+		orgGroup.POST("/events/:id/cancel", app.cancelEvent)
+		orgGroup.POST("/events/:id/complete", app.completeEvent)
+		orgGroup.POST("/events/:id/archive", app.archiveEvent)
+		orgGroup.POST("/events/:id/restore", app.restoreEvent)
+		orgGroup.GET("/events/:id/changes", app.getEventChanges)
+		orgGroup.GET("/events/:id/cover", app.getEventCover)
+		orgGroup.PUT("/events/:id/cover", app.uploadEventCover)
+		orgGroup.DELETE("/events/:id/cover", app.deleteEventCover)
+		orgGroup.GET("/events/:id/attachments", app.getEventAttachments)
+		orgGroup.POST("/events/:id/attachments", app.uploadEventAttachment)
+		orgGroup.DELETE("/events/:id/attachments/:fileId", app.deleteEventAttachment)
+		orgGroup.GET("/events/:id/revisions", app.getEventRevisions)
+		orgGroup.GET("/events/:id/revisions/diff", app.getEventRevisionDiff)
+		orgGroup.POST("/events/:id/revisions/:revision/revert", app.revertEvent)
+		orgGroup.GET("/events/:id/attendees", app.getAttendeesForEvent)
+		orgGroup.GET("/events/:id/attendees/export", app.exportAttendees)
+		orgGroup.POST("/events/:id/attendees/import", app.importAttendees)
+		orgGroup.POST("/events/:id/attendees/:userId", app.addAttendeeToEvent)
+		orgGroup.DELETE("/events/:id/attendees/:userId", app.deleteAttendeeFromEvent)
+		orgGroup.GET("/events/:id/ticket", app.getTicket)
+		orgGroup.GET("/events/:id/check-in", app.getCheckInStats)
+		orgGroup.POST("/events/:id/check-in", app.checkIn)
+		orgGroup.DELETE("/events/:id/check-in/:userId", app.undoCheckIn)
+		orgGroup.GET("/events/:id/ticket-types", app.getTicketTypes)
+		orgGroup.GET("/events/:id/registration-form", app.getRegistrationForm)
+		orgGroup.POST("/events/:id/ticket-types", app.createTicketType)
+		orgGroup.PUT("/events/:id/ticket-types/:typeId", app.updateTicketType)
+		orgGroup.DELETE("/events/:id/ticket-types/:typeId", app.deleteTicketType)
+		orgGroup.GET("/events/:id/promo-codes", app.getPromoCodes)
+		orgGroup.POST("/events/:id/promo-codes", app.createPromoCode)
+		orgGroup.PUT("/events/:id/promo-codes/:codeId", app.updatePromoCode)
+		orgGroup.DELETE("/events/:id/promo-codes/:codeId", app.deletePromoCode)
+		orgGroup.PUT("/events/:id/registration-form", app.updateRegistrationForm)
+		orgGroup.GET("/events/:id/registration-answers", app.getRegistrationAnswers)
+		orgGroup.GET("/events/:id/registration-answers/export", app.exportRegistrationAnswers)
+		orgGroup.GET("/events/:id/reminders", app.getEventReminders)
+		orgGroup.PUT("/events/:id/reminders", app.updateEventReminders)
+		orgGroup.GET("/events/:id/orders", app.getOrders)
+		orgGroup.POST("/events/:id/orders", app.createOrder)
+		orgGroup.GET("/events/:id/orders/:orderId", app.getOrder)
+		orgGroup.POST("/events/:id/orders/:orderId/refund", app.refundOrder)
+		orgGroup.GET("/events/:id/organizers", app.getEventOrganizers)
+		orgGroup.POST("/events/:id/organizers/:userId", app.addEventOrganizer)
+		orgGroup.DELETE("/events/:id/organizers/:userId", app.removeEventOrganizer)
+		orgGroup.GET("/events/:id/invite-links", app.getInviteLinks)
+		orgGroup.POST("/events/:id/invite-links", app.createInviteLink)
+		orgGroup.DELETE("/events/:id/invite-links/:linkId", app.revokeInviteLink)
+		orgGroup.GET("/attendees/:id/events", app.getEventsByAttendee)
+		orgGroup.GET("/tags", app.getTags)
+		orgGroup.GET("/venues", app.getVenues)
+		orgGroup.POST("/venues", app.createVenue)
+		orgGroup.GET("/venues/:id", app.getVenue)
+		orgGroup.PUT("/venues/:id", app.updateVenue)
+		orgGroup.DELETE("/venues/:id", app.deleteVenue)
+		orgGroup.POST("/venues/:id/rooms", app.createRoom)
+		orgGroup.PUT("/venues/:id/rooms/:roomId", app.updateRoom)
+		orgGroup.DELETE("/venues/:id/rooms/:roomId", app.deleteRoom)
+	}
+
+	adminGroup := authGroup.Group("/admin")
+	adminGroup.Use(app.AdminMiddleware())
+	{
+		adminGroup.GET("/users/:id/export", app.adminExportUser)
+		adminGroup.POST("/users/:id/erase", app.adminEraseUser)
+		adminGroup.GET("/users", app.adminGetUsers)
+		adminGroup.POST("/users/:id/restore", app.adminRestoreUser)
+		adminGroup.GET("/events", app.adminGetEvents)
+		adminGroup.POST("/events/:id/restore", app.adminRestoreEvent)
+		adminGroup.GET("/audit-log", app.adminGetAuditLog)
+		adminGroup.GET("/audit-log/export", app.adminExportAuditLog)
+		adminGroup.GET("/jobs", app.adminGetJobs)
+		adminGroup.POST("/jobs/:id/retry", app.adminRetryJob)
+		adminGroup.POST("/categories", app.adminCreateCategory)
+		adminGroup.PUT("/categories/:id", app.adminUpdateCategory)
+		adminGroup.DELETE("/categories/:id", app.adminDeleteCategory)
+		adminGroup.PUT("/tags/:name", app.adminRenameTag)
+		adminGroup.POST("/tags/merge", app.adminMergeTags)
 	}
 
 	g.GET("/swagger/*any", func(c *gin.Context) {
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchEvents searches events by name, description and location
+//
+//	@Summary		Searches events
+//	@Description	Full-text search over event names, descriptions and locations, best matches first. Every word of q must match, and words match as prefixes ("conf" finds "conference"). Only events the caller may see are returned. Highlights are HTML-escaped with matches wrapped in <mark>.
+//	@Tags			events
+//	@Produce		json
+//	@Param			q			query		string	true	"Search text"
+//	@Param			from		query		string	false	"Only events on or after this date (2006-01-02)"
+//	@Param			to			query		string	false	"Only events on or before this date (2006-01-02)"
+//	@Param			location	query		string	false	"Only events whose location contains this text"
+//	@Param			limit		query		int		false	"Maximum number of results (max 100)"
+//	@Param			offset		query		int		false	"Number of results to skip"
+//	@Success		200			{object}	[]database.EventSearchResult
+//	@Failure		default		{object}	helpers.Problem
+//	@Router			/api/v1/events/search [get]
+func (app *application) searchEvents(c *gin.Context) {
+	search := database.EventSearch{
+		Query:    c.Query("q"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+		Location: c.Query("location"),
+	}
+	if search.Query == "" {
+		ErrorResponse(c, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	for name, v := range map[string]string{"from": search.From, "to": search.To} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			ErrorResponse(c, http.StatusBadRequest, name+" must be a date in the format 2006-01-02")
+			return
+		}
+	}
+
+	var ok bool
+	search.Limit, search.Offset, ok = pageOrAbort(c)
+	if !ok {
+		return
+	}
+
+	results, err := app.modelsFor(c).Events.Search(search, app.viewerId(c))
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// pageOrAbort reads the limit and offset query parameters of a search.
+func pageOrAbort(c *gin.Context) (limit, offset int, ok bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+	if err != nil || limit < 1 || limit > maxSearchLimit {
+		ErrorResponse(c, http.StatusBadRequest, "limit must be between 1 and 100")
+		return 0, 0, false
+	}
+	offset, err = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		ErrorResponse(c, http.StatusBadRequest, "offset must not be negative")
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
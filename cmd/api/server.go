@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 )
 
-func serve(app *application) error {
+// shutdownTimeout is how long requests in flight may take to finish once
+// the server is asked to stop.
+const shutdownTimeout = 15 * time.Second
+
+// serve runs the server until ctx is done, then shuts it down gracefully.
+func serve(ctx context.Context, app *application) error {
 	server := http.Server{
 		Addr:         fmt.Sprintf(":%d", app.port),
 		Handler:      app.routes(),
@@ -15,7 +22,19 @@ func serve(app *application) error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
-	log.Printf("Starting server on port %d", app.port)
 
-	return server.ListenAndServe()
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down server")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	log.Printf("Starting server on port %d", app.port)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdown
 }
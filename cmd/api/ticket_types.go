@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// GetTicketTypes returns the ticket types of an event
+//
+//	@Summary		Returns the ticket types of an event
+//	@Description	Returns the tickets sold for an event, cheapest first, with how many of each are still available
+//	@Tags			orders
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	[]database.TicketType
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/ticket-types [get]
+func (app *application) getTicketTypes(c *gin.Context) {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid eventId")
+		return
+	}
+	event := app.getVisibleEventOrAbort(c, id)
+	if event == nil {
+		return
+	}
+
+	ticketTypes, err := app.modelsFor(c).TicketTypes.GetForEvent(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ticketTypes)
+}
+
+// CreateTicketType adds a ticket type to an event
+//
+//	@Summary		Adds a ticket type to an event
+//	@Description	Only the owner of the event or an admin of its organization may sell tickets. Prices are in the minor unit of the currency, e.g. cents; free tickets cost 0.
+//	@Tags			orders
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path		int					true	"Event ID"
+//	@Param			Idempotency-Key	header		string				false	"Unique key that makes retries safe"
+//	@Param			ticketType		body		database.TicketType	true	"Ticket type"
+//	@Success		201				{object}	database.TicketType
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/ticket-types [post]
+//	@Security		BearerAuth
+func (app *application) createTicketType(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	var ticketType database.TicketType
+	if err := c.ShouldBindJSON(&ticketType); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	if err := checkSaleWindow(&ticketType); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	ticketType.EventId = event.Id
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.TicketTypes.Insert(&ticketType); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourceTicketType, ticketType.ID, nil, ticketType)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, ticketType)
+}
+
+// UpdateTicketType updates a ticket type
+//
+//	@Summary		Updates a ticket type
+//	@Description	Orders already placed keep their price. The quantity can't be lowered below the tickets sold or reserved.
+//	@Tags			orders
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int					true	"Event ID"
+//	@Param			typeId		path		int					true	"Ticket type ID"
+//	@Param			ticketType	body		database.TicketType	true	"Ticket type"
+//	@Success		200			{object}	database.TicketType
+//	@Failure		default		{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/ticket-types/{typeId} [put]
+//	@Security		BearerAuth
+func (app *application) updateTicketType(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+	typeId, err := GetIDFromParam(c, "typeId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid typeId")
+		return
+	}
+
+	var updated database.TicketType
+	if err := c.ShouldBindJSON(&updated); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	if err := checkSaleWindow(&updated); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		existing, err := tx.TicketTypes.Get(event.Id, typeId)
+		if err != nil {
+			return err
+		}
+		taken := existing.Quantity - existing.Available
+		if updated.Quantity < taken {
+			return &InvalidFieldError{Field: "quantity", Code: "min", Message: fmt.Sprintf("must be at least %d, the tickets sold or reserved", taken)}
+		}
+
+		updated.ID = existing.ID
+		updated.EventId = existing.EventId
+		updated.CreatedAt = existing.CreatedAt
+		updated.Available = updated.Quantity - taken
+		if err := tx.TicketTypes.Update(&updated); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceTicketType, updated.ID, existing, updated)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteTicketType deletes a ticket type
+//
+//	@Summary		Deletes a ticket type
+//	@Description	Ticket types can only be deleted until the first order is placed for them; set the end of the sale window to stop selling them instead.
+//	@Tags			orders
+//	@Param			id		path	int	true	"Event ID"
+//	@Param			typeId	path	int	true	"Ticket type ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/ticket-types/{typeId} [delete]
+//	@Security		BearerAuth
+func (app *application) deleteTicketType(c *gin.Context) {
+	event := app.getEditableEventOrAbort(c)
+	if event == nil {
+		return
+	}
+	typeId, err := GetIDFromParam(c, "typeId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid typeId")
+		return
+	}
+
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		existing, err := tx.TicketTypes.Get(event.Id, typeId)
+		if err != nil {
+			return err
+		}
+		if err := tx.TicketTypes.Delete(event.Id, typeId); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceTicketType, existing.ID, existing, nil)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkSaleWindow rejects sale windows that end before they start.
+func checkSaleWindow(t *database.TicketType) error {
+	if t.SaleStartsAt != nil && t.SaleEndsAt != nil && !t.SaleEndsAt.After(*t.SaleStartsAt) {
+		return &InvalidFieldError{Field: "saleEndsAt", Code: "gtfield", Message: "must be after saleStartsAt"}
+	}
+	return nil
+}
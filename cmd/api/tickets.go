@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/LeeDat03/gin-event-app/internal/ical"
+	"github.com/LeeDat03/gin-event-app/internal/jobs"
+	"github.com/LeeDat03/gin-event-app/internal/mailer"
+	"github.com/LeeDat03/gin-event-app/internal/qr"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ticketPurpose = "ticket"
+	// qrModuleSize is the width in pixels of a module of ticket QR codes.
+	qrModuleSize = 8
+)
+
+type ticketResponse struct {
+	EventId     int        `json:"eventId"`
+	AttendeeId  int        `json:"attendeeId"`
+	UserId      int        `json:"userId"`
+	Code        string     `json:"code"`
+	QRURL       string     `json:"qrUrl"`
+	CheckedInAt *time.Time `json:"checkedInAt,omitempty"`
+}
+
+type checkInRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type checkInResponse struct {
+	Attendee *database.Attendee `json:"attendee"`
+	// Name is the attendee's name, so door staff can match it to an ID.
+	Name  string                 `json:"name"`
+	Stats *database.CheckInStats `json:"stats"`
+}
+
+// GetTicket returns the current user's ticket for an event
+//
+//	@Summary		Returns your ticket for an event
+//	@Description	Returns the ticket of the current user for an event they attend: a signed code to show at the door and a link to it as a QR code. With format=ics the ticket is returned as a calendar entry carrying the code.
+//	@Tags			tickets
+//	@Produce		json
+//	@Produce		text/calendar
+//	@Param			id		path		int		true	"Event ID"
+//	@Param			format	query		string	false	"json (default) or ics"
+//	@Success		200		{object}	ticketResponse
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/ticket [get]
+//	@Security		BearerAuth
+func (app *application) getTicket(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "ics" {
+		ErrorResponse(c, http.StatusBadRequest, "format must be json or ics")
+		return
+	}
+
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid eventId")
+		return
+	}
+	event := app.getVisibleEventOrAbort(c, id)
+	if event == nil {
+		return
+	}
+
+	user := GetUserFromContext(c)
+	attendee, err := app.modelsFor(c).Attendees.GetByEventAndAttendee(event.Id, user.ID)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	if attendee == nil {
+		ErrorResponse(c, http.StatusNotFound, "You are not attending this event")
+		return
+	}
+
+	ticket := app.ticketFor(attendee)
+	if format == "json" {
+		c.JSON(http.StatusOK, ticket)
+		return
+	}
+
+	date, err := ical.ParseDate(event.Date)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	description := "Ticket: " + ticket.Code
+	if event.Description != "" {
+		description = event.Description + "\n\n" + description
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="ticket-%d.ics"`, event.Id))
+	c.Status(http.StatusOK)
+	err = ical.Write(c.Writer, []ical.Event{{
+		UID:         fmt.Sprintf("event-%d@gin-event-app", event.Id),
+		Summary:     event.Name,
+		Description: description,
+		Location:    event.Location,
+		Date:        date,
+		Cancelled:   event.Status == database.StatusCancelled,
+		URL:         ticket.QRURL,
+	}})
+	if err != nil {
+		log.Printf("write ticket of attendee %d: %v", attendee.ID, err)
+	}
+}
+
+// GetTicketQR renders a ticket as a QR code
+//
+//	@Summary		Renders a ticket as a QR code
+//	@Description	Returns the ticket code as a QR code PNG. The code itself is the credential, so no token is needed; tickets of removed attendees return 404.
+//	@Tags			tickets
+//	@Produce		png
+//	@Param			code	path	string	true	"Ticket code"
+//	@Success		200		{file}	file
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/tickets/{code}/qr [get]
+func (app *application) getTicketQR(c *gin.Context) {
+	code := c.Param("code")
+	_, attendeeId, ok := app.parseTicket(code)
+	if !ok {
+		ErrorResponse(c, http.StatusNotFound, "ticket not found")
+		return
+	}
+	models := app.models.ForOrganization(database.AllOrganizations)
+	attendee, err := models.Attendees.Get(attendeeId)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	if attendee == nil {
+		ErrorResponse(c, http.StatusNotFound, "ticket not found")
+		return
+	}
+
+	symbol, err := qr.Encode([]byte(code))
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	png, err := symbol.PNG(qrModuleSize)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// CheckIn checks an attendee in with their ticket
+//
+//	@Summary		Checks an attendee in
+//	@Description	Validates a scanned ticket code and records that its attendee arrived. A ticket that was already scanned returns 409 already_checked_in with the time of the first scan. Only published events accept check-ins. Owner and organizers only.
+//	@Tags			tickets
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path		int				true	"Event ID"
+//	@Param			ticket			body		checkInRequest	true	"Scanned ticket"
+//	@Param			Idempotency-Key	header		string			false	"Unique key that makes retries safe"
+//	@Success		200				{object}	checkInResponse
+//	@Failure		409				{object}	helpers.Problem{checkedInAt=string}
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/check-in [post]
+//	@Security		BearerAuth
+func (app *application) checkIn(c *gin.Context) {
+	var req checkInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	event := app.getCheckInEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	eventId, attendeeId, ok := app.parseTicket(strings.TrimSpace(req.Code))
+	if !ok || eventId != event.Id {
+		ErrorResponse(c, http.StatusNotFound, "Ticket is not valid for this event")
+		return
+	}
+
+	var attendee *database.Attendee
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		var err error
+		attendee, err = tx.Attendees.Get(attendeeId)
+		if err != nil {
+			return err
+		}
+		if attendee == nil || attendee.EventId != event.Id {
+			return errTicketNotFound
+		}
+		if attendee.CheckedInAt != nil {
+			return &database.AlreadyCheckedInError{CheckedInAt: *attendee.CheckedInAt}
+		}
+		before := *attendee
+		if err := tx.Attendees.CheckIn(attendee, time.Now().UTC()); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceAttendee, attendee.ID, before, attendee)
+	})
+	if err == errTicketNotFound {
+		ErrorResponse(c, http.StatusNotFound, "Ticket is not valid for this event")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	response := checkInResponse{Attendee: attendee}
+	if user, err := app.models.Users.Get(attendee.UserId); err == nil && user != nil {
+		response.Name = user.Name
+	}
+	response.Stats, err = app.modelsFor(c).Attendees.CheckInStats(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UndoCheckIn clears the check-in of an attendee
+//
+//	@Summary		Undoes a check-in
+//	@Description	Clears the check-in of an attendee, e.g. after a ticket was scanned by mistake. Returns 409 if the attendee is not checked in. Owner and organizers only.
+//	@Tags			tickets
+//	@Param			id		path	int	true	"Event ID"
+//	@Param			userId	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/check-in/{userId} [delete]
+//	@Security		BearerAuth
+func (app *application) undoCheckIn(c *gin.Context) {
+	userId, err := GetIDFromParam(c, "userId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid userId")
+		return
+	}
+
+	event := app.getCheckInEventOrAbort(c)
+	if event == nil {
+		return
+	}
+
+	err = app.modelsFor(c).WithTx(func(tx database.Models) error {
+		attendee, err := tx.Attendees.GetByEventAndAttendee(event.Id, userId)
+		if err != nil {
+			return err
+		}
+		if attendee == nil {
+			return errTicketNotFound
+		}
+		before := *attendee
+		if err := tx.Attendees.UndoCheckIn(attendee); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceAttendee, attendee.ID, before, attendee)
+	})
+	if err == errTicketNotFound {
+		ErrorResponse(c, http.StatusNotFound, "attendee not found")
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetCheckInStats returns the live check-in count of an event
+//
+//	@Summary		Returns the check-in count of an event
+//	@Description	Returns how many attendees an event has and how many of them have checked in. Meant to be polled during the event; responses are never cached. Owner and organizers only.
+//	@Tags			tickets
+//	@Produce		json
+//	@Param			id		path		int	true	"Event ID"
+//	@Success		200		{object}	database.CheckInStats
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/events/{id}/check-in [get]
+//	@Security		BearerAuth
+func (app *application) getCheckInStats(c *gin.Context) {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return
+	}
+
+	stats, err := app.modelsFor(c).Attendees.CheckInStats(event.Id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, stats)
+}
+
+var errTicketNotFound = errors.New("ticket not found")
+
+// getCheckInEventOrAbort returns the event in the route if the current user
+// organizes it and it is published, the only status attendees are checked in
+// at.
+func (app *application) getCheckInEventOrAbort(c *gin.Context) *database.Event {
+	event := app.getEventFromParamOrAbort(c)
+	if event == nil {
+		return nil
+	}
+	if !app.requireOrganizer(c, GetUserFromContext(c), event) {
+		return nil
+	}
+	if event.Status != database.StatusPublished {
+		ErrorResponse(c, http.StatusConflict, "Event is "+event.Status)
+		return nil
+	}
+	return event
+}
+
+// ticketFor returns the ticket of an attendee. Its code names the event and
+// the RSVP and is signed, so it can't be forged; removing the attendee voids
+// it, as a new RSVP gets a new id.
+func (app *application) ticketFor(attendee *database.Attendee) ticketResponse {
+	code := SignValue(app.jwtSecret, ticketPurpose, fmt.Sprintf("%d.%d", attendee.EventId, attendee.ID))
+	return ticketResponse{
+		EventId:     attendee.EventId,
+		AttendeeId:  attendee.ID,
+		UserId:      attendee.UserId,
+		Code:        code,
+		QRURL:       fmt.Sprintf("%s/api/v1/tickets/%s/qr", app.baseURL, code),
+		CheckedInAt: attendee.CheckedInAt,
+	}
+}
+
+// parseTicket returns the event and attendee ids of a ticket code if its
+// signature is valid.
+func (app *application) parseTicket(code string) (eventId, attendeeId int, ok bool) {
+	value, ok := VerifySignedValue(app.jwtSecret, ticketPurpose, code)
+	if !ok {
+		return 0, 0, false
+	}
+	event, attendee, found := strings.Cut(value, ".")
+	eventId, err1 := strconv.Atoi(event)
+	attendeeId, err2 := strconv.Atoi(attendee)
+	if !found || err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return eventId, attendeeId, true
+}
+
+// ticketEmail is the payload of a jobSendTicket job. It only names the
+// attendee: the ticket code is signed when the email is sent, so it's never
+// stored with the job.
+type ticketEmail struct {
+	AttendeeId int `json:"attendeeId"`
+}
+
+// sendTicket queues an email with the ticket of a new attendee. Failures
+// are logged: the ticket can always be fetched again.
+func (app *application) sendTicket(attendee *database.Attendee) {
+	_, _, err := jobs.Enqueue(&app.models.Jobs, jobSendTicket, ticketEmail{AttendeeId: attendee.ID},
+		jobs.Options{UniqueKey: fmt.Sprintf("%s:%d", jobSendTicket, attendee.ID)})
+	if err != nil {
+		log.Printf("queue ticket of attendee %d: %v", attendee.ID, err)
+	}
+}
+
+// sendTickets queues emails with the tickets of new attendees.
+func (app *application) sendTickets(attendees []*database.Attendee) {
+	for _, attendee := range attendees {
+		app.sendTicket(attendee)
+	}
+}
+
+// mailTicket emails an attendee their ticket. Nothing is sent once the RSVP,
+// the event or the account is gone, or the account was anonymized.
+func (app *application) mailTicket(ctx context.Context, t ticketEmail) error {
+	models := app.models.ForOrganization(database.AllOrganizations)
+	attendee, err := models.Attendees.Get(t.AttendeeId)
+	if err != nil || attendee == nil {
+		return err
+	}
+	event, err := models.Events.Get(attendee.EventId)
+	if err == database.ErrEventNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	user, err := models.Users.Get(attendee.UserId)
+	if err != nil || user == nil || user.AnonymizedAt != nil {
+		return err
+	}
+
+	ticket := app.ticketFor(attendee)
+	path := fmt.Sprintf("/api/v1/events/%d/ticket", event.Id)
+	if event.OrganizationId != nil {
+		path = fmt.Sprintf("/api/v1/orgs/%d/events/%d/ticket", *event.OrganizationId, event.Id)
+	}
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: fmt.Sprintf("Your ticket for %s", event.Name),
+		Body: fmt.Sprintf("Hi %s,\n\nYou're attending %s on %s at %s. Show this code at the door:\n\n%s\n\nAs a QR code: %s\nAdd it to your calendar: %s%s?format=ics",
+			user.Name, event.Name, event.Date, event.Location, ticket.Code, ticket.QRURL, app.baseURL, path),
+	})
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/LeeDat03/gin-event-app/internal/mailer"
+	"github.com/LeeDat03/gin-event-app/internal/privacy"
+	"github.com/gin-gonic/gin"
+)
+
+const emailTokenTTL = 24 * time.Hour
+
+type updateProfileRequest struct {
+	Name      *string `json:"name" binding:"omitempty,min=2"`
+	AvatarURL *string `json:"avatarUrl" binding:"omitempty,url"`
+	Bio       *string `json:"bio" binding:"omitempty,max=500"`
+	TimeZone  *string `json:"timeZone" binding:"omitempty"`
+	// EventReminders turns reminders of the events the user attends on or
+	// off.
+	EventReminders *bool `json:"eventReminders"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=8"`
+}
+
+type changeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type eraseAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type deleteAccountRequest struct {
+	Password    string `json:"password" binding:"required"`
+	OwnedEvents string `json:"ownedEvents" binding:"required,oneof=transfer cancel cascade"`
+	TransferTo  int    `json:"transferTo" binding:"required_if=OwnedEvents transfer"`
+}
+
+// GetCurrentUser returns the authenticated user
+//
+//	@Summary		Returns the authenticated user
+//	@Description	Returns the profile of the authenticated user
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Success		200		{object}	database.User
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/users/me [get]
+//	@Security		BearerAuth
+func (app *application) getCurrentUser(c *gin.Context) {
+	c.JSON(http.StatusOK, GetUserFromContext(c))
+}
+
+// UpdateCurrentUser updates the authenticated user's profile
+//
+//	@Summary		Updates the authenticated user's profile
+//	@Description	Updates name, avatar URL, bio, time zone and whether to get event reminders. Omitted fields are left unchanged.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			profile	body		updateProfileRequest	true	"Profile fields"
+//	@Success		200		{object}	database.User
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/users/me [patch]
+//	@Security		BearerAuth
+func (app *application) updateCurrentUser(c *gin.Context) {
+	var req updateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	user := *GetUserFromContext(c)
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	if req.AvatarURL != nil {
+		user.AvatarURL = *req.AvatarURL
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+	if req.TimeZone != nil {
+		if _, err := time.LoadLocation(*req.TimeZone); err != nil || *req.TimeZone == "" {
+			ErrorResponse(c, http.StatusBadRequest, "Invalid time zone")
+			return
+		}
+		user.TimeZone = *req.TimeZone
+	}
+	if req.EventReminders != nil {
+		user.EventReminders = *req.EventReminders
+	}
+
+	err := app.models.WithTx(func(tx database.Models) error {
+		if err := tx.Users.UpdateProfile(&user); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceUser, user.ID, GetUserFromContext(c), user)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword changes the authenticated user's password
+//
+//	@Summary		Changes the authenticated user's password
+//	@Description	Changes the password after checking the current one
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			password	body	changePasswordRequest	true	"Current and new password"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/users/me/password [put]
+//	@Security		BearerAuth
+func (app *application) changePassword(c *gin.Context) {
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	user := GetUserFromContext(c)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		ErrorResponse(c, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	err = app.models.WithTx(func(tx database.Models) error {
+		if err := tx.Users.UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceUser, user.ID, nil, gin.H{"password": "changed"})
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ChangeEmail starts an email change for the authenticated user
+//
+//	@Summary		Starts an email change
+//	@Description	Stores the new address as pending and sends a verification token to it. The email is only changed once the token is verified.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			email			body		changeEmailRequest	true	"New email and current password"
+//	@Param			Idempotency-Key	header		string				false	"Unique key that makes retries safe"
+//	@Success		202				{object}	database.User
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/users/me/email [post]
+//	@Security		BearerAuth
+func (app *application) changeEmail(c *gin.Context) {
+	var req changeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	user := *GetUserFromContext(c)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		ErrorResponse(c, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	existing, err := app.models.Users.GetByEmail(req.Email)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+	if existing != nil {
+		ProblemResponse(c, http.StatusConflict, CodeAlreadyExists, "Email already in use")
+		return
+	}
+
+	token, tokenHash, err := NewToken()
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	err = app.models.WithTx(func(tx database.Models) error {
+		if err := tx.Users.RequestEmailChange(user.ID, req.Email, tokenHash, time.Now().Add(emailTokenTTL)); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceUser, user.ID, nil, gin.H{"pendingEmail": req.Email})
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	err = app.mailer.Send(mailer.Message{
+		To:      req.Email,
+		Subject: "Confirm your new email address",
+		Body:    fmt.Sprintf("Use this token to confirm your new email address: %s\nIt expires in %s.", token, emailTokenTTL),
+	})
+	if err != nil {
+		log.Printf("send email verification to user %d: %v", user.ID, err)
+	}
+
+	user.PendingEmail = req.Email
+	c.JSON(http.StatusAccepted, user)
+}
+
+// VerifyEmail confirms a pending email change
+//
+//	@Summary		Confirms a pending email change
+//	@Description	Confirms a pending email change with the token sent to the new address
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			token			body		verifyEmailRequest	true	"Verification token"
+//	@Success		200				{object}	database.User
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/auth/verify-email [post]
+func (app *application) verifyEmail(c *gin.Context) {
+	var req verifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	var user *database.User
+	err := app.models.WithTx(func(tx database.Models) error {
+		var err error
+		if user, err = tx.Users.ConfirmEmailChange(HashToken(req.Token)); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceUser, user.ID, nil, gin.H{"email": user.Email})
+	})
+	if err == database.ErrInvalidToken {
+		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteCurrentUser deletes the authenticated user's account
+//
+//	@Summary		Deletes the authenticated user's account
+//	@Description	Deletes the account and frees its email for new accounts. Owned events are transferred to another user, cancelled or deleted together with the account; events and venues of an organization can only be transferred to one of its members. Cancelled events stay visible with their attendees, who are notified, also after the account is purged; their paid orders are refunded. Drafts are deleted. An admin can restore the account until the retention window ends; after that it is purged with its RSVPs.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			account	body	deleteAccountRequest	true	"Password and what to do with owned events"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/users/me [delete]
+//	@Security		BearerAuth
+func (app *application) deleteCurrentUser(c *gin.Context) {
+	var req deleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	user := GetUserFromContext(c)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		ErrorResponse(c, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	transferTo := 0
+	if req.OwnedEvents == database.OwnedEventsTransfer {
+		if req.TransferTo == user.ID {
+			ErrorResponse(c, http.StatusBadRequest, "Cannot transfer events to yourself")
+			return
+		}
+		if app.getUserOrAbort(c, req.TransferTo) == nil {
+			return
+		}
+		transferTo = req.TransferTo
+	}
+
+	var cancelled []cancelledEvent
+	err := app.models.WithTx(func(tx database.Models) error {
+		cancelled = nil
+		deletion, err := tx.Users.Delete(user.ID, req.OwnedEvents, transferTo)
+		if err != nil {
+			return err
+		}
+
+		fromOwner, toOwner := gin.H{"ownerId": user.ID}, gin.H{"ownerId": transferTo}
+		for _, id := range deletion.TransferredEvents {
+			if err := app.audit(c, tx, database.AuditUpdate, database.ResourceEvent, id, fromOwner, toOwner); err != nil {
+				return err
+			}
+		}
+		for _, id := range deletion.TransferredVenues {
+			if err := app.audit(c, tx, database.AuditUpdate, database.ResourceVenue, id, fromOwner, toOwner); err != nil {
+				return err
+			}
+		}
+
+		for _, id := range deletion.DeletedEvents {
+			if err := app.audit(c, tx, database.AuditDelete, database.ResourceEvent, id, nil, nil); err != nil {
+				return err
+			}
+		}
+
+		// Who to notify is collected in the same transaction, so attendees
+		// joining meanwhile are not missed.
+		models := tx.ForOrganization(database.AllOrganizations)
+		for _, id := range deletion.CancelledEvents {
+			event, err := models.Events.Get(id)
+			if err != nil {
+				return err
+			}
+			attendees, err := models.Attendees.GetAttendeesByEvent(id)
+			if err != nil {
+				return err
+			}
+			before := gin.H{"status": database.StatusPublished, "version": event.Version - 1}
+			after := gin.H{"status": event.Status, "version": event.Version}
+			if err := app.audit(c, tx, database.AuditUpdate, database.ResourceEvent, id, before, after); err != nil {
+				return err
+			}
+			if err := app.settleCancelledOrders(c, models, id); err != nil {
+				return err
+			}
+			cancelled = append(cancelled, cancelledEvent{event: event, attendees: attendees})
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceUser, user.ID, nil, gin.H{"ownedEvents": req.OwnedEvents, "transferTo": transferTo})
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	for _, ce := range cancelled {
+		app.notifyEventCancelled(ce.event, ce.attendees)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ExportCurrentUser exports the authenticated user's personal data
+//
+//	@Summary		Exports the authenticated user's personal data
+//	@Description	Returns a zip archive with the user record, owned events and RSVPs as JSON plus an ICS calendar
+//	@Tags			users
+//	@Produce		application/zip
+//	@Success		200		{file}		file
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/users/me/export [get]
+//	@Security		BearerAuth
+func (app *application) exportCurrentUser(c *gin.Context) {
+	app.writeUserExport(c, GetUserFromContext(c).ID)
+}
+
+// EraseCurrentUser anonymizes the authenticated user
+//
+//	@Summary		Anonymizes the authenticated user
+//	@Description	Erases the user's personal data, including registration answers, answers given with orders and queued emails. RSVPs are kept anonymously so attendance counts of other people's events stay intact. The account can no longer be used.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			account			body	eraseAccountRequest	true	"Current password"
+//	@Param			Idempotency-Key	header	string				false	"Unique key that makes retries safe"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/users/me/erase [post]
+//	@Security		BearerAuth
+func (app *application) eraseCurrentUser(c *gin.Context) {
+	var req eraseAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+
+	user := GetUserFromContext(c)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		ErrorResponse(c, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	if err := app.anonymizeUser(c, user.ID); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (app *application) anonymizeUser(c *gin.Context, id int) error {
+	return app.models.WithTx(func(tx database.Models) error {
+		if err := tx.Users.Anonymize(id); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditAnonymize, database.ResourceUser, id, nil, nil)
+	})
+}
+
+func (app *application) writeUserExport(c *gin.Context, userId int) {
+	export, err := privacy.Collect(app.models, userId)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.zip"`, userId))
+	c.Status(http.StatusOK)
+	if err := privacy.WriteArchive(c.Writer, export); err != nil {
+		log.Printf("write export for user %d: %v", userId, err)
+	}
+}
+
+type cancelledEvent struct {
+	event     *database.Event
+	attendees []*database.User
+}
+
+// notifyEventCancelled queues an email to every attendee of a cancelled
+// event, once per attendee however often it is called.
+func (app *application) notifyEventCancelled(event *database.Event, attendees []*database.User) {
+	for _, attendee := range attendees {
+		err := app.enqueueEmail(mailer.Message{
+			To:      attendee.Email,
+			Subject: fmt.Sprintf("%s has been cancelled", event.Name),
+			Body:    fmt.Sprintf("Hi %s,\n\n%s on %s at %s has been cancelled by the organizer.", attendee.Name, event.Name, event.Date, event.Location),
+		}, fmt.Sprintf("%s:event-cancelled:%d:%d", jobSendEmail, event.Id, attendee.ID))
+		if err != nil {
+			log.Printf("notify user %d about cancelled event %d: %v", attendee.ID, event.Id, err)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	. "github.com/LeeDat03/gin-event-app/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateVenue creates a new venue
+//
+//	@Summary		Creates a new venue
+//	@Description	Creates a venue, optionally with rooms, with the authenticated user as its owner. Room capacities may not exceed the capacity of the venue.
+//	@Tags			venues
+//	@Accept			json
+//	@Produce		json
+//	@Param			venue			body		database.Venue	true	"Venue"
+//	@Param			Idempotency-Key	header		string			false	"Unique key that makes retries safe"
+//	@Success		201				{object}	database.Venue
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/venues [post]
+//	@Security		BearerAuth
+func (app *application) createVenue(c *gin.Context) {
+	var venue database.Venue
+	if err := c.ShouldBindJSON(&venue); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	for i, room := range venue.Rooms {
+		if err := checkRoomCapacity(&venue, room, "rooms["+strconv.Itoa(i)+"].capacity"); err != nil {
+			ServerErrorResponse(c, err)
+			return
+		}
+	}
+
+	user := GetUserFromContext(c)
+	venue.OwnerId = &user.ID
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Venues.Insert(&venue); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourceVenue, venue.ID, nil, venue)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, venue)
+}
+
+// GetVenues returns all venues
+//
+//	@Summary		Returns all venues
+//	@Description	Returns the venues of the personal namespace, or of the organization, with their rooms
+//	@Tags			venues
+//	@Produce		json
+//	@Success		200		{object}	[]database.Venue
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/venues [get]
+func (app *application) getVenues(c *gin.Context) {
+	venues, err := app.modelsFor(c).Venues.GetAll()
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, venues)
+}
+
+// GetVenue returns a single venue
+//
+//	@Summary		Returns a single venue
+//	@Description	Returns a single venue with its rooms
+//	@Tags			venues
+//	@Produce		json
+//	@Param			id		path		int	true	"Venue ID"
+//	@Success		200		{object}	database.Venue
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/venues/{id} [get]
+func (app *application) getVenue(c *gin.Context) {
+	venue := app.getVenueOrAbort(c)
+	if venue == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, venue)
+}
+
+// UpdateVenue updates an existing venue
+//
+//	@Summary		Updates an existing venue
+//	@Description	Replaces the name, address and capacity of a venue; rooms are changed through their own routes. The capacity may not drop below that of a room. Venue owner, or organization owners and admins.
+//	@Tags			venues
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int				true	"Venue ID"
+//	@Param			venue	body		database.Venue	true	"Venue"
+//	@Success		200		{object}	database.Venue
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/venues/{id} [put]
+//	@Security		BearerAuth
+func (app *application) updateVenue(c *gin.Context) {
+	existing := app.getManagedVenueOrAbort(c)
+	if existing == nil {
+		return
+	}
+
+	var updated database.Venue
+	if err := c.ShouldBindJSON(&updated); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	updated.ID = existing.ID
+	updated.OrganizationId = existing.OrganizationId
+	updated.OwnerId = existing.OwnerId
+	updated.Rooms = existing.Rooms
+	updated.CreatedAt = existing.CreatedAt
+	for _, room := range updated.Rooms {
+		if checkRoomCapacity(&updated, room, "capacity") != nil {
+			ServerErrorResponse(c, &InvalidFieldError{Field: "capacity", Code: "min", Message: "must be at least " + strconv.Itoa(*room.Capacity) + ", the capacity of room " + room.Name})
+			return
+		}
+	}
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Venues.Update(&updated); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceVenue, updated.ID, existing, updated)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteVenue deletes a venue
+//
+//	@Summary		Deletes a venue
+//	@Description	Deletes a venue and its rooms. Venues that events are booked at, including deleted events that have not been purged yet, cannot be deleted. Venue owner, or organization owners and admins.
+//	@Tags			venues
+//	@Produce		json
+//	@Param			id	path	int	true	"Venue ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/venues/{id} [delete]
+//	@Security		BearerAuth
+func (app *application) deleteVenue(c *gin.Context) {
+	venue := app.getManagedVenueOrAbort(c)
+	if venue == nil {
+		return
+	}
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Venues.Delete(venue.ID); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceVenue, venue.ID, venue, nil)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateRoom adds a room to a venue
+//
+//	@Summary		Adds a room to a venue
+//	@Description	Adds a room to a venue. Its capacity may not exceed the capacity of the venue, and room names are unique within a venue. Venue owner, or organization owners and admins.
+//	@Tags			venues
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path		int				true	"Venue ID"
+//	@Param			room			body		database.Room	true	"Room"
+//	@Param			Idempotency-Key	header		string			false	"Unique key that makes retries safe"
+//	@Success		201				{object}	database.Room
+//	@Failure		default			{object}	helpers.Problem
+//	@Router			/api/v1/venues/{id}/rooms [post]
+//	@Security		BearerAuth
+func (app *application) createRoom(c *gin.Context) {
+	venue := app.getManagedVenueOrAbort(c)
+	if venue == nil {
+		return
+	}
+
+	var room database.Room
+	if err := c.ShouldBindJSON(&room); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	room.VenueId = venue.ID
+	if err := checkRoomCapacity(venue, &room, "capacity"); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Venues.InsertRoom(&room); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditCreate, database.ResourceRoom, room.ID, nil, room)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, room)
+}
+
+// UpdateRoom updates a room of a venue
+//
+//	@Summary		Updates a room of a venue
+//	@Description	Replaces the name and capacity of a room. Venue owner, or organization owners and admins.
+//	@Tags			venues
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int				true	"Venue ID"
+//	@Param			roomId	path		int				true	"Room ID"
+//	@Param			room	body		database.Room	true	"Room"
+//	@Success		200		{object}	database.Room
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/venues/{id}/rooms/{roomId} [put]
+//	@Security		BearerAuth
+func (app *application) updateRoom(c *gin.Context) {
+	venue := app.getManagedVenueOrAbort(c)
+	if venue == nil {
+		return
+	}
+	existing := getRoomOrAbort(c, venue)
+	if existing == nil {
+		return
+	}
+
+	var room database.Room
+	if err := c.ShouldBindJSON(&room); err != nil {
+		BindErrorResponse(c, err)
+		return
+	}
+	room.ID = existing.ID
+	room.VenueId = venue.ID
+	if err := checkRoomCapacity(venue, &room, "capacity"); err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Venues.UpdateRoom(&room); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditUpdate, database.ResourceRoom, room.ID, existing, room)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, room)
+}
+
+// DeleteRoom deletes a room of a venue
+//
+//	@Summary		Deletes a room of a venue
+//	@Description	Deletes a room. Rooms that events are booked in cannot be deleted. Venue owner, or organization owners and admins.
+//	@Tags			venues
+//	@Produce		json
+//	@Param			id		path	int	true	"Venue ID"
+//	@Param			roomId	path	int	true	"Room ID"
+//	@Success		204
+//	@Failure		default	{object}	helpers.Problem
+//	@Router			/api/v1/venues/{id}/rooms/{roomId} [delete]
+//	@Security		BearerAuth
+func (app *application) deleteRoom(c *gin.Context) {
+	venue := app.getManagedVenueOrAbort(c)
+	if venue == nil {
+		return
+	}
+	room := getRoomOrAbort(c, venue)
+	if room == nil {
+		return
+	}
+
+	err := app.modelsFor(c).WithTx(func(tx database.Models) error {
+		if err := tx.Venues.DeleteRoom(venue.ID, room.ID); err != nil {
+			return err
+		}
+		return app.audit(c, tx, database.AuditDelete, database.ResourceRoom, room.ID, room, nil)
+	})
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getVenueOrAbort returns the venue in the route.
+func (app *application) getVenueOrAbort(c *gin.Context) *database.Venue {
+	id, err := GetIDFromParam(c, "id")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid venueId")
+		return nil
+	}
+
+	venue, err := app.modelsFor(c).Venues.Get(id)
+	if err != nil {
+		ServerErrorResponse(c, err)
+		return nil
+	}
+	return venue
+}
+
+// getManagedVenueOrAbort returns the venue in the route if the current user
+// may change it: its owner, or an admin of the organization it belongs to.
+func (app *application) getManagedVenueOrAbort(c *gin.Context) *database.Venue {
+	venue := app.getVenueOrAbort(c)
+	if venue == nil {
+		return nil
+	}
+
+	user := GetUserFromContext(c)
+	membership := GetMembershipFromContext(c)
+	if (venue.OwnerId == nil || *venue.OwnerId != user.ID) && (membership == nil || !membership.CanManage()) {
+		ErrorResponse(c, http.StatusForbidden, "Not allowed to update this")
+		return nil
+	}
+	return venue
+}
+
+func getRoomOrAbort(c *gin.Context, venue *database.Venue) *database.Room {
+	id, err := GetIDFromParam(c, "roomId")
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "not valid roomId")
+		return nil
+	}
+
+	room := venue.Room(id)
+	if room == nil {
+		ErrorResponse(c, http.StatusNotFound, "room not found")
+		return nil
+	}
+	return room
+}
+
+// checkRoomCapacity rejects rooms that hold more people than their venue.
+// field is the request field reported when they do.
+func checkRoomCapacity(venue *database.Venue, room *database.Room, field string) error {
+	if venue.Capacity == nil || room.Capacity == nil || *room.Capacity <= *venue.Capacity {
+		return nil
+	}
+	return &InvalidFieldError{Field: field, Code: "max", Message: "must not exceed the venue capacity of " + strconv.Itoa(*venue.Capacity)}
+}
+
+// checkBooking validates the schedule and venue booking of event before it is
+// saved with models: the hours must be in order, the venue and room must
+// belong to the tenant, the capacity must fit the room or venue, and no other
+// event may hold the room at the same time. Cancelled and archived events
+// don't hold their booking, so they are not checked for overlaps. Conflicts
+// with events viewerId may not see are only counted.
+func checkBooking(models database.Models, event *database.Event, viewerId int) error {
+	if event.StartTime != "" && event.EndTime <= event.StartTime {
+		return &InvalidFieldError{Field: "endTime", Code: "gtfield", Message: "must be after startTime"}
+	}
+	if event.VenueId == nil {
+		return nil
+	}
+
+	venue, err := models.Venues.Get(*event.VenueId)
+	if err == database.ErrVenueNotFound {
+		return &InvalidFieldError{Field: "venueId", Code: "exists", Message: "does not refer to a venue"}
+	}
+	if err != nil {
+		return err
+	}
+
+	limit, of := venue.Capacity, "venue"
+	if event.RoomId != nil {
+		room := venue.Room(*event.RoomId)
+		if room == nil {
+			return &InvalidFieldError{Field: "roomId", Code: "exists", Message: "does not refer to a room of the venue"}
+		}
+		if room.Capacity != nil {
+			limit, of = room.Capacity, "room"
+		}
+	}
+	if event.Capacity != nil && limit != nil && *event.Capacity > *limit {
+		return &InvalidFieldError{Field: "capacity", Code: "max", Message: "must not exceed the " + of + " capacity of " + strconv.Itoa(*limit)}
+	}
+
+	if event.Status == database.StatusCancelled || event.Status == database.StatusArchived {
+		return nil
+	}
+	conflicts, hidden, err := models.Events.Overlapping(event, viewerId)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 || hidden > 0 {
+		return &database.BookingConflictError{Conflicts: conflicts, Hidden: hidden}
+	}
+	return nil
+}
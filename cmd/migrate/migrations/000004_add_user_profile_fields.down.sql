@@ -0,0 +1,7 @@
+-- 000004_add_user_profile_fields.down.sql
+ALTER TABLE users DROP COLUMN email_token_expires_at;
+ALTER TABLE users DROP COLUMN email_token;
+ALTER TABLE users DROP COLUMN pending_email;
+ALTER TABLE users DROP COLUMN time_zone;
+ALTER TABLE users DROP COLUMN bio;
+ALTER TABLE users DROP COLUMN avatar_url;
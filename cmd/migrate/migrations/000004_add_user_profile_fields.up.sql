@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN pending_email TEXT;
+ALTER TABLE users ADD COLUMN email_token TEXT;
+ALTER TABLE users ADD COLUMN email_token_expires_at DATETIME;
@@ -0,0 +1,3 @@
+-- 000005_add_user_role_and_anonymization.down.sql
+ALTER TABLE users DROP COLUMN anonymized_at;
+ALTER TABLE users DROP COLUMN role;
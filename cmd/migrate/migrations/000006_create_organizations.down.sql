@@ -0,0 +1,6 @@
+-- 000006_create_organizations.down.sql
+DROP INDEX IF EXISTS idx_events_organization_id;
+ALTER TABLE events DROP COLUMN organization_id;
+DROP TABLE IF EXISTS organization_invitations;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
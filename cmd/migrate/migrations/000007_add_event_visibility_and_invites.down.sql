@@ -0,0 +1,4 @@
+-- 000007_add_event_visibility_and_invites.down.sql
+DROP TABLE IF EXISTS event_invite_links;
+DROP TABLE IF EXISTS event_organizers;
+ALTER TABLE events DROP COLUMN visibility;
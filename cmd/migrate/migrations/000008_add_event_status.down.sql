@@ -0,0 +1,4 @@
+-- 000008_add_event_status.down.sql
+DROP INDEX IF EXISTS idx_events_scheduled;
+ALTER TABLE events DROP COLUMN publish_at;
+ALTER TABLE events DROP COLUMN status;
@@ -0,0 +1,4 @@
+ALTER TABLE events ADD COLUMN status TEXT NOT NULL DEFAULT 'published' CHECK (status IN ('draft', 'published', 'cancelled', 'completed', 'archived'));
+ALTER TABLE events ADD COLUMN publish_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_events_scheduled ON events (publish_at) WHERE status = 'draft';
@@ -0,0 +1,5 @@
+-- 000009_add_soft_delete.down.sql
+DROP INDEX IF EXISTS idx_users_deleted_at;
+DROP INDEX IF EXISTS idx_events_deleted_at;
+ALTER TABLE users DROP COLUMN deleted_at;
+ALTER TABLE events DROP COLUMN deleted_at;
@@ -0,0 +1,2 @@
+-- 000011_create_event_revisions.down.sql
+DROP TABLE IF EXISTS event_revisions;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS event_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL,
+    date TEXT NOT NULL,
+    location TEXT NOT NULL,
+    visibility TEXT NOT NULL,
+    changed_by INTEGER,
+    changed_fields TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    UNIQUE (event_id, revision),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+);
+
+-- Existing events start their history with their current state.
+INSERT INTO event_revisions (event_id, revision, name, description, date, location, visibility, changed_by, created_at)
+SELECT id, 1, name, description, date(date), location, visibility, owner_id, CURRENT_TIMESTAMP
+FROM events;
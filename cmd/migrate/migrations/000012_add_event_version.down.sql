@@ -0,0 +1,2 @@
+-- 000012_add_event_version.down.sql
+ALTER TABLE events DROP COLUMN version;
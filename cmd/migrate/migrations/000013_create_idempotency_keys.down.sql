@@ -0,0 +1,2 @@
+-- 000013_create_idempotency_keys.down.sql
+DROP TABLE IF EXISTS idempotency_keys;
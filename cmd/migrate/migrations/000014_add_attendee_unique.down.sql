@@ -0,0 +1,2 @@
+-- 000014_add_attendee_unique.down.sql
+DROP INDEX IF EXISTS idx_attendees_event_user;
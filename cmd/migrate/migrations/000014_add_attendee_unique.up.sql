@@ -0,0 +1,5 @@
+-- Keep the oldest RSVP of duplicates created before the constraint existed.
+DELETE FROM attendees
+WHERE id NOT IN (SELECT MIN(id) FROM attendees GROUP BY event_id, user_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attendees_event_user ON attendees (event_id, user_id);
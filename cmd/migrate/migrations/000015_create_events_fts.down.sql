@@ -0,0 +1,5 @@
+-- 000015_create_events_fts.down.sql
+DROP TRIGGER IF EXISTS events_fts_update;
+DROP TRIGGER IF EXISTS events_fts_delete;
+DROP TRIGGER IF EXISTS events_fts_insert;
+DROP TABLE IF EXISTS events_fts;
@@ -0,0 +1,9 @@
+-- 000016_add_event_location.down.sql
+DROP INDEX IF EXISTS idx_events_coordinates;
+ALTER TABLE events DROP COLUMN longitude;
+ALTER TABLE events DROP COLUMN latitude;
+ALTER TABLE events DROP COLUMN country;
+ALTER TABLE events DROP COLUMN postal_code;
+ALTER TABLE events DROP COLUMN region;
+ALTER TABLE events DROP COLUMN city;
+ALTER TABLE events DROP COLUMN street;
@@ -0,0 +1,10 @@
+ALTER TABLE events ADD COLUMN street TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN city TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN region TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN postal_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN country TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN latitude REAL;
+ALTER TABLE events ADD COLUMN longitude REAL;
+
+-- Nearby searches prefilter on a bounding box before computing distances.
+CREATE INDEX idx_events_coordinates ON events (latitude, longitude);
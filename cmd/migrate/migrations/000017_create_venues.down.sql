@@ -0,0 +1,10 @@
+-- 000017_create_venues.down.sql
+DROP INDEX IF EXISTS idx_events_venue_date;
+ALTER TABLE events DROP COLUMN capacity;
+ALTER TABLE events DROP COLUMN end_time;
+ALTER TABLE events DROP COLUMN start_time;
+ALTER TABLE events DROP COLUMN room_id;
+ALTER TABLE events DROP COLUMN venue_id;
+DROP TABLE IF EXISTS rooms;
+DROP INDEX IF EXISTS idx_venues_organization_id;
+DROP TABLE IF EXISTS venues;
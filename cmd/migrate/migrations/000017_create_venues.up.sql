@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS venues (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    organization_id INTEGER,
+    owner_id INTEGER,
+    name TEXT NOT NULL,
+    street TEXT NOT NULL DEFAULT '',
+    city TEXT NOT NULL DEFAULT '',
+    region TEXT NOT NULL DEFAULT '',
+    postal_code TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    capacity INTEGER CHECK (capacity > 0),
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE,
+    FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_venues_organization_id ON venues (organization_id);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    venue_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    capacity INTEGER CHECK (capacity > 0),
+    UNIQUE (venue_id, name),
+    FOREIGN KEY (venue_id) REFERENCES venues (id) ON DELETE CASCADE
+);
+
+ALTER TABLE events ADD COLUMN venue_id INTEGER;
+ALTER TABLE events ADD COLUMN room_id INTEGER;
+ALTER TABLE events ADD COLUMN start_time TEXT;
+ALTER TABLE events ADD COLUMN end_time TEXT;
+ALTER TABLE events ADD COLUMN capacity INTEGER CHECK (capacity > 0);
+
+-- Bookings are checked for overlaps per venue and day.
+CREATE INDEX IF NOT EXISTS idx_events_venue_date ON events (venue_id, date);
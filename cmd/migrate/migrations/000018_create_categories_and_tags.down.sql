@@ -0,0 +1,7 @@
+-- 000018_create_categories_and_tags.down.sql
+DROP INDEX IF EXISTS idx_events_category_id;
+ALTER TABLE events DROP COLUMN category_id;
+DROP INDEX IF EXISTS idx_event_tags_tag_id;
+DROP TABLE IF EXISTS event_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,4 @@
+-- 000019_create_event_files.down.sql
+DROP INDEX IF EXISTS idx_event_files_cover;
+DROP INDEX IF EXISTS idx_event_files_event_id;
+DROP TABLE IF EXISTS event_files;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS event_files (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('cover', 'attachment')),
+    blob_key TEXT NOT NULL UNIQUE,
+    thumbnail_key TEXT NOT NULL DEFAULT '',
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    uploaded_by INTEGER,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+    FOREIGN KEY (uploaded_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_files_event_id ON event_files (event_id);
+
+-- An event has at most one cover image.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_event_files_cover ON event_files (event_id) WHERE kind = 'cover';
@@ -0,0 +1,2 @@
+-- 000020_add_attendee_check_in.down.sql
+ALTER TABLE attendees DROP COLUMN checked_in_at;
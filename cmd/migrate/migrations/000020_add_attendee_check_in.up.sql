@@ -0,0 +1,2 @@
+-- When the ticket of the attendee was scanned at the door; NULL until then.
+ALTER TABLE attendees ADD COLUMN checked_in_at DATETIME;
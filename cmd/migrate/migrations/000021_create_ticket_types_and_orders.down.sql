@@ -0,0 +1,9 @@
+-- 000021_create_ticket_types_and_orders.down.sql
+DROP INDEX IF EXISTS idx_order_items_ticket_type_id;
+DROP INDEX IF EXISTS idx_order_items_order_id;
+DROP TABLE IF EXISTS order_items;
+DROP INDEX IF EXISTS idx_orders_pending;
+DROP INDEX IF EXISTS idx_orders_user_id;
+DROP INDEX IF EXISTS idx_orders_event_id;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS ticket_types;
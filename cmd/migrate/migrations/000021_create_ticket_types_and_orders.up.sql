@@ -0,0 +1,53 @@
+-- Prices and totals are in the minor unit of their currency, e.g. cents.
+CREATE TABLE IF NOT EXISTS ticket_types (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    price INTEGER NOT NULL CHECK (price >= 0),
+    currency TEXT NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    sale_starts_at DATETIME,
+    sale_ends_at DATETIME,
+    created_at DATETIME NOT NULL,
+    UNIQUE (event_id, name),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    user_id INTEGER,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'paid', 'refunded', 'expired')),
+    total INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    payment_id TEXT UNIQUE,
+    checkout_url TEXT NOT NULL DEFAULT '',
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+    paid_at DATETIME,
+    refunded_at DATETIME,
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_event_id ON orders (event_id);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders (user_id);
+-- Pending orders are expired once their reservation runs out.
+CREATE INDEX IF NOT EXISTS idx_orders_pending ON orders (expires_at) WHERE status = 'pending';
+
+-- Every item is one ticket for one user; attendee_id is the RSVP created
+-- when the order is paid.
+CREATE TABLE IF NOT EXISTS order_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL,
+    ticket_type_id INTEGER NOT NULL,
+    user_id INTEGER,
+    unit_price INTEGER NOT NULL,
+    attendee_id INTEGER,
+    FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE,
+    FOREIGN KEY (ticket_type_id) REFERENCES ticket_types (id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items (order_id);
+CREATE INDEX IF NOT EXISTS idx_order_items_ticket_type_id ON order_items (ticket_type_id);
@@ -0,0 +1,6 @@
+-- 000022_create_promo_codes.down.sql
+DROP INDEX IF EXISTS idx_orders_promo_code_id;
+ALTER TABLE order_items DROP COLUMN discount;
+ALTER TABLE orders DROP COLUMN discount;
+ALTER TABLE orders DROP COLUMN promo_code_id;
+DROP TABLE IF EXISTS promo_codes;
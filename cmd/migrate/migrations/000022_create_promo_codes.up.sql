@@ -0,0 +1,26 @@
+-- Promo codes discount the tickets of an event, or of one of its ticket
+-- types. amount is a percentage for percent discounts and an amount in the
+-- minor unit of currency for fixed ones.
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    ticket_type_id INTEGER,
+    code TEXT NOT NULL,
+    discount_type TEXT NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    currency TEXT,
+    max_uses INTEGER,
+    max_uses_per_user INTEGER,
+    starts_at DATETIME,
+    ends_at DATETIME,
+    created_at DATETIME NOT NULL,
+    UNIQUE (event_id, code),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+    FOREIGN KEY (ticket_type_id) REFERENCES ticket_types (id)
+);
+
+ALTER TABLE orders ADD COLUMN promo_code_id INTEGER;
+ALTER TABLE orders ADD COLUMN discount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN discount INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_orders_promo_code_id ON orders (promo_code_id);
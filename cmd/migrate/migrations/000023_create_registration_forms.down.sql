@@ -0,0 +1,6 @@
+-- 000023_create_registration_forms.down.sql
+ALTER TABLE order_items DROP COLUMN form_version;
+ALTER TABLE order_items DROP COLUMN answers;
+DROP INDEX IF EXISTS idx_registration_answers_user_id;
+DROP TABLE IF EXISTS registration_answers;
+DROP TABLE IF EXISTS registration_forms;
@@ -0,0 +1,32 @@
+-- Every change to a form that already has answers adds a version; questions
+-- is the JSON list of questions of that version.
+CREATE TABLE IF NOT EXISTS registration_forms (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    questions TEXT NOT NULL,
+    changed_by INTEGER,
+    updated_at DATETIME NOT NULL,
+    UNIQUE (event_id, version),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+);
+
+-- The answers of an attendee, a JSON object keyed by question, against the
+-- form version they were given for.
+CREATE TABLE IF NOT EXISTS registration_answers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    form_version INTEGER NOT NULL,
+    answers TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    UNIQUE (event_id, user_id),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_registration_answers_user_id ON registration_answers (user_id);
+
+-- Answers given with an order are kept on its items until it is paid.
+ALTER TABLE order_items ADD COLUMN answers TEXT;
+ALTER TABLE order_items ADD COLUMN form_version INTEGER;
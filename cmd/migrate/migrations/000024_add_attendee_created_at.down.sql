@@ -0,0 +1,2 @@
+-- 000024_add_attendee_created_at.down.sql
+ALTER TABLE attendees DROP COLUMN created_at;
@@ -0,0 +1,2 @@
+-- When the user registered; NULL for RSVPs made before it was recorded.
+ALTER TABLE attendees ADD COLUMN created_at DATETIME;
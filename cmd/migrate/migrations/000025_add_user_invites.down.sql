@@ -0,0 +1,3 @@
+-- 000025_add_user_invites.down.sql
+ALTER TABLE users DROP COLUMN invite_token_expires_at;
+ALTER TABLE users DROP COLUMN invite_token;
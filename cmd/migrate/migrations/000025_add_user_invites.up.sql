@@ -0,0 +1,4 @@
+-- Accounts created for people who were added to an event before signing
+-- up have no password until they accept the invitation sent to them.
+ALTER TABLE users ADD COLUMN invite_token TEXT;
+ALTER TABLE users ADD COLUMN invite_token_expires_at DATETIME;
@@ -0,0 +1,3 @@
+-- 000026_create_jobs_table.down.sql
+DROP INDEX IF EXISTS idx_jobs_status_run_at;
+DROP TABLE IF EXISTS jobs;
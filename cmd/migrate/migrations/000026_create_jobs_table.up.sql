@@ -0,0 +1,20 @@
+-- Work done outside of requests. Jobs wait as queued until run_at, are
+-- running while a worker holds them since locked_at, and end up succeeded
+-- or, once they ran out of attempts, dead. A job with a unique_key is only
+-- ever enqueued once, even after it finished.
+CREATE TABLE IF NOT EXISTS jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    unique_key TEXT UNIQUE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at DATETIME NOT NULL,
+    locked_at DATETIME,
+    last_error TEXT,
+    created_at DATETIME NOT NULL,
+    finished_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status_run_at ON jobs (status, run_at);
@@ -0,0 +1,3 @@
+-- 000027_create_event_reminders.down.sql
+ALTER TABLE users DROP COLUMN event_reminders;
+DROP TABLE IF EXISTS event_reminders;
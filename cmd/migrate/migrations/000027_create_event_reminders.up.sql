@@ -0,0 +1,13 @@
+-- Attendees are reminded of an event minutes_before it starts. queued_for is
+-- the start time the reminder was last queued for, so it is queued again
+-- when the event moves.
+CREATE TABLE IF NOT EXISTS event_reminders (
+    event_id INTEGER NOT NULL,
+    minutes_before INTEGER NOT NULL,
+    queued_for DATETIME,
+    PRIMARY KEY (event_id, minutes_before),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+);
+
+-- Users can opt out of reminders of the events they attend.
+ALTER TABLE users ADD COLUMN event_reminders INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+-- 000028_redact_audit_log_personal_data.down.sql
+-- The up migration changes nothing, so there is nothing to undo.
+SELECT 1;
@@ -0,0 +1,5 @@
+-- User entries used to keep names and email addresses. They are redacted
+-- when they are written now (see database.AuditEntry.SetChanges); older
+-- entries are left as they are, as the log is append-only. The migration is
+-- kept so databases that ran it stay at a known version.
+SELECT 1;
@@ -0,0 +1,3 @@
+-- 000029_redact_audit_log_order_answers.down.sql
+-- The up migration changes nothing, so there is nothing to undo.
+SELECT 1;
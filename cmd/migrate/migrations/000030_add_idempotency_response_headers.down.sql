@@ -0,0 +1,2 @@
+-- 000030_add_idempotency_response_headers.down.sql
+ALTER TABLE idempotency_keys DROP COLUMN response_headers;
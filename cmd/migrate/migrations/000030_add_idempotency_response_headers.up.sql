@@ -0,0 +1,3 @@
+-- Headers such as Location and ETag replayed with a stored response, as a
+-- JSON object of header names to values.
+ALTER TABLE idempotency_keys ADD COLUMN response_headers TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,8 @@
+-- 000031_free_email_of_deleted_users.down.sql
+-- Deleted accounts whose email was taken by a new account meanwhile keep
+-- their placeholder.
+UPDATE users
+SET email = deleted_email
+WHERE deleted_email IS NOT NULL AND deleted_email NOT IN (SELECT email FROM users);
+
+ALTER TABLE users DROP COLUMN deleted_email;
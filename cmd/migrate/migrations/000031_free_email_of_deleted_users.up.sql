@@ -0,0 +1,7 @@
+-- Deleted accounts give up their email, so it can sign up again while the
+-- account waits to be purged. It is kept here to restore the account.
+ALTER TABLE users ADD COLUMN deleted_email TEXT;
+
+UPDATE users
+SET deleted_email = email, email = 'deleted-' || id || '@deleted.invalid'
+WHERE deleted_at IS NOT NULL;
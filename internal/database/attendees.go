@@ -3,36 +3,84 @@ package database
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"encoding/json"
+	"errors"
+	"net/http"
 	"time"
 )
 
+// AttendeeModel is scoped to a tenant the same way as EventModel: attendees
+// are only visible through events of the model's organization.
 type AttendeeModel struct {
-	DB *sql.DB
+	DB    DBTX
+	OrgID int
 }
 
+var (
+	ErrAttendeeExists = errors.New("Attendee exists")
+	ErrNotCheckedIn   = conflictError("conflict", "Attendee is not checked in")
+)
+
 type Attendee struct {
 	ID      int `json:"id"`
 	UserId  int `json:"userId"`
 	EventId int `json:"eventId"`
+	// CheckedInAt is when the attendee's ticket was scanned at the door.
+	CheckedInAt *time.Time `json:"checkedInAt,omitempty"`
+	// CreatedAt is when the user registered; it is not known for RSVPs made
+	// before it was recorded.
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// AlreadyCheckedInError is returned when a ticket is scanned a second time.
+// CheckedInAt is added to the problem it is reported with.
+type AlreadyCheckedInError struct {
+	CheckedInAt time.Time `json:"checkedInAt"`
+}
+
+func (e *AlreadyCheckedInError) Error() string {
+	return "Ticket was already scanned at " + e.CheckedInAt.Format(time.RFC3339)
+}
+
+func (e *AlreadyCheckedInError) Status() int { return http.StatusConflict }
+
+func (e *AlreadyCheckedInError) Code() string { return "already_checked_in" }
+
+func (e *AlreadyCheckedInError) ProblemExtension() any { return e }
+
+// CheckInStats counts the attendees of an event who have arrived.
+type CheckInStats struct {
+	EventId       int        `json:"eventId"`
+	Attendees     int        `json:"attendees"`
+	CheckedIn     int        `json:"checkedIn"`
+	LastCheckInAt *time.Time `json:"lastCheckInAt,omitempty"`
 }
 
+// Insert adds an RSVP to an event of the tenant. It fails with
+// ErrAttendeeExists if the user already attends the event.
 func (m *AttendeeModel) Insert(attend *Attendee) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	now := time.Now().UTC()
 	stmt := `
-		INSERT INTO attendees (user_id, event_id)
-		VALUES ($1, $2)
-		RETURNING id;	
+		INSERT INTO attendees (user_id, event_id, created_at)
+		SELECT $1, e.id, $2 FROM events e
+		WHERE e.id = $3 AND ` + tenantFilter(4) + `
+		RETURNING id;
 	`
 
-	fmt.Println(attend.UserId, attend.EventId)
-
-	err := m.DB.QueryRowContext(ctx, stmt, attend.UserId, attend.EventId).Scan(&attend.ID)
+	err := m.DB.QueryRowContext(ctx, stmt, attend.UserId, now, attend.EventId, m.OrgID).Scan(&attend.ID)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEventNotFound
+		}
+		if isUniqueViolation(err) {
+			return ErrAttendeeExists
+		}
 		return err
 	}
+	attend.CreatedAt = &now
 	return nil
 }
 
@@ -41,10 +89,13 @@ func (m *AttendeeModel) GetByEventAndAttendee(eventId, userId int) (*Attendee, e
 	defer cancel()
 
 	query := `
-		SELECT * FROM attendees WHERE event_id=$1 AND user_id=$2
-	`
+		SELECT a.id, a.user_id, a.event_id, a.checked_in_at, a.created_at
+		FROM attendees a
+		JOIN events e ON e.id = a.event_id
+		WHERE a.event_id = $1 AND a.user_id = $2 AND ` + tenantFilter(3)
+
 	var attendee Attendee
-	err := m.DB.QueryRowContext(ctx, query, eventId, userId).Scan(&attendee.ID, &attendee.UserId, &attendee.EventId)
+	err := m.DB.QueryRowContext(ctx, query, eventId, userId, m.OrgID).Scan(&attendee.ID, &attendee.UserId, &attendee.EventId, &attendee.CheckedInAt, &attendee.CreatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -63,10 +114,10 @@ func (m *AttendeeModel) GetAttendeesByEvent(id int) ([]*User, error) {
 	SELECT u.id, u.name, u.email
 	FROM users u
 	JOIN attendees a ON u.id = a.user_id
-	WHERE a.event_id = $1
-	`
+	JOIN events e ON e.id = a.event_id
+	WHERE a.event_id = $1 AND u.deleted_at IS NULL AND ` + tenantFilter(2)
 
-	rows, err := m.DB.QueryContext(ctx, query, id)
+	rows, err := m.DB.QueryContext(ctx, query, id, m.OrgID)
 	if err != nil {
 		return nil, err
 	}
@@ -84,18 +135,291 @@ func (m *AttendeeModel) GetAttendeesByEvent(id int) ([]*User, error) {
 	return users, nil
 }
 
+// Delete removes an RSVP to an event of the tenant together with the
+// registration answers of the attendee.
 func (m *AttendeeModel) Delete(eventId, userId int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"attendees", "registration_answers"} {
+		stmt := `
+			DELETE FROM ` + table + `
+			WHERE event_id = $1 AND user_id = $2
+			AND event_id IN (SELECT e.id FROM events e WHERE ` + tenantFilter(3) + `);
+		`
+		if _, err := tx.ExecContext(ctx, stmt, eventId, userId, m.OrgID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CountByEvent returns how many users attend an event of the tenant.
+func (m *AttendeeModel) CountByEvent(eventId int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*) FROM attendees a
+		JOIN events e ON e.id = a.event_id
+		WHERE a.event_id = $1 AND ` + tenantFilter(2)
+
+	var n int
+	err := m.DB.QueryRowContext(ctx, query, eventId, m.OrgID).Scan(&n)
+	return n, err
+}
+
+// Get returns an RSVP to an event of the tenant by id, or nil if there is
+// none.
+func (m *AttendeeModel) Get(id int) (*Attendee, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT a.id, a.user_id, a.event_id, a.checked_in_at, a.created_at
+		FROM attendees a
+		JOIN events e ON e.id = a.event_id
+		WHERE a.id = $1 AND ` + tenantFilter(2)
+
+	var attendee Attendee
+	err := m.DB.QueryRowContext(ctx, query, id, m.OrgID).Scan(&attendee.ID, &attendee.UserId, &attendee.EventId, &attendee.CheckedInAt, &attendee.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attendee, nil
+}
+
+// GetCheckInsByUser lists the RSVPs of a user to events of the tenant that
+// were checked in, earliest first.
+func (m *AttendeeModel) GetCheckInsByUser(userId int) ([]*Attendee, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT a.id, a.user_id, a.event_id, a.checked_in_at, a.created_at
+		FROM attendees a
+		JOIN events e ON e.id = a.event_id
+		WHERE a.user_id = $1 AND a.checked_in_at IS NOT NULL AND ` + tenantFilter(2) + `
+		ORDER BY a.checked_in_at`
+
+	rows, err := m.DB.QueryContext(ctx, query, userId, m.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendees := []*Attendee{}
+	for rows.Next() {
+		var attendee Attendee
+		if err := rows.Scan(&attendee.ID, &attendee.UserId, &attendee.EventId, &attendee.CheckedInAt, &attendee.CreatedAt); err != nil {
+			return nil, err
+		}
+		attendees = append(attendees, &attendee)
+	}
+	return attendees, rows.Err()
+}
+
+// CheckIn records that the attendee arrived at the given time. It fails with
+// an *AlreadyCheckedInError if they were checked in before, including by a
+// concurrent scan of the same ticket.
+func (m *AttendeeModel) CheckIn(attendee *Attendee, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
 	stmt := `
-		DELETE FROM attendees
-		WHERE event_id = $1 AND user_id = $2;
-	`
+		UPDATE attendees SET checked_in_at = $1
+		WHERE id = $2 AND checked_in_at IS NULL
+		AND event_id IN (SELECT e.id FROM events e WHERE ` + tenantFilter(3) + `)`
+
+	res, err := m.DB.ExecContext(ctx, stmt, at, attendee.ID, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		current, err := m.Get(attendee.ID)
+		if err != nil {
+			return err
+		}
+		if current == nil || current.CheckedInAt == nil {
+			return ErrNoRowsAffected
+		}
+		return &AlreadyCheckedInError{CheckedInAt: *current.CheckedInAt}
+	}
+	attendee.CheckedInAt = &at
+	return nil
+}
+
+// UndoCheckIn clears the check-in of an attendee, e.g. after a ticket was
+// scanned by mistake. It fails with ErrNotCheckedIn if there is none.
+func (m *AttendeeModel) UndoCheckIn(attendee *Attendee) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE attendees SET checked_in_at = NULL
+		WHERE id = $1 AND checked_in_at IS NOT NULL
+		AND event_id IN (SELECT e.id FROM events e WHERE ` + tenantFilter(2) + `)`
 
-	_, err := m.DB.ExecContext(ctx, stmt, eventId, userId)
+	res, err := m.DB.ExecContext(ctx, stmt, attendee.ID, m.OrgID)
 	if err != nil {
 		return err
 	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrNotCheckedIn
+	}
+	attendee.CheckedInAt = nil
 	return nil
 }
+
+// CheckInStats counts the attendees and check-ins of an event of the
+// tenant.
+func (m *AttendeeModel) CheckInStats(eventId int) (*CheckInStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*), COUNT(a.checked_in_at)
+		FROM attendees a
+		JOIN events e ON e.id = a.event_id
+		WHERE a.event_id = $1 AND ` + tenantFilter(2)
+
+	stats := CheckInStats{EventId: eventId}
+	err := m.DB.QueryRowContext(ctx, query, eventId, m.OrgID).Scan(&stats.Attendees, &stats.CheckedIn)
+	if err != nil {
+		return nil, err
+	}
+	if stats.CheckedIn == 0 {
+		return &stats, nil
+	}
+
+	query = `
+		SELECT a.checked_in_at
+		FROM attendees a
+		JOIN events e ON e.id = a.event_id
+		WHERE a.event_id = $1 AND a.checked_in_at IS NOT NULL AND ` + tenantFilter(2) + `
+		ORDER BY a.checked_in_at DESC
+		LIMIT 1`
+	if err := m.DB.QueryRowContext(ctx, query, eventId, m.OrgID).Scan(&stats.LastCheckInAt); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// RSVP statuses of attendee records.
+const (
+	RSVPAttending      = "attending"
+	RSVPPendingPayment = "pending_payment"
+)
+
+// AttendeeRecord is a row of the attendee list of an event: an attendee, or
+// the holder of a ticket of a pending order, with their registration
+// answers.
+type AttendeeRecord struct {
+	UserId       int
+	Name         string
+	Email        string
+	Status       string
+	RegisteredAt *time.Time
+	CheckedInAt  *time.Time
+	FormVersion  *int
+	Answers      Answers
+	// key orders the records of a status for paging.
+	key int
+}
+
+// exportBatchSize is how many records EachRecord reads at a time.
+const exportBatchSize = 500
+
+// attendeeRecords and pendingRecords select a batch of attendee records.
+// They expect the event, the key to continue after and the tenant as the
+// first parameters, then for pendingRecords the current time, and the batch
+// size last.
+var attendeeRecords = `
+	SELECT a.id, u.id, u.name, u.email, a.created_at, a.checked_in_at, ra.form_version, ra.answers
+	FROM attendees a
+	JOIN events e ON e.id = a.event_id
+	JOIN users u ON u.id = a.user_id
+	LEFT JOIN registration_answers ra ON ra.event_id = a.event_id AND ra.user_id = a.user_id
+	WHERE a.event_id = $1 AND a.id > $2 AND u.deleted_at IS NULL AND ` + tenantFilter(3) + `
+	ORDER BY a.id
+	LIMIT $4`
+
+var pendingRecords = `
+	SELECT i.id, u.id, u.name, u.email, o.created_at, NULL, i.form_version, i.answers
+	FROM order_items i
+	JOIN orders o ON o.id = i.order_id
+	JOIN events e ON e.id = o.event_id
+	JOIN users u ON u.id = i.user_id
+	WHERE o.event_id = $1 AND i.id > $2 AND u.deleted_at IS NULL AND ` + tenantFilter(3) + `
+	AND o.status = '` + OrderPending + `' AND o.expires_at > $4
+	ORDER BY i.id
+	LIMIT $5`
+
+// EachRecord calls fn with every attendee of an event of the tenant in the
+// order they registered, followed by the holders of tickets of pending
+// orders. Records are read in batches, so large lists are neither held in
+// memory nor keep the database locked while fn runs. It stops at the first
+// error fn returns.
+func (m *AttendeeModel) EachRecord(eventId int, fn func(*AttendeeRecord) error) error {
+	now := time.Now().UTC()
+	for _, status := range []string{RSVPAttending, RSVPPendingPayment} {
+		after := 0
+		for {
+			records, err := m.recordBatch(status, eventId, after, now)
+			if err != nil {
+				return err
+			}
+			for _, r := range records {
+				if err := fn(r); err != nil {
+					return err
+				}
+			}
+			if len(records) < exportBatchSize {
+				break
+			}
+			after = records[len(records)-1].key
+		}
+	}
+	return nil
+}
+
+func (m *AttendeeModel) recordBatch(status string, eventId, after int, now time.Time) ([]*AttendeeRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query, args := attendeeRecords, []any{eventId, after, m.OrgID, exportBatchSize}
+	if status == RSVPPendingPayment {
+		query, args = pendingRecords, []any{eventId, after, m.OrgID, now, exportBatchSize}
+	}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*AttendeeRecord{}
+	for rows.Next() {
+		r := AttendeeRecord{Status: status}
+		var answers sql.NullString
+		err := rows.Scan(&r.key, &r.UserId, &r.Name, &r.Email, &r.RegisteredAt, &r.CheckedInAt, &r.FormVersion, &answers)
+		if err != nil {
+			return nil, err
+		}
+		if answers.Valid {
+			if err := json.Unmarshal([]byte(answers.String), &r.Answers); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, &r)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AuditLogModel struct {
+	DB DBTX
+}
+
+// AuditEntry records a single change. Before and After only hold the fields
+// that changed, as JSON objects; Before is empty for creations and After for
+// deletions. ActorId is nil for changes made by the system or the CLI.
+type AuditEntry struct {
+	ID           int             `json:"id"`
+	ActorId      *int            `json:"actorId,omitempty"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resourceType"`
+	ResourceId   int             `json:"resourceId"`
+	Before       json.RawMessage `json:"before,omitempty" swaggertype:"object"`
+	After        json.RawMessage `json:"after,omitempty" swaggertype:"object"`
+	RequestId    string          `json:"requestId,omitempty"`
+	IP           string          `json:"ip,omitempty"`
+	CreatedAt    time.Time       `json:"createdAt"`
+}
+
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	// AuditAnonymize records an erasure. Its entries never carry the erased
+	// data.
+	AuditAnonymize = "anonymize"
+	// AuditPurge records that a deleted row was removed for good once the
+	// retention window ended.
+	AuditPurge = "purge"
+)
+
+const (
+	ResourceUser             = "user"
+	ResourceEvent            = "event"
+	ResourceAttendee         = "attendee"
+	ResourceVenue            = "venue"
+	ResourceRoom             = "room"
+	ResourceCategory         = "category"
+	ResourceTag              = "tag"
+	ResourceFile             = "file"
+	ResourceTicketType       = "ticket_type"
+	ResourceOrder            = "order"
+	ResourcePromoCode        = "promo_code"
+	ResourceRegistrationForm = "registration_form"
+	ResourceJob              = "job"
+	ResourceEventReminders   = "event_reminders"
+	ResourceEventOrganizer   = "event_organizer"
+)
+
+// AuditFilter narrows down audit log queries; zero values match everything.
+type AuditFilter struct {
+	ActorId      int
+	Action       string
+	ResourceType string
+	ResourceId   int
+	From         time.Time
+	To           time.Time
+}
+
+// Redacted replaces personal data in audit entries.
+const Redacted = "[redacted]"
+
+// personalFields are the fields of user entries that hold personal data.
+// The audit log can't be changed, so it only records that they changed and
+// never their values. Entries written before they were redacted are left as
+// they are.
+var personalFields = []string{"email", "name", "pendingEmail", "avatarUrl", "bio"}
+
+// redact replaces the personal data in the fields of an entry of the given
+// resource type: the personal fields of users and the registration answers
+// on the items of orders.
+func redact(resourceType string, fields map[string]any) {
+	switch resourceType {
+	case ResourceUser:
+		for _, k := range personalFields {
+			if _, ok := fields[k]; ok {
+				fields[k] = Redacted
+			}
+		}
+	case ResourceOrder:
+		items, _ := fields["items"].([]any)
+		for _, item := range items {
+			if item, ok := item.(map[string]any); ok && item["answers"] != nil {
+				item["answers"] = Redacted
+			}
+		}
+	}
+}
+
+// SetChanges stores the fields that differ between before and after, with
+// personal data redacted. Either may be nil.
+func (e *AuditEntry) SetChanges(before, after any) error {
+	b, err := toJSONObject(before)
+	if err != nil {
+		return err
+	}
+	a, err := toJSONObject(after)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range b {
+		if w, ok := a[k]; ok && reflect.DeepEqual(v, w) {
+			delete(b, k)
+			delete(a, k)
+		}
+	}
+	redact(e.ResourceType, b)
+	redact(e.ResourceType, a)
+
+	if e.Before, err = marshalNonEmpty(b); err != nil {
+		return err
+	}
+	e.After, err = marshalNonEmpty(a)
+	return err
+}
+
+func toJSONObject(v any) (map[string]any, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	return m, json.Unmarshal(data, &m)
+}
+
+func marshalNonEmpty(m map[string]any) (json.RawMessage, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Insert appends an entry. The table is append-only; entries can never be
+// changed or removed.
+func (m *AuditLogModel) Insert(entry *AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	entry.CreatedAt = time.Now().UTC()
+	stmt := `
+		INSERT INTO audit_log (actor_id, action, resource_type, resource_id, before_data, after_data, request_id, ip, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	return m.DB.QueryRowContext(ctx, stmt, entry.ActorId, entry.Action, entry.ResourceType, entry.ResourceId,
+		nullableJSON(entry.Before), nullableJSON(entry.After), entry.RequestId, entry.IP, entry.CreatedAt).Scan(&entry.ID)
+}
+
+func nullableJSON(data json.RawMessage) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+func (f AuditFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	if f.ActorId != 0 {
+		add("actor_id = ?", f.ActorId)
+	}
+	if f.Action != "" {
+		add("action = ?", f.Action)
+	}
+	if f.ResourceType != "" {
+		add("resource_type = ?", f.ResourceType)
+	}
+	if f.ResourceId != 0 {
+		add("resource_id = ?", f.ResourceId)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= ?", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		add("created_at < ?", f.To.UTC())
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Query returns a page of entries matching filter, newest first, and the
+// total number of matching entries. A limit of 0 returns every entry.
+func (m *AuditLogModel) Query(filter AuditFilter, limit, offset int) ([]*AuditEntry, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	where, args := filter.where()
+
+	var total int
+	if err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, actor_id, action, resource_type, resource_id, COALESCE(before_data, ''), COALESCE(after_data, ''), request_id, ip, created_at
+		FROM audit_log` + where + `
+		ORDER BY id DESC`
+	if limit > 0 {
+		args = append(args, limit, offset)
+		query += ` LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after string
+		if err := rows.Scan(&entry.ID, &entry.ActorId, &entry.Action, &entry.ResourceType, &entry.ResourceId, &before, &after, &entry.RequestId, &entry.IP, &entry.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if before != "" {
+			entry.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			entry.After = json.RawMessage(after)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, total, rows.Err()
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// CategoryModel manages the site-wide list of event categories. Categories
+// are shared by every tenant and managed by admins.
+type CategoryModel struct {
+	DB DBTX
+}
+
+type Category struct {
+	ID        int       `json:"id"`
+	Slug      string    `json:"slug" binding:"required,max=50,slug"`
+	Name      string    `json:"name" binding:"required,min=2,max=100"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var ErrCategoryNotFound = notFoundError("category not found")
+var ErrCategoryInUse = conflictError("conflict", "Events are filed under this category; move or delete them first")
+
+func (m *CategoryModel) Insert(category *Category) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	category.CreatedAt = time.Now().UTC()
+	stmt := `INSERT INTO categories (slug, name, created_at) VALUES ($1, $2, $3) RETURNING id`
+	return m.DB.QueryRowContext(ctx, stmt, category.Slug, category.Name, category.CreatedAt).Scan(&category.ID)
+}
+
+func (m *CategoryModel) Get(id int) (*Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var category Category
+	err := m.DB.QueryRowContext(ctx, `SELECT id, slug, name, created_at FROM categories WHERE id = $1`, id).
+		Scan(&category.ID, &category.Slug, &category.Name, &category.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (m *CategoryModel) GetAll() ([]*Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT id, slug, name, created_at FROM categories ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*Category{}
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(&category.ID, &category.Slug, &category.Name, &category.CreatedAt); err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+	return categories, rows.Err()
+}
+
+func (m *CategoryModel) Update(category *Category) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `UPDATE categories SET slug = $1, name = $2 WHERE id = $3`, category.Slug, category.Name, category.ID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// Delete removes a category. It fails with ErrCategoryInUse while events,
+// including deleted ones that have not been purged yet, are filed under it.
+func (m *CategoryModel) Delete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var used bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM events WHERE category_id = $1)`, id).Scan(&used); err != nil {
+		return err
+	}
+	if used {
+		return ErrCategoryInUse
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM categories WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrCategoryNotFound
+	}
+	return tx.Commit()
+}
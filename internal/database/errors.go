@@ -0,0 +1,32 @@
+package database
+
+import "net/http"
+
+// statusError is an error clients can cause, such as asking for a record
+// that doesn't exist. It carries the HTTP status and problem code it is
+// reported with; its message is the detail of the problem.
+type statusError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *statusError) Error() string { return e.msg }
+
+// Status is the HTTP status the error is reported with.
+func (e *statusError) Status() int { return e.status }
+
+// Code is the problem code the error is reported with.
+func (e *statusError) Code() string { return e.code }
+
+func notFoundError(msg string) error {
+	return &statusError{status: http.StatusNotFound, code: "not_found", msg: msg}
+}
+
+func conflictError(code, msg string) error {
+	return &statusError{status: http.StatusConflict, code: code, msg: msg}
+}
+
+func preconditionFailedError(msg string) error {
+	return &statusError{status: http.StatusPreconditionFailed, code: "precondition_failed", msg: msg}
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+)
+
+// Booking is the time an event takes up at a venue. Empty times mean the
+// whole day; an empty room means the whole venue.
+type Booking struct {
+	EventId   int    `json:"eventId"`
+	RoomId    *int   `json:"roomId,omitempty"`
+	Date      string `json:"date"`
+	StartTime string `json:"startTime,omitempty"`
+	EndTime   string `json:"endTime,omitempty"`
+}
+
+// BookingConflictError is returned when an event would be booked over other
+// events. Conflicts lists the bookings of the events the user saving the
+// event may see; Hidden counts those of the other events. Both are added to
+// the problem it is reported with.
+type BookingConflictError struct {
+	Conflicts []Booking `json:"conflicts,omitempty"`
+	Hidden    int       `json:"hiddenConflicts,omitempty"`
+}
+
+func (e *BookingConflictError) Error() string {
+	return "Venue is already booked at that time"
+}
+
+func (e *BookingConflictError) Status() int { return http.StatusConflict }
+
+func (e *BookingConflictError) Code() string { return "booking_conflict" }
+
+func (e *BookingConflictError) ProblemExtension() any { return e }
+
+// Overlapping lists the bookings of other events of the tenant that overlap
+// the booking of event: events in the same room, or anywhere in the venue
+// when either of them books the whole venue, on the same date at overlapping
+// hours. Cancelled and archived events no longer hold their booking. Only
+// bookings of events visible to viewerId, as in listings, are returned; the
+// others are counted in hidden.
+func (m *EventModel) Overlapping(event *Event, viewerId int) (bookings []Booking, hidden int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if event.VenueId == nil {
+		return nil, 0, nil
+	}
+	start, end := event.StartTime, event.EndTime
+	if start == "" {
+		start, end = "00:00", "24:00"
+	}
+
+	query := `
+		SELECT e.id, e.room_id, date(e.date), COALESCE(e.start_time, ''), COALESCE(e.end_time, ''), ` + visibleTo(1) + `
+		FROM events e
+		WHERE e.venue_id = $2 AND e.id <> $3 AND date(e.date) = date($4)
+		AND ($5 IS NULL OR e.room_id IS NULL OR e.room_id = $5)
+		AND COALESCE(e.end_time, '24:00') > $6 AND COALESCE(e.start_time, '00:00') < $7
+		AND e.status NOT IN ('` + StatusCancelled + `', '` + StatusArchived + `')
+		AND ` + tenantFilter(8) + `
+		ORDER BY COALESCE(e.start_time, '00:00'), e.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, viewerId, *event.VenueId, event.Id, event.Date, event.RoomId, start, end, m.OrgID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	bookings = []Booking{}
+	for rows.Next() {
+		var b Booking
+		var visible bool
+		if err := rows.Scan(&b.EventId, &b.RoomId, &b.Date, &b.StartTime, &b.EndTime, &visible); err != nil {
+			return nil, 0, err
+		}
+		if visible {
+			bookings = append(bookings, b)
+		} else {
+			hidden++
+		}
+	}
+	return bookings, hidden, rows.Err()
+}
+
+// Capacity returns how many attendees an event of the tenant may have: its
+// own capacity, or else that of its room, or else that of its venue. It
+// returns nil when there is no limit.
+func (m *EventModel) Capacity(id int) (*int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT COALESCE(e.capacity, r.capacity, v.capacity)
+		FROM events e
+		LEFT JOIN rooms r ON r.id = e.room_id
+		LEFT JOIN venues v ON v.id = e.venue_id
+		WHERE e.id = $1 AND ` + tenantFilter(2)
+
+	var capacity *int
+	err := m.DB.QueryRowContext(ctx, query, id, m.OrgID).Scan(&capacity)
+	if err == sql.ErrNoRows {
+		return nil, ErrEventNotFound
+	}
+	return capacity, err
+}
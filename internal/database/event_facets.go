@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"strconv"
+)
+
+// EventFilter narrows event listings. Category is the slug of a category;
+// events must carry every one of Tags.
+type EventFilter struct {
+	Category string
+	Tags     []string
+}
+
+// EventFacets count the events of a listing per category and per tag, so
+// clients can show how many results picking one would leave.
+type EventFacets struct {
+	Categories []*CategoryCount `json:"categories"`
+	Tags       []*TagCount      `json:"tags"`
+}
+
+// CategoryCount is a category with the number of events filed under it.
+type CategoryCount struct {
+	ID    int    `json:"id"`
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// maxTagFacets caps the tag facet to the most used tags.
+const maxTagFacets = 50
+
+// conditions returns the SQL conditions of the filter, each starting with
+// AND. param adds a query parameter and returns its placeholder.
+func (f EventFilter) conditions(param func(any) string, withCategory bool) string {
+	cond := ""
+	if withCategory && f.Category != "" {
+		cond += ` AND e.category_id = (SELECT c.id FROM categories c WHERE c.slug = ` + param(f.Category) + `)`
+	}
+	for _, tag := range NormalizeTags(f.Tags) {
+		cond += ` AND EXISTS (SELECT 1 FROM event_tags ft JOIN tags t ON t.id = ft.tag_id WHERE ft.event_id = e.id AND t.name = ` + param(tag) + `)`
+	}
+	return cond
+}
+
+// params returns the argument list of a query starting with args, and a
+// function adding to it for EventFilter.conditions.
+func params(args ...any) (*[]any, func(any) string) {
+	return &args, func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+}
+
+// GetAll lists the events of the tenant that viewerId may see and that match
+// the filter.
+func (m *EventModel) GetAll(filter EventFilter, viewerId int) ([]*Event, error) {
+	args, param := params(m.OrgID, viewerId)
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events e
+		WHERE ` + tenantFilter(1) + ` AND ` + visibleTo(2) + filter.conditions(param, true)
+
+	return m.queryEvents(query, *args...)
+}
+
+// Facets counts the events GetAll would list per category and per tag. The
+// category counts leave out the category filter, so they tell how many
+// events picking another category would list; the tag counts apply the whole
+// filter. Only the most used tags are counted.
+func (m *EventModel) Facets(filter EventFilter, viewerId int) (*EventFacets, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	facets := &EventFacets{Categories: []*CategoryCount{}, Tags: []*TagCount{}}
+
+	args, param := params(m.OrgID, viewerId)
+	query := `
+		SELECT c.id, c.slug, c.name, COUNT(*) AS n
+		FROM events e
+		JOIN categories c ON c.id = e.category_id
+		WHERE ` + tenantFilter(1) + ` AND ` + visibleTo(2) + filter.conditions(param, false) + `
+		GROUP BY c.id
+		ORDER BY n DESC, c.name`
+
+	rows, err := m.DB.QueryContext(ctx, query, *args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var category CategoryCount
+		if err := rows.Scan(&category.ID, &category.Slug, &category.Name, &category.Count); err != nil {
+			return nil, err
+		}
+		facets.Categories = append(facets.Categories, &category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	args, param = params(m.OrgID, viewerId)
+	query = `
+		SELECT t.name, COUNT(*) AS n
+		FROM events e
+		JOIN event_tags et ON et.event_id = e.id
+		JOIN tags t ON t.id = et.tag_id
+		WHERE ` + tenantFilter(1) + ` AND ` + visibleTo(2) + filter.conditions(param, true) + `
+		GROUP BY t.id
+		ORDER BY n DESC, t.name
+		LIMIT ` + param(maxTagFacets)
+
+	rows, err = m.DB.QueryContext(ctx, query, *args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		facets.Tags = append(facets.Tags, &tag)
+	}
+	return facets, rows.Err()
+}
+
+// EventListing is an event listing with its facet counts.
+type EventListing struct {
+	Events []*Event     `json:"events"`
+	Facets *EventFacets `json:"facets"`
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// EventFileModel keeps track of the files uploaded to events; the files
+// themselves are in a storage.BlobStore. Its queries are not scoped to a
+// tenant: callers look up the event through EventModel first.
+type EventFileModel struct {
+	DB DBTX
+}
+
+// EventFile is a cover image or an attachment of an event. URL and
+// ThumbnailURL are signed download links filled in by the API; images get a
+// thumbnail.
+type EventFile struct {
+	ID           int       `json:"id"`
+	EventId      int       `json:"eventId"`
+	Kind         string    `json:"kind" enums:"cover,attachment"`
+	Key          string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"contentType"`
+	Size         int64     `json:"size"`
+	UploadedBy   *int      `json:"uploadedBy,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnailUrl,omitempty"`
+}
+
+const (
+	FileCover      = "cover"
+	FileAttachment = "attachment"
+)
+
+var ErrFileNotFound = notFoundError("file not found")
+
+// Keys returns the blob keys of the file.
+func (f *EventFile) Keys() []string {
+	if f.ThumbnailKey == "" {
+		return []string{f.Key}
+	}
+	return []string{f.Key, f.ThumbnailKey}
+}
+
+const eventFileColumns = `id, event_id, kind, blob_key, thumbnail_key, filename, content_type, size, uploaded_by, created_at`
+
+func scanEventFile(row rowScanner, file *EventFile) error {
+	return row.Scan(&file.ID, &file.EventId, &file.Kind, &file.Key, &file.ThumbnailKey, &file.Filename, &file.ContentType, &file.Size, &file.UploadedBy, &file.CreatedAt)
+}
+
+func (m *EventFileModel) queryFiles(query string, args ...any) ([]*EventFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []*EventFile{}
+	for rows.Next() {
+		var file EventFile
+		if err := scanEventFile(rows, &file); err != nil {
+			return nil, err
+		}
+		files = append(files, &file)
+	}
+	return files, rows.Err()
+}
+
+func (m *EventFileModel) Insert(file *EventFile) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	file.CreatedAt = time.Now().UTC()
+	stmt := `
+		INSERT INTO event_files (event_id, kind, blob_key, thumbnail_key, filename, content_type, size, uploaded_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`
+
+	return m.DB.QueryRowContext(ctx, stmt, file.EventId, file.Kind, file.Key, file.ThumbnailKey, file.Filename, file.ContentType, file.Size,
+		file.UploadedBy, file.CreatedAt).Scan(&file.ID)
+}
+
+// Get returns any file by id, or ErrFileNotFound.
+func (m *EventFileModel) Get(id int) (*EventFile, error) {
+	files, err := m.queryFiles(`SELECT `+eventFileColumns+` FROM event_files WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrFileNotFound
+	}
+	return files[0], nil
+}
+
+// GetForEvent returns a file of the given kind of an event, or
+// ErrFileNotFound.
+func (m *EventFileModel) GetForEvent(eventId, id int, kind string) (*EventFile, error) {
+	files, err := m.queryFiles(`SELECT `+eventFileColumns+` FROM event_files WHERE id = $1 AND event_id = $2 AND kind = $3`, id, eventId, kind)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrFileNotFound
+	}
+	return files[0], nil
+}
+
+// GetCover returns the cover image of an event, or ErrFileNotFound.
+func (m *EventFileModel) GetCover(eventId int) (*EventFile, error) {
+	files, err := m.queryFiles(`SELECT `+eventFileColumns+` FROM event_files WHERE event_id = $1 AND kind = $2`, eventId, FileCover)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrFileNotFound
+	}
+	return files[0], nil
+}
+
+// GetAttachments lists the attachments of an event, oldest first.
+func (m *EventFileModel) GetAttachments(eventId int) ([]*EventFile, error) {
+	return m.queryFiles(`SELECT `+eventFileColumns+` FROM event_files WHERE event_id = $1 AND kind = $2 ORDER BY id`, eventId, FileAttachment)
+}
+
+// GetByUploader lists the files a user uploaded.
+func (m *EventFileModel) GetByUploader(userId int) ([]*EventFile, error) {
+	return m.queryFiles(`SELECT `+eventFileColumns+` FROM event_files WHERE uploaded_by = $1 ORDER BY id`, userId)
+}
+
+// Delete removes the record of a file; its blobs are left to the caller.
+func (m *EventFileModel) Delete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM event_files WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+// DeleteOrphaned removes the records of files whose event has been purged
+// and returns them, so their blobs can be deleted too.
+func (m *EventFileModel) DeleteOrphaned() ([]*EventFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	orphaned := `SELECT f.id FROM event_files f WHERE NOT EXISTS (SELECT 1 FROM events e WHERE e.id = f.event_id)`
+	files, err := (&EventFileModel{DB: tx}).queryFiles(`SELECT ` + eventFileColumns + ` FROM event_files WHERE id IN (` + orphaned + `)`)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return files, nil
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM event_files WHERE id IN (`+orphaned+`)`); err != nil {
+		return nil, err
+	}
+	return files, tx.Commit()
+}
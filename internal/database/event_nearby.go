@@ -0,0 +1,60 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/LeeDat03/gin-event-app/internal/geo"
+)
+
+// NearbyEvent is an event found by a nearby search, with its distance in
+// kilometres from the search centre.
+type NearbyEvent struct {
+	Event
+	Distance float64 `json:"distance"`
+}
+
+// Nearby lists the events of the tenant that viewerId may see within
+// radiusKm of center, nearest first. Events without coordinates are never
+// returned. Candidates are read through a bounding box around the circle and
+// the exact distance is computed for each of them.
+func (m *EventModel) Nearby(center geo.Point, radiusKm float64, limit, offset, viewerId int) ([]*NearbyEvent, error) {
+	box := geo.BoundingBox(center, radiusKm)
+
+	lngFilter := `e.longitude BETWEEN $3 AND $4`
+	if box.CrossesAntimeridian() {
+		lngFilter = `(e.longitude >= $3 OR e.longitude <= $4)`
+	}
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events e
+		WHERE e.latitude BETWEEN $1 AND $2 AND ` + lngFilter + `
+		AND ` + tenantFilter(5) + ` AND ` + visibleTo(6)
+
+	candidates, err := m.queryEvents(query, box.MinLat, box.MaxLat, box.MinLng, box.MaxLng, m.OrgID, viewerId)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*NearbyEvent{}
+	for _, event := range candidates {
+		d := geo.Distance(center, geo.Point{Lat: *event.Latitude, Lng: *event.Longitude})
+		if d <= radiusKm {
+			results = append(results, &NearbyEvent{Event: *event, Distance: d})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].Id < results[j].Id
+	})
+
+	if offset >= len(results) {
+		return []*NearbyEvent{}, nil
+	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
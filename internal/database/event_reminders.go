@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// EventReminderModel is scoped to a tenant the same way as EventModel.
+type EventReminderModel struct {
+	DB    DBTX
+	OrgID int
+}
+
+// MaxReminderMinutes is how long before its start an event can be reminded
+// of at most: a week.
+const MaxReminderMinutes = 7 * 24 * 60
+
+// EventReminder reminds the attendees of an event MinutesBefore it starts.
+// StartsAt is when the event starts and QueuedFor the start the reminder was
+// last queued for; the reminder is due again when they differ.
+type EventReminder struct {
+	EventId       int
+	MinutesBefore int
+	StartsAt      time.Time
+	QueuedFor     *time.Time
+}
+
+// SendAt is when the reminder is due.
+func (r *EventReminder) SendAt() time.Time {
+	return r.StartsAt.Add(-time.Duration(r.MinutesBefore) * time.Minute)
+}
+
+// EventStart returns when an event on date starts: at startTime (15:04) if
+// it is set and at midnight otherwise. Events have no time zone of their
+// own, so both are taken as UTC.
+func EventStart(date, startTime string) (time.Time, error) {
+	if len(date) > len("2006-01-02") {
+		date = date[:len("2006-01-02")]
+	}
+	if startTime == "" {
+		return time.Parse("2006-01-02", date)
+	}
+	return time.Parse("2006-01-02 15:04", date+" "+startTime)
+}
+
+// Get returns the minutes before the start of an event of the tenant its
+// attendees are reminded at, earliest reminder first.
+func (m *EventReminderModel) Get(eventId int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT r.minutes_before
+		FROM event_reminders r
+		JOIN events e ON e.id = r.event_id
+		WHERE r.event_id = $1 AND ` + tenantFilter(2) + `
+		ORDER BY r.minutes_before DESC`
+	rows, err := m.DB.QueryContext(ctx, query, eventId, m.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	minutes := []int{}
+	for rows.Next() {
+		var n int
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		minutes = append(minutes, n)
+	}
+	return minutes, rows.Err()
+}
+
+// Set replaces the reminders of an event of the tenant. Reminders that are
+// kept remember what they were queued for, so setting them again doesn't
+// send them twice. It fails with ErrEventNotFound for events of other
+// tenants.
+func (m *EventReminderModel) Set(eventId int, minutes []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var found bool
+	query := `SELECT EXISTS (SELECT 1 FROM events e WHERE e.id = $1 AND ` + tenantFilter(2) + `)`
+	if err := tx.QueryRowContext(ctx, query, eventId, m.OrgID).Scan(&found); err != nil {
+		return err
+	}
+	if !found {
+		return ErrEventNotFound
+	}
+
+	list, err := json.Marshal(minutes)
+	if err != nil {
+		return err
+	}
+	stmt := `DELETE FROM event_reminders WHERE event_id = $1 AND minutes_before NOT IN (SELECT value FROM json_each($2))`
+	if _, err := tx.ExecContext(ctx, stmt, eventId, string(list)); err != nil {
+		return err
+	}
+	for _, n := range minutes {
+		stmt := `INSERT INTO event_reminders (event_id, minutes_before) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		if _, err := tx.ExecContext(ctx, stmt, eventId, n); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Due returns the reminders of published events of the tenant that are due
+// at now and weren't queued for the current start of their event yet. Of
+// several reminders of an event that are due at once, only the one closest
+// to the start is returned; the others are too late to be of use.
+func (m *EventReminderModel) Due(now time.Time) ([]*EventReminder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	now = now.UTC()
+	query := `
+		SELECT r.event_id, r.minutes_before, r.queued_for, date(e.date), COALESCE(e.start_time, '')
+		FROM event_reminders r
+		JOIN events e ON e.id = r.event_id
+		WHERE e.status = '` + StatusPublished + `' AND date(e.date) BETWEEN $1 AND $2 AND ` + tenantFilter(3) + `
+		ORDER BY r.event_id, r.minutes_before`
+	from, to := now.Format("2006-01-02"), now.Add(MaxReminderMinutes*time.Minute).Format("2006-01-02")
+	rows, err := m.DB.QueryContext(ctx, query, from, to, m.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := map[int]*EventReminder{}
+	for rows.Next() {
+		var r EventReminder
+		var date, startTime string
+		if err := rows.Scan(&r.EventId, &r.MinutesBefore, &r.QueuedFor, &date, &startTime); err != nil {
+			return nil, err
+		}
+		if r.StartsAt, err = EventStart(date, startTime); err != nil {
+			return nil, err
+		}
+		if !now.Before(r.StartsAt) || now.Before(r.SendAt()) {
+			continue
+		}
+		if _, ok := due[r.EventId]; !ok {
+			due[r.EventId] = &r
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var reminders []*EventReminder
+	for _, r := range due {
+		if r.QueuedFor == nil || !r.QueuedFor.Equal(r.StartsAt) {
+			reminders = append(reminders, r)
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].EventId < reminders[j].EventId })
+	return reminders, nil
+}
+
+// MarkQueued records that a reminder was queued for the given start of its
+// event. Reminders of the event further from the start are marked as well,
+// so they aren't sent late after a closer one.
+func (m *EventReminderModel) MarkQueued(r *EventReminder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `UPDATE event_reminders SET queued_for = $1 WHERE event_id = $2 AND minutes_before >= $3`
+	_, err := m.DB.ExecContext(ctx, stmt, r.StartsAt.UTC(), r.EventId, r.MinutesBefore)
+	return err
+}
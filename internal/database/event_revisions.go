@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// EventRevision is a snapshot of the editable fields of an event, taken when
+// it is created and after every update. ChangedFields lists the fields that
+// differ from the previous revision.
+type EventRevision struct {
+	ID            int       `json:"id"`
+	EventId       int       `json:"eventId"`
+	Revision      int       `json:"revision"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Date          string    `json:"date"`
+	Location      string    `json:"location"`
+	Visibility    string    `json:"visibility"`
+	ChangedBy     *int      `json:"changedBy,omitempty"`
+	ChangedFields []string  `json:"changedFields"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// FieldChange is a single field that differs between two revisions.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+var ErrRevisionNotFound = errors.New("Revision not found")
+
+// KeyEventFields are the fields attendees are told about when they change.
+var KeyEventFields = []string{"name", "date", "location"}
+
+// DateOnly strips the time the driver adds to event dates read back from the
+// DATETIME column.
+func DateOnly(date string) string {
+	if len(date) > len("2006-01-02") {
+		return date[:len("2006-01-02")]
+	}
+	return date
+}
+
+func (r *EventRevision) fields() map[string]string {
+	return map[string]string{
+		"name":        r.Name,
+		"description": r.Description,
+		"date":        r.Date,
+		"location":    r.Location,
+		"visibility":  r.Visibility,
+	}
+}
+
+// revisionFields are the fields of an event that are versioned, in the order
+// changes are reported.
+var revisionFields = []string{"name", "description", "date", "location", "visibility"}
+
+// Diff lists the fields that differ from r to other.
+func (r *EventRevision) Diff(other *EventRevision) []FieldChange {
+	from, to := r.fields(), other.fields()
+	changes := []FieldChange{}
+	for _, field := range revisionFields {
+		if from[field] != to[field] {
+			changes = append(changes, FieldChange{Field: field, From: from[field], To: to[field]})
+		}
+	}
+	return changes
+}
+
+// RevisionOf returns the versioned fields of event as a revision.
+func RevisionOf(event *Event) *EventRevision {
+	return &EventRevision{
+		EventId:     event.Id,
+		Name:        event.Name,
+		Description: event.Description,
+		Date:        DateOnly(event.Date),
+		Location:    event.Location,
+		Visibility:  event.Visibility,
+	}
+}
+
+// ChangedFields lists the versioned fields that differ between two states of
+// an event.
+func ChangedFields(before, after *Event) []string {
+	fields := []string{}
+	for _, change := range RevisionOf(before).Diff(RevisionOf(after)) {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
+
+const eventRevisionColumns = `r.id, r.event_id, r.revision, r.name, r.description, r.date, r.location, r.visibility, r.changed_by, r.changed_fields, r.created_at`
+
+func scanEventRevision(row rowScanner, rev *EventRevision) error {
+	var changed string
+	err := row.Scan(&rev.ID, &rev.EventId, &rev.Revision, &rev.Name, &rev.Description, &rev.Date, &rev.Location, &rev.Visibility, &rev.ChangedBy, &changed, &rev.CreatedAt)
+	if err != nil {
+		return err
+	}
+	rev.ChangedFields = []string{}
+	if changed != "" {
+		rev.ChangedFields = strings.Split(changed, ",")
+	}
+	return nil
+}
+
+// AddRevision snapshots the current state of an event of the tenant as its
+// next revision.
+func (m *EventModel) AddRevision(eventId int, changedBy int, changedFields []string) (*EventRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO event_revisions (event_id, revision, name, description, date, location, visibility, changed_by, changed_fields, created_at)
+		SELECT e.id,
+			(SELECT COALESCE(MAX(revision), 0) + 1 FROM event_revisions WHERE event_id = e.id),
+			e.name, e.description, date(e.date), e.location, e.visibility, NULLIF($1, 0), $2, $3
+		FROM events e
+		WHERE e.id = $4 AND ` + tenantFilter(5) + `
+		RETURNING id
+	`
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, stmt, changedBy, strings.Join(changedFields, ","), time.Now().UTC(), eventId, m.OrgID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrEventNotFound
+		}
+		return nil, err
+	}
+
+	return m.getRevision(`r.id = $1`, id)
+}
+
+func (m *EventModel) getRevision(cond string, args ...any) (*EventRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + eventRevisionColumns + `
+		FROM event_revisions r
+		JOIN events e ON e.id = r.event_id
+		WHERE ` + cond + ` AND ` + tenantFilter(len(args)+1)
+
+	var rev EventRevision
+	err := scanEventRevision(m.DB.QueryRowContext(ctx, query, append(args, m.OrgID)...), &rev)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+	return &rev, nil
+}
+
+func (m *EventModel) GetRevision(eventId, revision int) (*EventRevision, error) {
+	return m.getRevision(`r.event_id = $1 AND r.revision = $2`, eventId, revision)
+}
+
+// GetRevisions lists the revisions of an event, oldest first.
+func (m *EventModel) GetRevisions(eventId int) ([]*EventRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + eventRevisionColumns + `
+		FROM event_revisions r
+		JOIN events e ON e.id = r.event_id
+		WHERE r.event_id = $1 AND ` + tenantFilter(2) + `
+		ORDER BY r.revision`
+
+	rows, err := m.DB.QueryContext(ctx, query, eventId, m.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*EventRevision{}
+	for rows.Next() {
+		var rev EventRevision
+		if err := scanEventRevision(rows, &rev); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &rev)
+	}
+	return revisions, rows.Err()
+}
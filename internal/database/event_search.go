@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EventSearch are the parameters of a full-text event search. Query is free
+// text; every word must match, and the last characters of a word may be
+// left out. From and To (2006-01-02) bound the event date, inclusive, and
+// Location narrows the results to events whose location contains it.
+type EventSearch struct {
+	Query    string
+	From     string
+	To       string
+	Location string
+	Limit    int
+	Offset   int
+}
+
+// EventSearchResult is an event matching a search. Higher scores are better
+// matches. The highlights are HTML-escaped, with the matched words wrapped in
+// <mark> tags.
+type EventSearchResult struct {
+	Event
+	Score     float64        `json:"score"`
+	Highlight EventHighlight `json:"highlight"`
+}
+
+type EventHighlight struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+}
+
+// Markers FTS5 wraps matches in. They are replaced by <mark> tags once the
+// rest of the text has been escaped.
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+// ftsQuery turns free text into an FTS5 query matching every word as a
+// prefix. It returns "" when the text has no words.
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = `"` + w + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+func markMatches(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, matchStart, "<mark>")
+	return strings.ReplaceAll(s, matchEnd, "</mark>")
+}
+
+// Search finds events of the tenant that viewerId may see, best matches
+// first. Names weigh most, then locations, then descriptions. It returns no
+// results when the query has no words.
+func (m *EventModel) Search(search EventSearch, viewerId int) ([]*EventSearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	match := ftsQuery(search.Query)
+	if match == "" {
+		return []*EventSearchResult{}, nil
+	}
+
+	args := []any{match, m.OrgID, viewerId}
+	param := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	query := `
+		SELECT ` + eventColumns + `,
+			-bm25(events_fts, 10.0, 1.0, 3.0),
+			highlight(events_fts, 0, '` + matchStart + `', '` + matchEnd + `'),
+			snippet(events_fts, 1, '` + matchStart + `', '` + matchEnd + `', '…', 16),
+			highlight(events_fts, 2, '` + matchStart + `', '` + matchEnd + `')
+		FROM events_fts
+		JOIN events e ON e.id = events_fts.rowid
+		WHERE events_fts MATCH $1 AND ` + tenantFilter(2) + ` AND ` + visibleTo(3)
+	if search.From != "" {
+		query += ` AND date(e.date) >= date(` + param(search.From) + `)`
+	}
+	if search.To != "" {
+		query += ` AND date(e.date) <= date(` + param(search.To) + `)`
+	}
+	if search.Location != "" {
+		query += ` AND e.location LIKE '%' || ` + param(likeEscaper.Replace(search.Location)) + ` || '%' ESCAPE '\'`
+	}
+	query += `
+		ORDER BY bm25(events_fts, 10.0, 1.0, 3.0), e.date
+		LIMIT ` + param(search.Limit) + ` OFFSET ` + param(search.Offset)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*EventSearchResult{}
+	for rows.Next() {
+		var r EventSearchResult
+		err := scanEvent(rows, &r.Event, &r.Score, &r.Highlight.Name, &r.Highlight.Description, &r.Highlight.Location)
+		if err != nil {
+			return nil, err
+		}
+		r.Highlight.Name = markMatches(r.Highlight.Name)
+		r.Highlight.Description = markMatches(r.Highlight.Description)
+		r.Highlight.Location = markMatches(r.Highlight.Location)
+		results = append(results, &r)
+	}
+	return results, rows.Err()
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern matched with
+// ESCAPE '\', so the pattern matches its text literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
@@ -5,55 +5,185 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
+// EventModel queries are always scoped to a single tenant: OrgID 0 is the
+// personal namespace (events not owned by an organization), any other value
+// is that organization. Use Models.ForOrganization to get a scoped copy.
 type EventModel struct {
-	DB *sql.DB
+	DB    DBTX
+	OrgID int
 }
 
 type Event struct {
-	Id          int    `json:"id"`
-	OwnerId     int    `json:"ownerId"`
-	Name        string `json:"name" binding:"required,min=3"`
-	Description string `json:"description" binding:"required,min=10"`
-	Date        string `json:"date" binding:"required,datetime=2006-01-02"`
-	Location    string `json:"location" binding:"required,min=3"`
+	Id             int    `json:"id"`
+	OwnerId        int    `json:"ownerId"`
+	OrganizationId *int   `json:"organizationId,omitempty"`
+	Name           string `json:"name" binding:"required,min=3"`
+	Description    string `json:"description" binding:"required,min=10"`
+	Date           string `json:"date" binding:"required,datetime=2006-01-02"`
+	Location       string `json:"location" binding:"required,min=3"`
+	Visibility     string `json:"visibility" binding:"omitempty,oneof=public unlisted private"`
+	// Address is optional; Location stays the free-text description of the
+	// venue. Coordinates are filled in from the address when they are left
+	// out.
+	Address   *Address `json:"address,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty" binding:"required_with=Longitude,omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude,omitempty" binding:"required_with=Latitude,omitempty,min=-180,max=180"`
+	// VenueId and RoomId book the event at a venue; without a room the whole
+	// venue is booked. StartTime and EndTime (15:04) are the booked hours on
+	// Date; without them the event takes up the whole day.
+	VenueId   *int   `json:"venueId,omitempty" binding:"required_with=RoomId"`
+	RoomId    *int   `json:"roomId,omitempty"`
+	StartTime string `json:"startTime,omitempty" binding:"required_with=EndTime,omitempty,datetime=15:04"`
+	EndTime   string `json:"endTime,omitempty" binding:"required_with=StartTime,omitempty,datetime=15:04"`
+	// Capacity caps the number of attendees. It may not exceed the capacity
+	// of the room or venue, which apply when it is left out.
+	Capacity *int `json:"capacity,omitempty" binding:"omitempty,min=1"`
+	// CategoryId files the event under one of the admin-managed categories.
+	// Tags are free-form; they are normalized with NormalizeTags.
+	CategoryId *int     `json:"categoryId,omitempty"`
+	Tags       []string `json:"tags" binding:"max=10,dive,min=1,max=30,excludes=0x2C"`
+	// Status and PublishAt are read-only; they change through the lifecycle
+	// endpoints.
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publishAt,omitempty"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Version is incremented on every write and is used for optimistic
+	// concurrency control; it is read-only as well.
+	Version int `json:"version"`
 }
 
+// Address is the structured postal address of an event.
+type Address struct {
+	Street     string `json:"street,omitempty" binding:"max=200"`
+	City       string `json:"city,omitempty" binding:"max=100"`
+	Region     string `json:"region,omitempty" binding:"max=100"`
+	PostalCode string `json:"postalCode,omitempty" binding:"max=20"`
+	Country    string `json:"country,omitempty" binding:"max=100"`
+}
+
+// String formats the address on one line, skipping empty parts.
+func (a Address) String() string {
+	parts := []string{}
+	for _, p := range []string{a.Street, a.City, a.Region, a.PostalCode, a.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// AddressOf returns *a, or the zero Address if a is nil.
+func AddressOf(a *Address) Address {
+	if a == nil {
+		return Address{}
+	}
+	return *a
+}
+
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+	StatusArchived  = "archived"
+)
+
+// eventTransitions lists the statuses an event may move to from each status.
+var eventTransitions = map[string][]string{
+	StatusDraft:     {StatusPublished},
+	StatusPublished: {StatusCancelled, StatusCompleted},
+	StatusCancelled: {StatusArchived},
+	StatusCompleted: {StatusArchived},
+}
+
+// CanTransition reports whether an event in status from may move to status to.
+func CanTransition(from, to string) bool {
+	for _, s := range eventTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// AnyViewer disables the visibility filter of listing queries, for callers
+// that have already established access to every event of the tenant.
+const AnyViewer = -1
+
 const queryTimeout = 3 * time.Second
 
-var ErrEventNotFound = errors.New("Event not found")
-var ErrNoRowsAffected = errors.New("No rows affected")
+var ErrEventNotFound = notFoundError("event not found")
+var ErrNoRowsAffected = conflictError("conflict", "The resource was changed by another request")
+var ErrInvalidTransition = conflictError("invalid_transition", "Invalid status transition")
+var ErrEditConflict = preconditionFailedError("Event has been changed since it was read")
+
+const eventColumns = `e.id, e.owner_id, e.organization_id, e.name, e.description, e.date, e.location, e.visibility, e.status, e.publish_at, e.deleted_at, e.version,
+	e.street, e.city, e.region, e.postal_code, e.country, e.latitude, e.longitude,
+	e.venue_id, e.room_id, COALESCE(e.start_time, ''), COALESCE(e.end_time, ''), e.capacity, e.category_id,
+	COALESCE((SELECT group_concat(t.name, ',') FROM event_tags et JOIN tags t ON t.id = et.tag_id WHERE et.event_id = e.id), '')`
+
+// tenantFilter matches events of the model's tenant that have not been
+// deleted; it expects the tenant id as the query parameter with the given
+// index.
+func tenantFilter(param int) string {
+	return "e.deleted_at IS NULL AND " + inTenant(param)
+}
 
-func (m *EventModel) Insert(event *Event) error {
-	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
-	defer cancel()
+// inTenant is tenantFilter including deleted events.
+func inTenant(param int) string {
+	return fmt.Sprintf("($%[1]d = %[2]d OR COALESCE(e.organization_id, 0) = $%[1]d)", param, AllOrganizations)
+}
 
-	query := `
-		INSERT INTO events (owner_id, name, description, date, location) 
-		VALUES ($1, $2, $3, $4, $5) 
-		RETURNING id	
-	`
+// visibleTo matches events the viewer may see in listings: events the viewer
+// owns or organizes, and, once published, public events and events the viewer
+// attends. It expects the viewer id (0 for anonymous visitors) as the query
+// parameter with the given index.
+func visibleTo(param int) string {
+	return fmt.Sprintf(`($%[1]d = %[2]d OR e.owner_id = $%[1]d
+		OR EXISTS (SELECT 1 FROM event_organizers eo WHERE eo.event_id = e.id AND eo.user_id = $%[1]d)
+		OR (e.status <> '%[3]s' AND (e.visibility = 'public'
+			OR EXISTS (SELECT 1 FROM attendees va WHERE va.event_id = e.id AND va.user_id = $%[1]d))))`, param, AnyViewer, StatusDraft)
+}
 
-	err := m.DB.QueryRowContext(ctx, query, event.OwnerId, event.Name, event.Description, event.Date, event.Location).Scan(&event.Id)
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	if err != nil {
+// scanEvent scans eventColumns into event, followed by any extra columns the
+// query selects.
+func scanEvent(row rowScanner, event *Event, extra ...any) error {
+	var address Address
+	var tags string
+	dest := []any{&event.Id, &event.OwnerId, &event.OrganizationId, &event.Name, &event.Description, &event.Date, &event.Location, &event.Visibility, &event.Status, &event.PublishAt, &event.DeletedAt, &event.Version,
+		&address.Street, &address.City, &address.Region, &address.PostalCode, &address.Country, &event.Latitude, &event.Longitude,
+		&event.VenueId, &event.RoomId, &event.StartTime, &event.EndTime, &event.Capacity, &event.CategoryId, &tags}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		return err
 	}
 
+	event.Address = nil
+	if address != (Address{}) {
+		event.Address = &address
+	}
+	event.Tags = splitTags(tags)
 	return nil
 }
 
-func (m *EventModel) GetAll() ([]*Event, error) {
+func (m *EventModel) queryEvents(query string, args ...any) ([]*Event, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
 	defer cancel()
 
-	query := `
-		SELECT * FROM events
-	`
-
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -63,8 +193,7 @@ func (m *EventModel) GetAll() ([]*Event, error) {
 
 	for rows.Next() {
 		var event Event
-		err := rows.Scan(&event.Id, &event.OwnerId, &event.Name, &event.Description, &event.Date, &event.Location)
-		if err != nil {
+		if err := scanEvent(rows, &event); err != nil {
 			return nil, err
 		}
 
@@ -78,21 +207,56 @@ func (m *EventModel) GetAll() ([]*Event, error) {
 	return events, nil
 }
 
-func (m *EventModel) Get(id int) (*Event, error) {
+func (m *EventModel) Insert(event *Event) error {
 	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
 	defer cancel()
 
+	if m.OrgID == AllOrganizations {
+		return errors.New("cannot insert an event without a tenant")
+	}
+	if event.Visibility == "" {
+		event.Visibility = VisibilityPublic
+	}
+	event.Status = StatusDraft
+	event.PublishAt = nil
+	event.Version = 1
+
 	query := `
-		SELECT * FROM events WHERE id = $1
+		INSERT INTO events (owner_id, organization_id, name, description, date, location, visibility, status,
+			street, city, region, postal_code, country, latitude, longitude,
+			venue_id, room_id, start_time, end_time, capacity, category_id)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
+			$16, $17, NULLIF($18, ''), NULLIF($19, ''), $20, $21)
+		RETURNING id, organization_id
 	`
 
-	row := m.DB.QueryRowContext(ctx, query, id)
+	address := AddressOf(event.Address)
+	err := m.DB.QueryRowContext(ctx, query, event.OwnerId, m.OrgID, event.Name, event.Description, event.Date, event.Location, event.Visibility, event.Status,
+		address.Street, address.City, address.Region, address.PostalCode, address.Country, event.Latitude, event.Longitude,
+		event.VenueId, event.RoomId, event.StartTime, event.EndTime, event.Capacity, event.CategoryId).Scan(&event.Id, &event.OrganizationId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *EventModel) Get(id int) (*Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events e
+		WHERE e.id = $1 AND ` + tenantFilter(2)
+
+	row := m.DB.QueryRowContext(ctx, query, id, m.OrgID)
 
 	var event Event
 
-	err := row.Scan(&event.Id, &event.OwnerId, &event.Name, &event.Description, &event.Date, &event.Location)
+	err := scanEvent(row, &event)
 	if err != nil {
-		fmt.Println(err)
 		if err == sql.ErrNoRows {
 			return nil, ErrEventNotFound
 		}
@@ -103,80 +267,308 @@ func (m *EventModel) Get(id int) (*Event, error) {
 
 }
 
+// Update saves the editable fields of the event if it is still at
+// event.Version, and increments the version. It fails with ErrEditConflict if
+// the event has been changed or deleted since it was read.
 func (m *EventModel) Update(event *Event) error {
 	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
 	defer cancel()
 
 	query := `
-		UPDATE events 
-		SET name = $1, description = $2, date = $3, location = $4 
-		WHERE id = $5
-	`
+		UPDATE events AS e
+		SET name = $1, description = $2, date = $3, location = $4, visibility = $5,
+			street = $6, city = $7, region = $8, postal_code = $9, country = $10, latitude = $11, longitude = $12,
+			venue_id = $13, room_id = $14, start_time = NULLIF($15, ''), end_time = NULLIF($16, ''), capacity = $17,
+			category_id = $18, version = version + 1
+		WHERE e.id = $19 AND e.version = $20 AND ` + tenantFilter(21) + `
+		RETURNING version`
+
+	address := AddressOf(event.Address)
+	err := m.DB.QueryRowContext(ctx, query, event.Name, event.Description, event.Date, event.Location, event.Visibility,
+		address.Street, address.City, address.Region, address.PostalCode, address.Country, event.Latitude, event.Longitude,
+		event.VenueId, event.RoomId, event.StartTime, event.EndTime, event.Capacity, event.CategoryId,
+		event.Id, event.Version, m.OrgID).Scan(&event.Version)
+	if err == sql.ErrNoRows {
+		return ErrEditConflict
+	}
+	return err
+}
+
+// SetStatus moves the event from status from to status to. It fails with
+// ErrInvalidTransition if the transition is not allowed and with
+// ErrNoRowsAffected if the event is no longer in status from. Moving to
+// published clears a scheduled publish time.
+func (m *EventModel) SetStatus(id int, from, to string) error {
+	if !CanTransition(from, to) {
+		return ErrInvalidTransition
+	}
 
-	res, err := m.DB.ExecContext(ctx, query, event.Name, event.Description, event.Date, event.Location, event.Id)
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE events AS e
+		SET status = $1, publish_at = CASE WHEN $1 = '` + StatusPublished + `' THEN NULL ELSE publish_at END, version = version + 1
+		WHERE e.id = $2 AND e.status = $3 AND ` + tenantFilter(4)
+
+	res, err := m.DB.ExecContext(ctx, query, to, id, from, m.OrgID)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	return checkRowsAffected(res)
+}
+
+// SchedulePublish sets or clears (publishAt nil) the time a draft is
+// published automatically.
+func (m *EventModel) SchedulePublish(id int, publishAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if publishAt != nil {
+		t := publishAt.UTC()
+		publishAt = &t
+	}
+
+	query := `
+		UPDATE events AS e
+		SET publish_at = $1, version = version + 1
+		WHERE e.id = $2 AND e.status = '` + StatusDraft + `' AND ` + tenantFilter(3)
+
+	res, err := m.DB.ExecContext(ctx, query, publishAt, id, m.OrgID)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return ErrNoRowsAffected
-	}
-	return nil
+
+	return checkRowsAffected(res)
 }
 
-func (m *EventModel) Delete(id int) error {
+// PublishDue publishes every draft of the tenant whose scheduled publish time
+// is not after now, and returns their ids.
+func (m *EventModel) PublishDue(now time.Time) ([]int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
 	defer cancel()
 
 	query := `
-		DELETE FROM events 
-		WHERE id = $1
-	`
+		UPDATE events AS e
+		SET status = '` + StatusPublished + `', publish_at = NULL, version = version + 1
+		WHERE e.status = '` + StatusDraft + `' AND e.publish_at IS NOT NULL AND e.publish_at <= $1 AND ` + tenantFilter(2) + `
+		RETURNING id`
 
-	res, err := m.DB.ExecContext(ctx, query, id)
+	return queryIds(ctx, m.DB, query, now.UTC(), m.OrgID)
+}
+
+// Delete soft-deletes the event if it is still at the given version. It is
+// hidden from every query but keeps its attendees until it is purged, so it
+// can be restored in the meantime. It fails with ErrEditConflict if the event
+// has been changed or deleted since it was read.
+func (m *EventModel) Delete(id, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE events AS e
+		SET deleted_at = $1, version = version + 1
+		WHERE e.id = $2 AND e.version = $3 AND ` + tenantFilter(4)
+
+	res, err := m.DB.ExecContext(ctx, query, time.Now().UTC(), id, version, m.OrgID)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	err = checkRowsAffected(res)
+	if err == ErrNoRowsAffected {
+		return ErrEditConflict
+	}
+	return err
+}
+
+// GetDeleted returns an event of the tenant deleted after since.
+func (m *EventModel) GetDeleted(id int, since time.Time) (*Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events e
+		WHERE e.id = $1 AND e.deleted_at > $2 AND ` + inTenant(3)
+
+	var event Event
+	err := scanEvent(m.DB.QueryRowContext(ctx, query, id, since.UTC(), m.OrgID), &event)
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return nil, ErrEventNotFound
+		}
+		return nil, err
 	}
-	if rowsAffected == 0 {
-		return ErrNoRowsAffected
+
+	return &event, nil
+}
+
+// Restore undeletes an event of the tenant deleted after since.
+func (m *EventModel) Restore(id int, since time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE events AS e
+		SET deleted_at = NULL, version = version + 1
+		WHERE e.id = $1 AND e.deleted_at > $2 AND ` + inTenant(3)
+
+	res, err := m.DB.ExecContext(ctx, query, id, since.UTC(), m.OrgID)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return checkRowsAffected(res)
 }
 
-func (m EventModel) GetByAttendee(attendeeId int) ([]Event, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetAllForAdmin lists every event of the tenant regardless of visibility,
+// including deleted events when includeDeleted is set.
+func (m *EventModel) GetAllForAdmin(includeDeleted bool) ([]*Event, error) {
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events e
+		WHERE ($1 OR e.deleted_at IS NULL) AND ` + inTenant(2) + `
+		ORDER BY e.id`
+
+	return m.queryEvents(query, includeDeleted, m.OrgID)
+}
+
+// Purge hard-deletes the events of the tenant deleted before the given time
+// together with their attendees, organizers, invite links, revisions, tags,
+// ticket types, promo codes, orders, registration forms and reminders, and
+// returns the ids of the removed events.
+func (m *EventModel) Purge(before time.Time) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
 	defer cancel()
 
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	purged := `SELECT e.id FROM events e WHERE e.deleted_at <= $1 AND ` + inTenant(2)
+	stmt := `DELETE FROM order_items WHERE order_id IN (SELECT id FROM orders WHERE event_id IN (` + purged + `))`
+	if _, err := tx.ExecContext(ctx, stmt, before.UTC(), m.OrgID); err != nil {
+		return nil, err
+	}
+	tables := []string{"attendees", "event_organizers", "event_invite_links", "event_revisions", "event_tags",
+		"orders", "promo_codes", "ticket_types", "registration_answers", "registration_forms", "event_reminders"}
+	for _, table := range tables {
+		stmt := `DELETE FROM ` + table + ` WHERE event_id IN (` + purged + `)`
+		if _, err := tx.ExecContext(ctx, stmt, before.UTC(), m.OrgID); err != nil {
+			return nil, err
+		}
+	}
+
+	ids, err := queryIds(ctx, tx, `DELETE FROM events WHERE id IN (`+purged+`) RETURNING id`, before.UTC(), m.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
+
+// GetByAttendee lists the events attendeeId attends that viewerId may see.
+func (m EventModel) GetByAttendee(attendeeId, viewerId int) ([]Event, error) {
 	query := `
-		SELECT e.id, e.owner_id, e.name, e.description, e.date, e.location
+		SELECT ` + eventColumns + `
 		FROM events e
 		JOIN attendees a ON e.id = a.event_id
-		WHERE a.user_id = $1
+		WHERE a.user_id = $1 AND ` + tenantFilter(2) + ` AND ` + visibleTo(3)
+
+	events, err := m.queryEvents(query, attendeeId, m.OrgID, viewerId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Event{}
+	for _, event := range events {
+		result = append(result, *event)
+	}
+	return result, nil
+}
+
+func (m *EventModel) GetByOwner(ownerId int) ([]*Event, error) {
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events e
+		WHERE e.owner_id = $1 AND ` + tenantFilter(2)
+
+	return m.queryEvents(query, ownerId, m.OrgID)
+}
+
+func (m *EventModel) IsOrganizer(eventId, userId int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM event_organizers eo
+			JOIN events e ON e.id = eo.event_id
+			WHERE eo.event_id = $1 AND eo.user_id = $2 AND ` + tenantFilter(3) + `
+		)
 	`
-	rows, err := m.DB.QueryContext(ctx, query, attendeeId)
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, eventId, userId, m.OrgID).Scan(&exists)
+	return exists, err
+}
+
+func (m *EventModel) GetOrganizers(eventId int) ([]*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT u.id, u.name, u.email
+		FROM users u
+		JOIN event_organizers eo ON eo.user_id = u.id
+		JOIN events e ON e.id = eo.event_id
+		WHERE eo.event_id = $1 AND u.deleted_at IS NULL AND ` + tenantFilter(2)
+
+	rows, err := m.DB.QueryContext(ctx, query, eventId, m.OrgID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var events []Event
+	users := []*User{}
 	for rows.Next() {
-		var event Event
-		err := rows.Scan(&event.Id, &event.OwnerId, &event.Name, &event.Description, &event.Date, &event.Location)
-		if err != nil {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email); err != nil {
 			return nil, err
 		}
-		events = append(events, event)
+		users = append(users, &user)
 	}
-	return events, nil
+	return users, rows.Err()
+}
+
+func (m *EventModel) AddOrganizer(eventId, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO event_organizers (event_id, user_id)
+		SELECT e.id, $1 FROM events e
+		WHERE e.id = $2 AND ` + tenantFilter(3) + `
+		ON CONFLICT (event_id, user_id) DO NOTHING
+	`
+	_, err := m.DB.ExecContext(ctx, stmt, userId, eventId, m.OrgID)
+	return err
+}
+
+func (m *EventModel) RemoveOrganizer(eventId, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		DELETE FROM event_organizers
+		WHERE event_id = $1 AND user_id = $2
+		AND event_id IN (SELECT e.id FROM events e WHERE ` + tenantFilter(3) + `)
+	`
+	res, err := m.DB.ExecContext(ctx, stmt, eventId, userId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
 }
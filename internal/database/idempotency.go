@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type IdempotencyModel struct {
+	DB DBTX
+}
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key. StatusCode is 0 while the first request is still running.
+// Keys are scoped per user.
+type IdempotencyRecord struct {
+	UserId       int
+	Key          string
+	Fingerprint  string
+	StatusCode   int
+	ContentType  string
+	Headers      http.Header
+	ResponseBody []byte
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// Reserve claims key for a new request. It returns true when the key was
+// free (or had expired); otherwise it returns the record of the request that
+// holds it. Only one of several concurrent callers can claim a key.
+func (m *IdempotencyModel) Reserve(userId int, key, fingerprint string, expiresAt time.Time) (*IdempotencyRecord, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	if _, err := m.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND expires_at <= $3`, userId, key, now); err != nil {
+		return nil, false, err
+	}
+
+	stmt := `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, key) DO NOTHING
+	`
+	res, err := m.DB.ExecContext(ctx, stmt, userId, key, fingerprint, now, expiresAt.UTC())
+	if err != nil {
+		return nil, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	if n == 1 {
+		return nil, true, nil
+	}
+
+	query := `
+		SELECT user_id, key, fingerprint, COALESCE(status_code, 0), content_type, response_headers, COALESCE(response_body, ''), created_at, expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`
+	var rec IdempotencyRecord
+	var headers string
+	err = m.DB.QueryRowContext(ctx, query, userId, key).Scan(&rec.UserId, &rec.Key, &rec.Fingerprint, &rec.StatusCode, &rec.ContentType, &headers, &rec.ResponseBody, &rec.CreatedAt, &rec.ExpiresAt)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal([]byte(headers), &rec.Headers); err != nil {
+		return nil, false, err
+	}
+	return &rec, false, nil
+}
+
+// Complete stores the response of the request that reserved key, with the
+// headers to replay along with it.
+func (m *IdempotencyModel) Complete(userId int, key string, statusCode int, contentType string, headers http.Header, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		UPDATE idempotency_keys
+		SET status_code = $1, content_type = $2, response_headers = $3, response_body = $4
+		WHERE user_id = $5 AND key = $6
+	`
+	res, err := m.DB.ExecContext(ctx, stmt, statusCode, contentType, string(headersJSON), body, userId, key)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// Release frees key so the request can be retried, e.g. after it failed with
+// a server error.
+func (m *IdempotencyModel) Release(userId int, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userId, key)
+	return err
+}
+
+// DeleteExpired removes keys that expired before now and returns how many
+// were removed.
+func (m *IdempotencyModel) DeleteExpired(now time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
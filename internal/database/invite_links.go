@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type InviteLinkModel struct {
+	DB DBTX
+}
+
+// InviteLink lets logged-in users join an event, usually a private one.
+// ExpiresAt and MaxUses are optional.
+type InviteLink struct {
+	ID        int        `json:"id"`
+	EventId   int        `json:"eventId"`
+	CreatedBy int        `json:"createdBy"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	MaxUses   *int       `json:"maxUses,omitempty"`
+	Uses      int        `json:"uses"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+const inviteLinkColumns = `id, event_id, created_by, expires_at, max_uses, uses, revoked_at, created_at`
+
+func scanInviteLink(row rowScanner, link *InviteLink) error {
+	return row.Scan(&link.ID, &link.EventId, &link.CreatedBy, &link.ExpiresAt, &link.MaxUses, &link.Uses, &link.RevokedAt, &link.CreatedAt)
+}
+
+func (m *InviteLinkModel) Insert(link *InviteLink) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	link.CreatedAt = time.Now().UTC()
+	stmt := `
+		INSERT INTO event_invite_links (event_id, created_by, expires_at, max_uses, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+	return m.DB.QueryRowContext(ctx, stmt, link.EventId, link.CreatedBy, link.ExpiresAt, link.MaxUses, link.CreatedAt).Scan(&link.ID)
+}
+
+func (m *InviteLinkModel) Get(id int) (*InviteLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var link InviteLink
+	err := scanInviteLink(m.DB.QueryRowContext(ctx, `SELECT `+inviteLinkColumns+` FROM event_invite_links WHERE id = $1`, id), &link)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (m *InviteLinkModel) GetByEvent(eventId int) ([]*InviteLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT `+inviteLinkColumns+` FROM event_invite_links WHERE event_id = $1 ORDER BY id`, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*InviteLink{}
+	for rows.Next() {
+		var link InviteLink
+		if err := scanInviteLink(rows, &link); err != nil {
+			return nil, err
+		}
+		links = append(links, &link)
+	}
+	return links, rows.Err()
+}
+
+func (m *InviteLinkModel) Revoke(eventId, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `UPDATE event_invite_links SET revoked_at = $1 WHERE event_id = $2 AND id = $3 AND revoked_at IS NULL`
+	res, err := m.DB.ExecContext(ctx, stmt, time.Now().UTC(), eventId, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// Redeem counts one use of the link. It fails with ErrInvalidToken when the
+// link is revoked, expired or used up.
+func (m *InviteLinkModel) Redeem(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		UPDATE event_invite_links
+		SET uses = uses + 1
+		WHERE id = $1
+			AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > $2)
+			AND (max_uses IS NULL OR uses < max_uses)
+	`
+	res, err := m.DB.ExecContext(ctx, stmt, id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// JobModel stores the background job queue. Jobs aren't scoped to a tenant;
+// their handlers scope what they load themselves.
+type JobModel struct {
+	DB DBTX
+}
+
+// Job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// Job is a unit of background work. Kind selects the handler and Payload is
+// its JSON input. A failed attempt is retried at RunAt until MaxAttempts is
+// reached, after which the job is dead; LastError is the error of the
+// latest failed attempt.
+type Job struct {
+	ID          int             `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload" swaggertype:"object"`
+	Status      string          `json:"status" enums:"queued,running,succeeded,dead"`
+	UniqueKey   *string         `json:"uniqueKey,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LockedAt    *time.Time      `json:"lockedAt,omitempty"`
+	LastError   string          `json:"lastError,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
+}
+
+var (
+	ErrJobNotFound = notFoundError("job not found")
+	ErrJobNotDead  = conflictError("conflict", "Only dead jobs can be retried")
+)
+
+const jobColumns = `id, kind, payload, status, unique_key, attempts, max_attempts, run_at, locked_at, COALESCE(last_error, ''), created_at, finished_at`
+
+func scanJob(row rowScanner, j *Job) error {
+	var payload string
+	err := row.Scan(&j.ID, &j.Kind, &payload, &j.Status, &j.UniqueKey, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.LockedAt, &j.LastError, &j.CreatedAt, &j.FinishedAt)
+	j.Payload = json.RawMessage(payload)
+	if err == nil && !json.Valid(j.Payload) {
+		// Keep a payload written by hand readable instead of breaking
+		// every response listing it; its handler fails on it anyway.
+		j.Payload, err = json.Marshal(payload)
+	}
+	return err
+}
+
+func (m *JobModel) getJob(query string, args ...any) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var j Job
+	err := scanJob(m.DB.QueryRowContext(ctx, query, args...), &j)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// Enqueue adds a job that runs at j.RunAt, or right away when it is zero. A
+// job whose UniqueKey was enqueued before is not added again, whatever became
+// of the earlier one; Enqueue then returns false and sets j to that job.
+func (m *JobModel) Enqueue(j *Job) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	j.Status = JobQueued
+	j.CreatedAt = time.Now().UTC()
+	if j.RunAt.IsZero() {
+		j.RunAt = j.CreatedAt
+	}
+	j.RunAt = j.RunAt.UTC()
+
+	stmt := `
+		INSERT INTO jobs (kind, payload, status, unique_key, max_attempts, run_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (unique_key) DO NOTHING
+		RETURNING id`
+	err := m.DB.QueryRowContext(ctx, stmt, j.Kind, string(j.Payload), j.Status, j.UniqueKey, j.MaxAttempts, j.RunAt, j.CreatedAt).Scan(&j.ID)
+	if err == sql.ErrNoRows {
+		existing, err := m.getJob(`SELECT `+jobColumns+` FROM jobs WHERE unique_key = $1`, j.UniqueKey)
+		if err != nil {
+			return false, err
+		}
+		*j = *existing
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Claim takes the next job due at now for a worker, marking it running and
+// counting the attempt. It returns nil when no job is due. Of several
+// workers claiming at once, each gets a different job.
+func (m *JobModel) Claim(now time.Time) (*Job, error) {
+	// SQLite runs one writer at a time, so the job picked by the subquery
+	// is still queued when it is updated. Postgres will need FOR UPDATE
+	// SKIP LOCKED in the subquery for that.
+	job, err := m.getJob(`
+		UPDATE jobs
+		SET status = $1, attempts = attempts + 1, locked_at = $2
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = $3 AND run_at <= $2
+			ORDER BY run_at, id
+			LIMIT 1
+		)
+		RETURNING `+jobColumns, JobRunning, now.UTC(), JobQueued)
+	if err == ErrJobNotFound {
+		return nil, nil
+	}
+	return job, err
+}
+
+// Complete marks a running job as succeeded.
+func (m *JobModel) Complete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `UPDATE jobs SET status = $1, locked_at = NULL, finished_at = $2 WHERE id = $3 AND status = $4`
+	res, err := m.DB.ExecContext(ctx, stmt, JobSucceeded, time.Now().UTC(), id, JobRunning)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// Fail records a failed attempt of a running job. The job is queued again
+// to run at retryAt, or is dead when retryAt is nil.
+func (m *JobModel) Fail(id int, message string, retryAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `UPDATE jobs SET status = $1, run_at = $2, locked_at = NULL, last_error = $3 WHERE id = $4 AND status = $5`
+	args := []any{JobQueued, retryAt, message, id, JobRunning}
+	if retryAt == nil {
+		stmt = `UPDATE jobs SET status = $1, finished_at = $2, locked_at = NULL, last_error = $3 WHERE id = $4 AND status = $5`
+		args = []any{JobDead, time.Now().UTC(), message, id, JobRunning}
+	} else {
+		args[1] = retryAt.UTC()
+	}
+	res, err := m.DB.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// RequeueStale releases jobs claimed before lockedBefore by workers that
+// stopped without finishing them. They are queued again, or are dead when
+// they have no attempts left.
+func (m *JobModel) RequeueStale(lockedBefore time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	stmt := `
+		UPDATE jobs
+		SET status = CASE WHEN attempts < max_attempts THEN $1 ELSE $2 END,
+			finished_at = CASE WHEN attempts < max_attempts THEN NULL ELSE $3 END,
+			run_at = $3,
+			locked_at = NULL,
+			last_error = 'The worker stopped while running the job'
+		WHERE status = $4 AND locked_at < $5`
+	res, err := m.DB.ExecContext(ctx, stmt, JobQueued, JobDead, now, JobRunning, lockedBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Get returns a job, or ErrJobNotFound.
+func (m *JobModel) Get(id int) (*Job, error) {
+	return m.getJob(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id)
+}
+
+// Query lists jobs, newest first, optionally only those with the given
+// status or kind, together with the number of matching jobs.
+func (m *JobModel) Query(status, kind string, limit, offset int) ([]*Job, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	where := ` WHERE 1 = 1`
+	var args []any
+	if status != "" {
+		args = append(args, status)
+		where += ` AND status = $` + strconv.Itoa(len(args))
+	}
+	if kind != "" {
+		args = append(args, kind)
+		where += ` AND kind = $` + strconv.Itoa(len(args))
+	}
+
+	var total int
+	if err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM jobs`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	query := `SELECT ` + jobColumns + ` FROM jobs` + where + `
+		ORDER BY id DESC
+		LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		var j Job
+		if err := scanJob(rows, &j); err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, &j)
+	}
+	return jobs, total, rows.Err()
+}
+
+// Retry queues a dead job again with all its attempts, to run right away.
+// It fails with ErrJobNotDead for jobs in any other status.
+func (m *JobModel) Retry(id int) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		UPDATE jobs
+		SET status = $1, attempts = 0, run_at = $2, finished_at = NULL
+		WHERE id = $3 AND status = $4`
+	res, err := m.DB.ExecContext(ctx, stmt, JobQueued, time.Now().UTC(), id, JobDead)
+	if err != nil {
+		return nil, err
+	}
+	job, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return nil, ErrJobNotDead
+	}
+	return job, nil
+}
+
+// DeleteFinished removes jobs that succeeded before the given time. Their
+// unique keys can be enqueued again after that; dead jobs are kept until
+// they are retried.
+func (m *JobModel) DeleteFinished(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM jobs WHERE status = $1 AND finished_at < $2`, JobSucceeded, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
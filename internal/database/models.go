@@ -1,17 +1,143 @@
 package database
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AllOrganizations lifts tenant isolation. It is only meant for
+// account-wide operations such as data exports.
+const AllOrganizations = -1
 
 type Models struct {
-	Users     UserModel
-	Events    EventModel
-	Attendees AttendeeModel
+	Users             UserModel
+	Events            EventModel
+	Attendees         AttendeeModel
+	Organizations     OrganizationModel
+	InviteLinks       InviteLinkModel
+	AuditLog          AuditLogModel
+	Idempotency       IdempotencyModel
+	Venues            VenueModel
+	Categories        CategoryModel
+	Tags              TagModel
+	EventFiles        EventFileModel
+	TicketTypes       TicketTypeModel
+	Orders            OrderModel
+	PromoCodes        PromoCodeModel
+	RegistrationForms RegistrationFormModel
+	Jobs              JobModel
+	EventReminders    EventReminderModel
+
+	db *sql.DB
+	// tx is set on models bound to a transaction by WithTx.
+	tx *sql.Tx
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Users:     UserModel{DB: db},
-		Events:    EventModel{DB: db},
-		Attendees: AttendeeModel{DB: db},
+		Users:             UserModel{DB: db},
+		Events:            EventModel{DB: db},
+		Attendees:         AttendeeModel{DB: db},
+		Organizations:     OrganizationModel{DB: db},
+		InviteLinks:       InviteLinkModel{DB: db},
+		AuditLog:          AuditLogModel{DB: db},
+		Idempotency:       IdempotencyModel{DB: db},
+		Venues:            VenueModel{DB: db},
+		Categories:        CategoryModel{DB: db},
+		Tags:              TagModel{DB: db},
+		EventFiles:        EventFileModel{DB: db},
+		TicketTypes:       TicketTypeModel{DB: db},
+		Orders:            OrderModel{DB: db},
+		PromoCodes:        PromoCodeModel{DB: db},
+		RegistrationForms: RegistrationFormModel{DB: db},
+		Jobs:              JobModel{DB: db},
+		EventReminders:    EventReminderModel{DB: db},
+		db:                db,
+	}
+}
+
+// WithTx runs fn with a copy of the models bound to a single transaction,
+// keeping their tenant scope. The transaction is committed if fn returns nil
+// and rolled back otherwise. Models that are already bound to a transaction
+// run fn in it.
+//
+// When SQLite reports the database as busy the whole transaction is retried
+// with backoff, so fn may run more than once and must not have effects
+// outside the database; send emails and the like after WithTx returns.
+func (m Models) WithTx(fn func(tx Models) error) error {
+	if m.tx != nil {
+		return fn(m)
+	}
+
+	err := m.runTx(fn)
+	delay := txRetryDelay
+	for attempt := 1; attempt < maxTxAttempts && isBusy(err); attempt++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = m.runTx(fn)
+	}
+	return err
+}
+
+func (m Models) runTx(fn func(tx Models) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m.tx = tx
+	m.Users.DB = tx
+	m.Events.DB = tx
+	m.Attendees.DB = tx
+	m.Organizations.DB = tx
+	m.InviteLinks.DB = tx
+	m.AuditLog.DB = tx
+	m.Idempotency.DB = tx
+	m.Venues.DB = tx
+	m.Categories.DB = tx
+	m.Tags.DB = tx
+	m.EventFiles.DB = tx
+	m.TicketTypes.DB = tx
+	m.Orders.DB = tx
+	m.PromoCodes.DB = tx
+	m.RegistrationForms.DB = tx
+	m.Jobs.DB = tx
+	m.EventReminders.DB = tx
+
+	if err := fn(m); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ForOrganization returns a copy of the models with event, attendee, venue,
+// tag, ticket type, order, promo code and registration form queries scoped
+// to the given organization. 0 is the personal namespace.
+func (m Models) ForOrganization(orgId int) Models {
+	m.Events.OrgID = orgId
+	m.Attendees.OrgID = orgId
+	m.Venues.OrgID = orgId
+	m.Tags.OrgID = orgId
+	m.TicketTypes.OrgID = orgId
+	m.Orders.OrgID = orgId
+	m.PromoCodes.OrgID = orgId
+	m.RegistrationForms.OrgID = orgId
+	m.EventReminders.OrgID = orgId
+	return m
+}
+
+func checkRowsAffected(res sql.Result) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRowsAffected
 	}
+	return nil
 }
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/file"
+)
+
+// newTestDB opens a database in a temporary directory with every migration
+// applied. params is appended to the file name, e.g. "?_busy_timeout=0".
+// Binaries built without the FTS5 module can't run the migrations, so the
+// test is skipped for them.
+func newTestDB(t *testing.T, params string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "data.db")+params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	instance, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := (&file.File{}).Open("../../cmd/migrate/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithInstance("file", src, "sqlite3", instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			t.Skip("migrations need the FTS5 module: go test -tags sqlite_fts5")
+		}
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestWithTxRetriesWhileBusy holds the write lock on another connection and
+// checks that WithTx runs the transaction again until the lock is released,
+// and gives up after maxTxAttempts.
+func TestWithTxRetriesWhileBusy(t *testing.T) {
+	tests := []struct {
+		name      string
+		holdFor   time.Duration
+		wantCalls func(calls int) bool
+		wantBusy  bool
+	}{
+		{"released", 30 * time.Millisecond, func(calls int) bool { return calls > 1 && calls <= maxTxAttempts }, false},
+		{"held", time.Minute, func(calls int) bool { return calls == maxTxAttempts }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, "?_busy_timeout=0")
+			models := NewModels(db)
+
+			ctx := context.Background()
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+				t.Fatal(err)
+			}
+			release := time.AfterFunc(tt.holdFor, func() { conn.ExecContext(ctx, "ROLLBACK") })
+			defer func() {
+				if release.Stop() {
+					conn.ExecContext(ctx, "ROLLBACK")
+				}
+			}()
+
+			calls := 0
+			err = models.WithTx(func(tx Models) error {
+				calls++
+				return tx.Users.Insert(&User{Name: "Alice", Email: "alice@example.com", Password: "hash"})
+			})
+			if got := isBusy(err); got != tt.wantBusy {
+				t.Fatalf("WithTx() = %v, busy %v, want busy %v", err, got, tt.wantBusy)
+			}
+			if !tt.wantCalls(calls) {
+				t.Errorf("fn ran %d times", calls)
+			}
+			if tt.wantBusy {
+				return
+			}
+			user, err := models.Users.GetByEmail("alice@example.com")
+			if err != nil || user == nil {
+				t.Errorf("GetByEmail() = %v, %v, want the inserted user", user, err)
+			}
+		})
+	}
+}
+
+// TestWithTxRollsBack checks that nothing fn wrote is kept when it fails,
+// including writes of nested WithTx calls, which join the transaction.
+func TestWithTxRollsBack(t *testing.T) {
+	models := NewModels(newTestDB(t, ""))
+
+	ran := false
+	err := models.WithTx(func(tx Models) error {
+		if err := tx.Users.Insert(&User{Name: "Alice", Email: "alice@example.com", Password: "hash"}); err != nil {
+			return err
+		}
+		if err := tx.WithTx(func(tx Models) error {
+			ran = true
+			return tx.Users.Insert(&User{Name: "Bob", Email: "bob@example.com", Password: "hash"})
+		}); err != nil {
+			return err
+		}
+		return ErrEditConflict
+	})
+	if err != ErrEditConflict {
+		t.Fatalf("WithTx() = %v, want %v", err, ErrEditConflict)
+	}
+	if !ran {
+		t.Fatal("nested WithTx didn't run fn")
+	}
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		if user, err := models.Users.GetByEmail(email); err != nil || user != nil {
+			t.Errorf("GetByEmail(%q) = %v, %v, want nil", email, user, err)
+		}
+	}
+}
+
+// TestForOrganizationIsolatesTenants checks that models scoped to one
+// organization can neither read nor write the events of another one, or
+// personal events, while AllOrganizations reaches every event.
+func TestForOrganizationIsolatesTenants(t *testing.T) {
+	models := NewModels(newTestDB(t, ""))
+
+	owner := &User{Name: "Owner", Email: "owner@example.com", Password: "hash"}
+	if err := models.Users.Insert(owner); err != nil {
+		t.Fatal(err)
+	}
+	orgA, orgB := &Organization{Name: "A"}, &Organization{Name: "B"}
+	for _, org := range []*Organization{orgA, orgB} {
+		if err := models.Organizations.Insert(org, owner.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newEvent := func(orgId int) *Event {
+		t.Helper()
+		event := &Event{OwnerId: owner.ID, Name: "Party", Description: "A party", Date: "2030-01-01", Location: "Hall"}
+		scoped := models.ForOrganization(orgId)
+		if err := scoped.Events.Insert(event); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	eventA, personal := newEvent(orgA.ID), newEvent(0)
+
+	// Every access must fail as if the event didn't exist.
+	accesses := []struct {
+		name string
+		run  func(m Models, event *Event) error
+		want error
+	}{
+		{"get", func(m Models, event *Event) error {
+			_, err := m.Events.Get(event.Id)
+			return err
+		}, ErrEventNotFound},
+		{"update", func(m Models, event *Event) error {
+			changed := *event
+			changed.Name = "Hijacked"
+			return m.Events.Update(&changed)
+		}, ErrEditConflict},
+		{"delete", func(m Models, event *Event) error {
+			return m.Events.Delete(event.Id, event.Version)
+		}, ErrEditConflict},
+		{"attend", func(m Models, event *Event) error {
+			return m.Attendees.Insert(&Attendee{EventId: event.Id, UserId: owner.ID})
+		}, ErrEventNotFound},
+		{"add ticket type", func(m Models, event *Event) error {
+			return m.TicketTypes.Insert(&TicketType{EventId: event.Id, Name: "Entry", Price: 100, Currency: "USD", Quantity: 10})
+		}, ErrEventNotFound},
+		{"add promo code", func(m Models, event *Event) error {
+			return m.PromoCodes.Insert(&PromoCode{EventId: event.Id, Code: "FREE", DiscountType: "percent", Amount: 100})
+		}, ErrEventNotFound},
+		{"order", func(m Models, event *Event) error {
+			return m.Orders.Insert(&Order{EventId: event.Id, UserId: &owner.ID, Status: OrderPending, Currency: "USD", ExpiresAt: time.Now().Add(time.Hour)})
+		}, ErrEventNotFound},
+	}
+	scopes := []struct {
+		name  string
+		orgId int
+		event *Event
+	}{
+		{"other organization", orgB.ID, eventA},
+		{"personal namespace", 0, eventA},
+		{"organization on a personal event", orgA.ID, personal},
+	}
+	for _, scope := range scopes {
+		for _, access := range accesses {
+			if err := access.run(models.ForOrganization(scope.orgId), scope.event); err != access.want {
+				t.Errorf("%s: %s = %v, want %v", scope.name, access.name, err, access.want)
+			}
+		}
+	}
+
+	// The event is untouched and still reachable from its own tenant.
+	for _, orgId := range []int{orgA.ID, AllOrganizations} {
+		scoped := models.ForOrganization(orgId)
+		event, err := scoped.Events.Get(eventA.Id)
+		if err != nil {
+			t.Fatalf("ForOrganization(%d).Events.Get() = %v", orgId, err)
+		}
+		if event.Name != "Party" || event.Version != 1 {
+			t.Errorf("ForOrganization(%d).Events.Get() = %q at version %d, want %q at version 1", orgId, event.Name, event.Version, "Party")
+		}
+	}
+	scoped := models.ForOrganization(orgA.ID)
+	attendees, err := scoped.Attendees.GetAttendeesByEvent(eventA.Id)
+	if err != nil || len(attendees) != 0 {
+		t.Errorf("GetAttendeesByEvent() = %d attendees, %v, want none", len(attendees), err)
+	}
+}
@@ -0,0 +1,348 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// OrderModel is scoped to a tenant the same way as EventModel: orders are
+// only visible through events of the model's organization.
+type OrderModel struct {
+	DB    DBTX
+	OrgID int
+}
+
+// Order statuses. A pending order reserves its tickets until ExpiresAt; it
+// becomes paid once the payment provider confirms the payment, or expired
+// when the reservation runs out first.
+const (
+	OrderPending  = "pending"
+	OrderPaid     = "paid"
+	OrderRefunded = "refunded"
+	OrderExpired  = "expired"
+)
+
+var ErrOrderNotFound = notFoundError("order not found")
+
+// Order is a purchase of tickets for an event. Total is in the minor unit of
+// Currency, after the Discount of the promo code the order was placed with.
+// UserId is the buyer; it is cleared when the buyer's account is purged.
+type Order struct {
+	ID          int          `json:"id"`
+	EventId     int          `json:"eventId"`
+	UserId      *int         `json:"userId,omitempty"`
+	Status      string       `json:"status" enums:"pending,paid,refunded,expired"`
+	Total       int64        `json:"total"`
+	Currency    string       `json:"currency"`
+	PromoCodeId *int         `json:"promoCodeId,omitempty"`
+	Discount    int64        `json:"discount"`
+	PaymentId   *string      `json:"paymentId,omitempty"`
+	CheckoutURL string       `json:"checkoutUrl,omitempty"`
+	ExpiresAt   time.Time    `json:"expiresAt"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	PaidAt      *time.Time   `json:"paidAt,omitempty"`
+	RefundedAt  *time.Time   `json:"refundedAt,omitempty"`
+	Items       []*OrderItem `json:"items"`
+}
+
+// OrderItem is one ticket of an order, for one user. The ticket costs
+// UnitPrice minus Discount. Answers are the holder's answers to version
+// FormVersion of the registration form, saved once the order is paid.
+// AttendeeId is the RSVP created for the user once the order is paid; it
+// stays empty if the user already attended the event.
+type OrderItem struct {
+	ID           int     `json:"id"`
+	TicketTypeId int     `json:"ticketTypeId"`
+	UserId       *int    `json:"userId,omitempty"`
+	UnitPrice    int64   `json:"unitPrice"`
+	Discount     int64   `json:"discount"`
+	Answers      Answers `json:"answers,omitempty"`
+	FormVersion  *int    `json:"formVersion,omitempty"`
+	AttendeeId   *int    `json:"attendeeId,omitempty"`
+}
+
+// orderHolds matches orders o that hold their tickets: paid orders and
+// pending orders whose reservation has not run out. It expects the current
+// time as the query parameter with the given index.
+func orderHolds(param int) string {
+	return fmt.Sprintf(`(o.status = '%s' OR (o.status = '%s' AND o.expires_at > $%d))`, OrderPaid, OrderPending, param)
+}
+
+const orderColumns = `o.id, o.event_id, o.user_id, o.status, o.total, o.currency, o.promo_code_id, o.discount,
+	o.payment_id, o.checkout_url, o.expires_at, o.created_at, o.paid_at, o.refunded_at`
+
+// queryOrders returns the orders matching where, newest first, together with
+// their items.
+func (m *OrderModel) queryOrders(where string, args ...any) ([]*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	from := `FROM orders o JOIN events e ON e.id = o.event_id ` + where
+	rows, err := m.DB.QueryContext(ctx, `SELECT `+orderColumns+` `+from+` ORDER BY o.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []*Order{}
+	byId := map[int]*Order{}
+	for rows.Next() {
+		o := Order{Items: []*OrderItem{}}
+		err := rows.Scan(&o.ID, &o.EventId, &o.UserId, &o.Status, &o.Total, &o.Currency, &o.PromoCodeId, &o.Discount, &o.PaymentId, &o.CheckoutURL,
+			&o.ExpiresAt, &o.CreatedAt, &o.PaidAt, &o.RefundedAt)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, &o)
+		byId[o.ID] = &o
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	query := `
+		SELECT i.order_id, i.id, i.ticket_type_id, i.user_id, i.unit_price, i.discount, i.answers, i.form_version, i.attendee_id
+		FROM order_items i
+		WHERE i.order_id IN (SELECT o.id ` + from + `)
+		ORDER BY i.id`
+	itemRows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var orderId int
+		var item OrderItem
+		var answers sql.NullString
+		err := itemRows.Scan(&orderId, &item.ID, &item.TicketTypeId, &item.UserId, &item.UnitPrice, &item.Discount, &answers, &item.FormVersion, &item.AttendeeId)
+		if err != nil {
+			return nil, err
+		}
+		if answers.Valid {
+			if err := json.Unmarshal([]byte(answers.String), &item.Answers); err != nil {
+				return nil, err
+			}
+		}
+		if o := byId[orderId]; o != nil {
+			o.Items = append(o.Items, &item)
+		}
+	}
+	return orders, itemRows.Err()
+}
+
+func (m *OrderModel) getOrder(where string, args ...any) (*Order, error) {
+	orders, err := m.queryOrders(where, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	return orders[0], nil
+}
+
+// Insert places an order with its items for an event of the tenant. The
+// items' ticket types, prices and availability must have been checked by
+// the caller in the same transaction.
+func (m *OrderModel) Insert(order *Order) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	order.CreatedAt = time.Now().UTC()
+	stmt := `
+		INSERT INTO orders (event_id, user_id, status, total, currency, promo_code_id, discount, expires_at, created_at)
+		SELECT e.id, $1, $2, $3, $4, $5, $6, $7, $8 FROM events e
+		WHERE e.id = $9 AND ` + tenantFilter(10) + `
+		RETURNING id`
+	err = tx.QueryRowContext(ctx, stmt, order.UserId, order.Status, order.Total, order.Currency, order.PromoCodeId, order.Discount,
+		order.ExpiresAt.UTC(), order.CreatedAt, order.EventId, m.OrgID).Scan(&order.ID)
+	if err == sql.ErrNoRows {
+		return ErrEventNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, item := range order.Items {
+		var answers any
+		if item.Answers != nil {
+			data, err := json.Marshal(item.Answers)
+			if err != nil {
+				return err
+			}
+			answers = string(data)
+		}
+		stmt := `
+			INSERT INTO order_items (order_id, ticket_type_id, user_id, unit_price, discount, answers, form_version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id`
+		err := tx.QueryRowContext(ctx, stmt, order.ID, item.TicketTypeId, item.UserId, item.UnitPrice, item.Discount, answers, item.FormVersion).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Get returns an order of the tenant, including orders of deleted events, or
+// ErrOrderNotFound.
+func (m *OrderModel) Get(id int) (*Order, error) {
+	return m.getOrder(`WHERE o.id = $1 AND `+inTenant(2), id, m.OrgID)
+}
+
+// GetByPayment returns the order paid by a payment of the payment provider,
+// or ErrOrderNotFound.
+func (m *OrderModel) GetByPayment(paymentId string) (*Order, error) {
+	return m.getOrder(`WHERE o.payment_id = $1 AND `+inTenant(2), paymentId, m.OrgID)
+}
+
+// GetForEvent lists the orders of an event of the tenant, newest first.
+func (m *OrderModel) GetForEvent(eventId int) ([]*Order, error) {
+	return m.queryOrders(`WHERE o.event_id = $1 AND `+tenantFilter(2), eventId, m.OrgID)
+}
+
+// GetByUser lists the orders a user placed in the tenant, newest first.
+func (m *OrderModel) GetByUser(userId int) ([]*Order, error) {
+	return m.queryOrders(`WHERE o.user_id = $1 AND `+inTenant(2), userId, m.OrgID)
+}
+
+// SetPayment records the payment started with the payment provider for a
+// pending order of the tenant.
+func (m *OrderModel) SetPayment(id int, paymentId, checkoutURL string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		UPDATE orders SET payment_id = $1, checkout_url = $2
+		WHERE id = $3 AND status = '` + OrderPending + `'
+			AND event_id IN (SELECT e.id FROM events e WHERE ` + inTenant(4) + `)`
+	res, err := m.DB.ExecContext(ctx, stmt, paymentId, checkoutURL, id, m.OrgID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// SetStatus moves an order of the tenant from one status to another, recording when it
+// was paid or refunded. It fails with ErrInvalidTransition if the order is
+// no longer in the from status, e.g. because a concurrent request moved it.
+func (m *OrderModel) SetStatus(id int, from, to string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		UPDATE orders
+		SET status = $1,
+			paid_at = CASE WHEN $1 = '` + OrderPaid + `' THEN $2 ELSE paid_at END,
+			refunded_at = CASE WHEN $1 = '` + OrderRefunded + `' THEN $2 ELSE refunded_at END
+		WHERE id = $3 AND status = $4
+			AND event_id IN (SELECT e.id FROM events e WHERE ` + inTenant(5) + `)`
+	res, err := m.DB.ExecContext(ctx, stmt, to, at.UTC(), id, from, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrInvalidTransition
+	}
+	return nil
+}
+
+// SetItemAttendee links an item of an order of the tenant to the RSVP
+// created for it.
+func (m *OrderModel) SetItemAttendee(itemId, attendeeId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		UPDATE order_items SET attendee_id = $1
+		WHERE id = $2 AND order_id IN (
+			SELECT o.id FROM orders o JOIN events e ON e.id = o.event_id WHERE ` + inTenant(3) + `
+		)`
+	res, err := m.DB.ExecContext(ctx, stmt, attendeeId, itemId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// ExpireDue expires every pending order of the tenant whose reservation ran
+// out before now, and returns their ids.
+func (m *OrderModel) ExpireDue(now time.Time) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE orders AS o
+		SET status = '` + OrderExpired + `'
+		WHERE o.status = '` + OrderPending + `' AND o.expires_at <= $1
+			AND o.event_id IN (SELECT e.id FROM events e WHERE ` + inTenant(2) + `)
+		RETURNING id`
+
+	rows, err := m.DB.QueryContext(ctx, query, now.UTC(), m.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CountReserved counts the tickets for an event of the tenant that pending
+// orders hold, which count against its capacity until they are paid or
+// expire.
+func (m *OrderModel) CountReserved(eventId int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*) FROM order_items i
+		JOIN orders o ON o.id = i.order_id
+		JOIN events e ON e.id = o.event_id
+		WHERE o.event_id = $1 AND o.status = '` + OrderPending + `' AND o.expires_at > $2 AND ` + inTenant(3)
+
+	var n int
+	err := m.DB.QueryRowContext(ctx, query, eventId, time.Now().UTC(), m.OrgID).Scan(&n)
+	return n, err
+}
+
+// HasReservation reports whether a pending order holds a ticket for the user
+// to an event of the tenant.
+func (m *OrderModel) HasReservation(eventId, userId int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM order_items i
+			JOIN orders o ON o.id = i.order_id
+			JOIN events e ON e.id = o.event_id
+			WHERE o.event_id = $1 AND i.user_id = $2 AND o.status = '` + OrderPending + `' AND o.expires_at > $3
+				AND ` + inTenant(4) + `
+		)`
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, eventId, userId, time.Now().UTC(), m.OrgID).Scan(&exists)
+	return exists, err
+}
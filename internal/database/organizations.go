@@ -0,0 +1,315 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type OrganizationModel struct {
+	DB DBTX
+}
+
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name" binding:"required,min=2"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Membership struct {
+	OrganizationId int    `json:"organizationId"`
+	UserId         int    `json:"userId"`
+	Role           string `json:"role"`
+	Name           string `json:"name,omitempty"`
+	Email          string `json:"email,omitempty"`
+}
+
+type Invitation struct {
+	ID             int        `json:"id"`
+	OrganizationId int        `json:"organizationId"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	InvitedBy      int        `json:"invitedBy"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	AcceptedAt     *time.Time `json:"acceptedAt,omitempty"`
+}
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// CanManage reports whether the member may manage the organization and
+// every event in it.
+func (m *Membership) CanManage() bool {
+	return m.Role == OrgRoleOwner || m.Role == OrgRoleAdmin
+}
+
+var ErrInvitationEmailMismatch = errors.New("Invitation was sent to a different email")
+
+// Insert creates the organization and makes ownerId its owner.
+func (m *OrganizationModel) Insert(org *Organization, ownerId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	org.CreatedAt = time.Now().UTC()
+	stmt := `INSERT INTO organizations (name, created_at) VALUES ($1, $2) RETURNING id`
+	if err := tx.QueryRowContext(ctx, stmt, org.Name, org.CreatedAt).Scan(&org.ID); err != nil {
+		return err
+	}
+
+	stmt = `INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, stmt, org.ID, ownerId, OrgRoleOwner); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *OrganizationModel) Get(id int) (*Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var org Organization
+	err := m.DB.QueryRowContext(ctx, `SELECT id, name, created_at FROM organizations WHERE id = $1`, id).Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (m *OrganizationModel) GetForUser(userId int) ([]*Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT o.id, o.name, o.created_at
+		FROM organizations o
+		JOIN organization_members om ON om.organization_id = o.id
+		WHERE om.user_id = $1
+		ORDER BY o.name
+	`
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+	for rows.Next() {
+		var org Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, &org)
+	}
+	return orgs, rows.Err()
+}
+
+func (m *OrganizationModel) GetMembership(orgId, userId int) (*Membership, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT organization_id, user_id, role
+		FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2
+	`
+	var membership Membership
+	err := m.DB.QueryRowContext(ctx, query, orgId, userId).Scan(&membership.OrganizationId, &membership.UserId, &membership.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (m *OrganizationModel) GetMembers(orgId int) ([]*Membership, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT om.organization_id, om.user_id, om.role, u.name, u.email
+		FROM organization_members om
+		JOIN users u ON u.id = om.user_id
+		WHERE om.organization_id = $1 AND u.deleted_at IS NULL
+		ORDER BY u.name
+	`
+	rows, err := m.DB.QueryContext(ctx, query, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Membership{}
+	for rows.Next() {
+		var member Membership
+		if err := rows.Scan(&member.OrganizationId, &member.UserId, &member.Role, &member.Name, &member.Email); err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	return members, rows.Err()
+}
+
+func (m *OrganizationModel) GetMembershipsForUser(userId int) ([]*Membership, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `SELECT organization_id, user_id, role FROM organization_members WHERE user_id = $1`
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []*Membership{}
+	for rows.Next() {
+		var membership Membership
+		if err := rows.Scan(&membership.OrganizationId, &membership.UserId, &membership.Role); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, &membership)
+	}
+	return memberships, rows.Err()
+}
+
+func (m *OrganizationModel) SetMemberRole(orgId, userId int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `UPDATE organization_members SET role = $1 WHERE organization_id = $2 AND user_id = $3`
+	res, err := m.DB.ExecContext(ctx, stmt, role, orgId, userId)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+func (m *OrganizationModel) RemoveMember(orgId, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2`
+	res, err := m.DB.ExecContext(ctx, stmt, orgId, userId)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// CreateInvitation stores an invitation; tokenHash is the hash of the token
+// emailed to the invitee.
+func (m *OrganizationModel) CreateInvitation(inv *Invitation, tokenHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO organization_invitations (organization_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	return m.DB.QueryRowContext(ctx, stmt, inv.OrganizationId, inv.Email, inv.Role, tokenHash, inv.InvitedBy, inv.ExpiresAt.UTC()).Scan(&inv.ID)
+}
+
+func (m *OrganizationModel) GetPendingInvitations(orgId int) ([]*Invitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, organization_id, email, role, invited_by, expires_at
+		FROM organization_invitations
+		WHERE organization_id = $1 AND accepted_at IS NULL AND expires_at > $2
+		ORDER BY id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, orgId, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		var inv Invitation
+		if err := rows.Scan(&inv.ID, &inv.OrganizationId, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, &inv)
+	}
+	return invitations, rows.Err()
+}
+
+func (m *OrganizationModel) DeleteInvitation(orgId, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `DELETE FROM organization_invitations WHERE organization_id = $1 AND id = $2 AND accepted_at IS NULL`
+	res, err := m.DB.ExecContext(ctx, stmt, orgId, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// AcceptInvitation adds user to the organization of the invitation matching
+// tokenHash. The invitation must have been sent to the user's email.
+func (m *OrganizationModel) AcceptInvitation(tokenHash string, user *User) (*Membership, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, organization_id, email, role
+		FROM organization_invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > $2
+	`
+	var inv Invitation
+	err = tx.QueryRowContext(ctx, query, tokenHash, time.Now().UTC()).Scan(&inv.ID, &inv.OrganizationId, &inv.Email, &inv.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if inv.Email != user.Email {
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	stmt := `
+		INSERT INTO organization_members (organization_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, user_id) DO NOTHING
+	`
+	if _, err := tx.ExecContext(ctx, stmt, inv.OrganizationId, user.ID, inv.Role); err != nil {
+		return nil, err
+	}
+
+	stmt = `UPDATE organization_invitations SET accepted_at = $1 WHERE id = $2`
+	if _, err := tx.ExecContext(ctx, stmt, time.Now().UTC(), inv.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return m.GetMembership(inv.OrganizationId, user.ID)
+}
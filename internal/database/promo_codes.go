@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// PromoCodeModel is scoped to a tenant the same way as EventModel: promo
+// codes are only visible through events of the model's organization.
+type PromoCodeModel struct {
+	DB    DBTX
+	OrgID int
+}
+
+// Discount types of promo codes.
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+// PromoCode discounts the tickets of an event, or only those of TicketTypeId
+// when it is set. Amount is a percentage for percent discounts and an amount
+// in the minor unit of Currency, off every ticket, for fixed ones. A code is
+// valid between StartsAt and EndsAt when they are set, for at most MaxUses
+// orders in total and MaxUsesPerUser orders of the same buyer.
+type PromoCode struct {
+	ID             int        `json:"id"`
+	EventId        int        `json:"eventId"`
+	TicketTypeId   *int       `json:"ticketTypeId,omitempty"`
+	Code           string     `json:"code" binding:"required,min=3,max=32"`
+	DiscountType   string     `json:"discountType" binding:"required,oneof=percent fixed" enums:"percent,fixed"`
+	Amount         int64      `json:"amount" binding:"required,min=1"`
+	Currency       string     `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	MaxUses        *int       `json:"maxUses,omitempty" binding:"omitempty,min=1"`
+	MaxUsesPerUser *int       `json:"maxUsesPerUser,omitempty" binding:"omitempty,min=1"`
+	StartsAt       *time.Time `json:"startsAt,omitempty"`
+	EndsAt         *time.Time `json:"endsAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	// Redemptions counts the paid orders that used the code and Reserved the
+	// pending ones that still hold their tickets; both count against the
+	// limits. DiscountGiven and Revenue sum the discounts and totals of the
+	// paid orders.
+	Redemptions   int   `json:"redemptions"`
+	Reserved      int   `json:"reserved"`
+	DiscountGiven int64 `json:"discountGiven"`
+	Revenue       int64 `json:"revenue"`
+}
+
+var (
+	ErrPromoCodeNotFound = notFoundError("promo code not found")
+	ErrPromoCodeInUse    = conflictError("conflict", "Orders were placed with this promo code; it can no longer be deleted")
+)
+
+// NormalizePromoCode returns the form promo codes are stored and looked up
+// in, so they can be typed in any case.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidAt reports whether the code can be redeemed at t.
+func (p *PromoCode) ValidAt(t time.Time) bool {
+	return (p.StartsAt == nil || !t.Before(*p.StartsAt)) && (p.EndsAt == nil || t.Before(*p.EndsAt))
+}
+
+// Discount returns how much the code takes off a ticket of the given type; 0
+// if it does not apply to the ticket.
+func (p *PromoCode) Discount(ticketType *TicketType) int64 {
+	if p.TicketTypeId != nil && *p.TicketTypeId != ticketType.ID {
+		return 0
+	}
+	if p.DiscountType == DiscountPercent {
+		return ticketType.Price * min(p.Amount, 100) / 100
+	}
+	if p.Currency != ticketType.Currency {
+		return 0
+	}
+	return min(p.Amount, ticketType.Price)
+}
+
+const promoCodeColumns = `p.id, p.event_id, p.ticket_type_id, p.code, p.discount_type, p.amount, COALESCE(p.currency, ''),
+	p.max_uses, p.max_uses_per_user, p.starts_at, p.ends_at, p.created_at`
+
+func (m *PromoCodeModel) queryPromoCodes(where string, args ...any) ([]*PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + promoCodeColumns + `,
+			COUNT(o.id) FILTER (WHERE o.status = '` + OrderPaid + `'),
+			COUNT(o.id) FILTER (WHERE o.status = '` + OrderPending + `' AND o.expires_at > $1),
+			COALESCE(SUM(o.discount) FILTER (WHERE o.status = '` + OrderPaid + `'), 0),
+			COALESCE(SUM(o.total) FILTER (WHERE o.status = '` + OrderPaid + `'), 0)
+		FROM promo_codes p
+		JOIN events e ON e.id = p.event_id
+		LEFT JOIN orders o ON o.promo_code_id = p.id
+		` + where + `
+		GROUP BY p.id
+		ORDER BY p.code`
+
+	rows, err := m.DB.QueryContext(ctx, query, append([]any{time.Now().UTC()}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []*PromoCode{}
+	for rows.Next() {
+		var p PromoCode
+		err := rows.Scan(&p.ID, &p.EventId, &p.TicketTypeId, &p.Code, &p.DiscountType, &p.Amount, &p.Currency,
+			&p.MaxUses, &p.MaxUsesPerUser, &p.StartsAt, &p.EndsAt, &p.CreatedAt,
+			&p.Redemptions, &p.Reserved, &p.DiscountGiven, &p.Revenue)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, &p)
+	}
+	return codes, rows.Err()
+}
+
+func (m *PromoCodeModel) getPromoCode(where string, args ...any) (*PromoCode, error) {
+	codes, err := m.queryPromoCodes(where, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, ErrPromoCodeNotFound
+	}
+	return codes[0], nil
+}
+
+// Insert adds a promo code to an event of the tenant. Codes are unique per
+// event.
+func (m *PromoCodeModel) Insert(p *PromoCode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	p.Code = NormalizePromoCode(p.Code)
+	p.CreatedAt = time.Now().UTC()
+	stmt := `
+		INSERT INTO promo_codes (event_id, ticket_type_id, code, discount_type, amount, currency, max_uses, max_uses_per_user, starts_at, ends_at, created_at)
+		SELECT e.id, $1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10 FROM events e
+		WHERE e.id = $11 AND ` + tenantFilter(12) + `
+		RETURNING id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, p.TicketTypeId, p.Code, p.DiscountType, p.Amount, p.Currency, p.MaxUses, p.MaxUsesPerUser,
+		p.StartsAt, p.EndsAt, p.CreatedAt, p.EventId, m.OrgID).Scan(&p.ID)
+	if err == sql.ErrNoRows {
+		return ErrEventNotFound
+	}
+	return err
+}
+
+// Get returns a promo code of an event of the tenant with its redemptions,
+// or ErrPromoCodeNotFound.
+func (m *PromoCodeModel) Get(eventId, id int) (*PromoCode, error) {
+	return m.getPromoCode(`WHERE p.id = $2 AND p.event_id = $3 AND `+tenantFilter(4), id, eventId, m.OrgID)
+}
+
+// GetByCode looks up a promo code of an event of the tenant as typed by a
+// buyer, or returns ErrPromoCodeNotFound.
+func (m *PromoCodeModel) GetByCode(eventId int, code string) (*PromoCode, error) {
+	return m.getPromoCode(`WHERE p.code = $2 AND p.event_id = $3 AND `+tenantFilter(4), NormalizePromoCode(code), eventId, m.OrgID)
+}
+
+// GetForEvent lists the promo codes of an event of the tenant with their
+// redemptions, by code.
+func (m *PromoCodeModel) GetForEvent(eventId int) ([]*PromoCode, error) {
+	return m.queryPromoCodes(`WHERE p.event_id = $2 AND `+tenantFilter(3), eventId, m.OrgID)
+}
+
+// CountUses counts the orders that hold a redemption of a promo code, paid or
+// pending, in total and of one buyer.
+func (m *PromoCodeModel) CountUses(id, userId int) (total, byUser int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE o.user_id = $1)
+		FROM orders o
+		WHERE o.promo_code_id = $2 AND ` + orderHolds(3)
+
+	err = m.DB.QueryRowContext(ctx, query, userId, id, time.Now().UTC()).Scan(&total, &byUser)
+	return total, byUser, err
+}
+
+// Update saves the discount, limits and validity window of a promo code.
+// Orders keep the discount they were placed with.
+func (m *PromoCodeModel) Update(p *PromoCode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	p.Code = NormalizePromoCode(p.Code)
+	stmt := `
+		UPDATE promo_codes
+		SET ticket_type_id = $1, code = $2, discount_type = $3, amount = $4, currency = NULLIF($5, ''),
+			max_uses = $6, max_uses_per_user = $7, starts_at = $8, ends_at = $9
+		WHERE id = $10 AND event_id IN (SELECT e.id FROM events e WHERE e.id = $11 AND ` + tenantFilter(12) + `)`
+
+	res, err := m.DB.ExecContext(ctx, stmt, p.TicketTypeId, p.Code, p.DiscountType, p.Amount, p.Currency, p.MaxUses, p.MaxUsesPerUser,
+		p.StartsAt, p.EndsAt, p.ID, p.EventId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrPromoCodeNotFound
+	}
+	return nil
+}
+
+// Delete removes a promo code. It fails with ErrPromoCodeInUse once orders,
+// including expired ones, have been placed with it.
+func (m *PromoCodeModel) Delete(eventId, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var used bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE promo_code_id = $1)`, id).Scan(&used); err != nil {
+		return err
+	}
+	if used {
+		return ErrPromoCodeInUse
+	}
+
+	stmt := `
+		DELETE FROM promo_codes
+		WHERE id = $1 AND event_id IN (SELECT e.id FROM events e WHERE e.id = $2 AND ` + tenantFilter(3) + `)`
+	res, err := tx.ExecContext(ctx, stmt, id, eventId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrPromoCodeNotFound
+	}
+	return tx.Commit()
+}
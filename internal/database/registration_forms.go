@@ -0,0 +1,265 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// RegistrationFormModel is scoped to a tenant the same way as EventModel:
+// forms and answers are only visible through events of the model's
+// organization.
+type RegistrationFormModel struct {
+	DB    DBTX
+	OrgID int
+}
+
+// Types of registration questions.
+const (
+	QuestionText         = "text"
+	QuestionSingleChoice = "single_choice"
+	QuestionMultiChoice  = "multi_choice"
+	QuestionCheckbox     = "checkbox"
+)
+
+// Question is asked when registering for an event. Key identifies the
+// question in answers and stays the same across form versions; Options are
+// the choices of choice questions.
+type Question struct {
+	Key      string   `json:"key" binding:"required,max=50"`
+	Label    string   `json:"label" binding:"required,max=200"`
+	Type     string   `json:"type" binding:"required,oneof=text single_choice multi_choice checkbox" enums:"text,single_choice,multi_choice,checkbox"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty" binding:"max=50,dive,required,max=100"`
+}
+
+// RegistrationForm is a version of the questions of an event. Responses
+// counts the attendees who answered this version.
+type RegistrationForm struct {
+	EventId   int        `json:"eventId"`
+	Version   int        `json:"version"`
+	Questions []Question `json:"questions" binding:"max=50,dive"`
+	ChangedBy *int       `json:"changedBy,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	Responses int        `json:"responses"`
+}
+
+// Question returns the question with the given key, or nil.
+func (f *RegistrationForm) Question(key string) *Question {
+	for i := range f.Questions {
+		if f.Questions[i].Key == key {
+			return &f.Questions[i]
+		}
+	}
+	return nil
+}
+
+// Answers maps question keys to answers: a string for text and single choice
+// questions, a list of strings for multi choice ones and a boolean for
+// checkboxes.
+type Answers map[string]any
+
+// RegistrationAnswers are the answers of an attendee to the form version
+// they registered with.
+type RegistrationAnswers struct {
+	EventId     int       `json:"eventId"`
+	UserId      int       `json:"userId"`
+	Name        string    `json:"name,omitempty"`
+	Email       string    `json:"email,omitempty"`
+	FormVersion int       `json:"formVersion"`
+	Answers     Answers   `json:"answers"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+var ErrRegistrationFormNotFound = notFoundError("registration form not found")
+
+// formResponses counts the attendees who answered version f.version of a
+// form, and orderResponses the tickets of pending orders that did.
+const formResponses = `(SELECT COUNT(*) FROM registration_answers a WHERE a.event_id = f.event_id AND a.form_version = f.version)`
+
+const orderResponses = `(SELECT COUNT(*) FROM order_items i JOIN orders o ON o.id = i.order_id
+	WHERE o.event_id = f.event_id AND i.form_version = f.version AND o.status = '` + OrderPending + `')`
+
+func (m *RegistrationFormModel) queryForms(where string, args ...any) ([]*RegistrationForm, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT f.event_id, f.version, f.questions, f.changed_by, f.updated_at, ` + formResponses + `
+		FROM registration_forms f
+		JOIN events e ON e.id = f.event_id
+		` + where
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	forms := []*RegistrationForm{}
+	for rows.Next() {
+		var f RegistrationForm
+		var questions string
+		if err := rows.Scan(&f.EventId, &f.Version, &questions, &f.ChangedBy, &f.UpdatedAt, &f.Responses); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(questions), &f.Questions); err != nil {
+			return nil, err
+		}
+		forms = append(forms, &f)
+	}
+	return forms, rows.Err()
+}
+
+// Get returns a version of the form of an event of the tenant, the current
+// one when version is 0, or ErrRegistrationFormNotFound.
+func (m *RegistrationFormModel) Get(eventId, version int) (*RegistrationForm, error) {
+	forms, err := m.queryForms(`
+		WHERE f.event_id = $1 AND ($2 = 0 OR f.version = $2) AND `+tenantFilter(3)+`
+		ORDER BY f.version DESC
+		LIMIT 1`, eventId, version, m.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(forms) == 0 {
+		return nil, ErrRegistrationFormNotFound
+	}
+	return forms[0], nil
+}
+
+// GetVersions lists every version of the form of an event of the tenant,
+// oldest first.
+func (m *RegistrationFormModel) GetVersions(eventId int) ([]*RegistrationForm, error) {
+	return m.queryForms(`WHERE f.event_id = $1 AND `+tenantFilter(2)+` ORDER BY f.version`, eventId, m.OrgID)
+}
+
+// Save stores the questions of the form of an event of the tenant. The
+// current version is changed in place until someone answers it; after that
+// a new version is added, so earlier answers keep the questions they were
+// given for. form.Version is set to the version saved.
+func (m *RegistrationFormModel) Save(form *RegistrationForm) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	questions, err := json.Marshal(form.Questions)
+	if err != nil {
+		return err
+	}
+	form.UpdatedAt = time.Now().UTC()
+
+	var version, responses int
+	query := `
+		SELECT f.version, ` + formResponses + ` + ` + orderResponses + `
+		FROM registration_forms f
+		JOIN events e ON e.id = f.event_id
+		WHERE f.event_id = $1 AND ` + tenantFilter(2) + `
+		ORDER BY f.version DESC
+		LIMIT 1`
+	err = tx.QueryRowContext(ctx, query, form.EventId, m.OrgID).Scan(&version, &responses)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if version > 0 && responses == 0 {
+		stmt := `UPDATE registration_forms SET questions = $1, changed_by = $2, updated_at = $3 WHERE event_id = $4 AND version = $5`
+		if _, err := tx.ExecContext(ctx, stmt, string(questions), form.ChangedBy, form.UpdatedAt, form.EventId, version); err != nil {
+			return err
+		}
+		form.Version = version
+		form.Responses = 0
+		return tx.Commit()
+	}
+
+	stmt := `
+		INSERT INTO registration_forms (event_id, version, questions, changed_by, updated_at)
+		SELECT e.id, $1, $2, $3, $4 FROM events e
+		WHERE e.id = $5 AND ` + tenantFilter(6)
+	res, err := tx.ExecContext(ctx, stmt, version+1, string(questions), form.ChangedBy, form.UpdatedAt, form.EventId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrEventNotFound
+	}
+	form.Version = version + 1
+	form.Responses = 0
+	return tx.Commit()
+}
+
+// SaveAnswers stores the answers of an attendee of an event of the tenant,
+// replacing earlier ones.
+func (m *RegistrationFormModel) SaveAnswers(a *RegistrationAnswers) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	answers, err := json.Marshal(a.Answers)
+	if err != nil {
+		return err
+	}
+	a.CreatedAt = time.Now().UTC()
+	stmt := `
+		INSERT INTO registration_answers (event_id, user_id, form_version, answers, created_at)
+		SELECT e.id, $1, $2, $3, $4 FROM events e
+		WHERE e.id = $5 AND ` + tenantFilter(6) + `
+		ON CONFLICT (event_id, user_id) DO UPDATE
+		SET form_version = excluded.form_version, answers = excluded.answers, created_at = excluded.created_at`
+	res, err := m.DB.ExecContext(ctx, stmt, a.UserId, a.FormVersion, string(answers), a.CreatedAt, a.EventId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrEventNotFound
+	}
+	return nil
+}
+
+func (m *RegistrationFormModel) queryAnswers(where string, args ...any) ([]*RegistrationAnswers, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT a.event_id, a.user_id, u.name, u.email, a.form_version, a.answers, a.created_at
+		FROM registration_answers a
+		JOIN events e ON e.id = a.event_id
+		JOIN users u ON u.id = a.user_id
+		` + where + `
+		ORDER BY a.created_at, a.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := []*RegistrationAnswers{}
+	for rows.Next() {
+		var a RegistrationAnswers
+		var answers string
+		if err := rows.Scan(&a.EventId, &a.UserId, &a.Name, &a.Email, &a.FormVersion, &answers, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(answers), &a.Answers); err != nil {
+			return nil, err
+		}
+		all = append(all, &a)
+	}
+	return all, rows.Err()
+}
+
+// GetAnswers lists the answers of the attendees of an event of the tenant,
+// in the order they registered.
+func (m *RegistrationFormModel) GetAnswers(eventId int) ([]*RegistrationAnswers, error) {
+	return m.queryAnswers(`WHERE a.event_id = $1 AND `+tenantFilter(2), eventId, m.OrgID)
+}
+
+// GetAnswersByUser lists the answers a user gave for events of the tenant.
+func (m *RegistrationFormModel) GetAnswersByUser(userId int) ([]*RegistrationAnswers, error) {
+	return m.queryAnswers(`WHERE a.user_id = $1 AND `+tenantFilter(2), userId, m.OrgID)
+}
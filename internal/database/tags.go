@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TagModel manages the free-form tags of events. Tag names are shared by
+// every tenant; NormalizeTag is applied before they are stored.
+type TagModel struct {
+	DB    DBTX
+	OrgID int
+}
+
+// TagCount is a tag with the number of events carrying it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTag lower-cases a tag and collapses its whitespace, so "Go  Lang"
+// and "go lang" are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// NormalizeTags normalizes tags, drops empty and duplicate ones and sorts
+// the rest.
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// splitTags parses the comma-separated tag list selected by eventColumns.
+func splitTags(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	tags := strings.Split(s, ",")
+	sort.Strings(tags)
+	return tags
+}
+
+// SetForEvent replaces the tags of an event with tags, which must be
+// normalized.
+func (m *TagModel) SetForEvent(eventId int, tags []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM event_tags WHERE event_id = $1`, eventId); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, tag); err != nil {
+			return err
+		}
+		stmt := `INSERT INTO event_tags (event_id, tag_id) SELECT $1, id FROM tags WHERE name = $2`
+		if _, err := tx.ExecContext(ctx, stmt, eventId, tag); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Autocomplete returns the tags starting with prefix that are used by events
+// of the tenant viewerId may see, most used first.
+func (m *TagModel) Autocomplete(prefix string, limit, viewerId int) ([]*TagCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	prefix = NormalizeTag(prefix)
+	query := `
+		SELECT t.name, COUNT(*) AS n
+		FROM tags t
+		JOIN event_tags et ON et.tag_id = t.id
+		JOIN events e ON e.id = et.event_id
+		WHERE substr(t.name, 1, length($1)) = $1 AND ` + tenantFilter(2) + ` AND ` + visibleTo(3) + `
+		GROUP BY t.id
+		ORDER BY n DESC, t.name
+		LIMIT $4`
+
+	rows, err := m.DB.QueryContext(ctx, query, prefix, m.OrgID, viewerId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+	return tags, rows.Err()
+}
+
+// TagMerge is the outcome of merging tags. Events is the number of events
+// that were retagged.
+type TagMerge struct {
+	From   []string `json:"from"`
+	Into   string   `json:"into"`
+	IntoId int      `json:"-"`
+	Events int64    `json:"events"`
+}
+
+// Merge moves every event tagged with one of from over to the tag into,
+// creating it if needed, and deletes the tags in from. Renaming a tag is
+// merging it into its new name. The version of the retagged events is
+// incremented. Tags are site-wide, so this is not scoped to a tenant.
+func (m *TagModel) Merge(from []string, into string) (*TagMerge, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	merge := &TagMerge{From: NormalizeTags(from), Into: NormalizeTag(into)}
+	into = merge.Into
+	if _, err := tx.ExecContext(ctx, `INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, into); err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE name = $1`, into).Scan(&merge.IntoId); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, tag := range merge.From {
+		var id int
+		err := tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE name = $1`, tag).Scan(&id)
+		if err == sql.ErrNoRows || id == merge.IntoId {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, strconv.Itoa(id))
+	}
+	if len(ids) == 0 {
+		return merge, tx.Commit()
+	}
+	fromIds := strings.Join(ids, ", ")
+
+	res, err := tx.ExecContext(ctx, `UPDATE events SET version = version + 1 WHERE id IN (SELECT event_id FROM event_tags WHERE tag_id IN (`+fromIds+`))`)
+	if err != nil {
+		return nil, err
+	}
+	merge.Events, err = res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	stmts := []string{
+		`INSERT INTO event_tags (event_id, tag_id)
+			SELECT DISTINCT event_id, ` + strconv.Itoa(merge.IntoId) + ` FROM event_tags WHERE tag_id IN (` + fromIds + `)
+			ON CONFLICT (event_id, tag_id) DO NOTHING`,
+		`DELETE FROM event_tags WHERE tag_id IN (` + fromIds + `)`,
+		`DELETE FROM tags WHERE id IN (` + fromIds + `)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	return merge, tx.Commit()
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TicketTypeModel is scoped to a tenant the same way as EventModel: ticket
+// types are only visible through events of the model's organization.
+type TicketTypeModel struct {
+	DB    DBTX
+	OrgID int
+}
+
+// TicketType is a kind of ticket sold for an event. Price is in the minor
+// unit of Currency, e.g. cents; free tickets cost 0. Tickets are on sale
+// between SaleStartsAt and SaleEndsAt when they are set.
+type TicketType struct {
+	ID           int        `json:"id"`
+	EventId      int        `json:"eventId"`
+	Name         string     `json:"name" binding:"required,max=100"`
+	Price        int64      `json:"price" binding:"min=0"`
+	Currency     string     `json:"currency" binding:"required,iso4217"`
+	Quantity     int        `json:"quantity" binding:"required,min=1"`
+	SaleStartsAt *time.Time `json:"saleStartsAt,omitempty"`
+	SaleEndsAt   *time.Time `json:"saleEndsAt,omitempty"`
+	// Available is how many tickets are left: Quantity minus the tickets of
+	// paid orders and of pending orders that still hold their reservation.
+	Available int       `json:"available"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OnSale reports whether the ticket type can be bought at t.
+func (t *TicketType) OnSale(at time.Time) bool {
+	return (t.SaleStartsAt == nil || !at.Before(*t.SaleStartsAt)) && (t.SaleEndsAt == nil || at.Before(*t.SaleEndsAt))
+}
+
+var (
+	ErrTicketTypeNotFound = notFoundError("ticket type not found")
+	ErrTicketTypeInUse    = conflictError("conflict", "Orders or promo codes refer to this ticket type; it can no longer be deleted")
+)
+
+// ticketsTaken counts the tickets of ticket type tt that are sold or
+// reserved; it expects the current time as the query parameter with the
+// given index.
+func ticketsTaken(param int) string {
+	return `(SELECT COUNT(*) FROM order_items i JOIN orders o ON o.id = i.order_id
+		WHERE i.ticket_type_id = tt.id AND ` + orderHolds(param) + `)`
+}
+
+const ticketTypeColumns = `tt.id, tt.event_id, tt.name, tt.price, tt.currency, tt.quantity, tt.sale_starts_at, tt.sale_ends_at, tt.created_at`
+
+func (m *TicketTypeModel) queryTicketTypes(where string, args ...any) ([]*TicketType, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + ticketTypeColumns + `, tt.quantity - ` + ticketsTaken(1) + `
+		FROM ticket_types tt
+		JOIN events e ON e.id = tt.event_id
+		` + where + `
+		ORDER BY tt.price, tt.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, append([]any{time.Now().UTC()}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ticketTypes := []*TicketType{}
+	for rows.Next() {
+		var t TicketType
+		err := rows.Scan(&t.ID, &t.EventId, &t.Name, &t.Price, &t.Currency, &t.Quantity, &t.SaleStartsAt, &t.SaleEndsAt, &t.CreatedAt, &t.Available)
+		if err != nil {
+			return nil, err
+		}
+		ticketTypes = append(ticketTypes, &t)
+	}
+	return ticketTypes, rows.Err()
+}
+
+// Insert adds a ticket type to an event of the tenant.
+func (m *TicketTypeModel) Insert(t *TicketType) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	t.CreatedAt = time.Now().UTC()
+	stmt := `
+		INSERT INTO ticket_types (event_id, name, price, currency, quantity, sale_starts_at, sale_ends_at, created_at)
+		SELECT e.id, $1, $2, $3, $4, $5, $6, $7 FROM events e
+		WHERE e.id = $8 AND ` + tenantFilter(9) + `
+		RETURNING id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, t.Name, t.Price, t.Currency, t.Quantity, t.SaleStartsAt, t.SaleEndsAt, t.CreatedAt,
+		t.EventId, m.OrgID).Scan(&t.ID)
+	if err == sql.ErrNoRows {
+		return ErrEventNotFound
+	}
+	if err != nil {
+		return err
+	}
+	t.Available = t.Quantity
+	return nil
+}
+
+// Get returns a ticket type of an event of the tenant, or
+// ErrTicketTypeNotFound.
+func (m *TicketTypeModel) Get(eventId, id int) (*TicketType, error) {
+	ticketTypes, err := m.queryTicketTypes(`WHERE tt.id = $2 AND tt.event_id = $3 AND `+tenantFilter(4), id, eventId, m.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ticketTypes) == 0 {
+		return nil, ErrTicketTypeNotFound
+	}
+	return ticketTypes[0], nil
+}
+
+// GetForEvent lists the ticket types of an event of the tenant, cheapest
+// first.
+func (m *TicketTypeModel) GetForEvent(eventId int) ([]*TicketType, error) {
+	return m.queryTicketTypes(`WHERE tt.event_id = $2 AND `+tenantFilter(3), eventId, m.OrgID)
+}
+
+// Update saves the name, price, quantity and sale window of a ticket type.
+// Orders keep the price they were placed at.
+func (m *TicketTypeModel) Update(t *TicketType) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		UPDATE ticket_types
+		SET name = $1, price = $2, currency = $3, quantity = $4, sale_starts_at = $5, sale_ends_at = $6
+		WHERE id = $7 AND event_id IN (SELECT e.id FROM events e WHERE e.id = $8 AND ` + tenantFilter(9) + `)`
+
+	res, err := m.DB.ExecContext(ctx, stmt, t.Name, t.Price, t.Currency, t.Quantity, t.SaleStartsAt, t.SaleEndsAt, t.ID, t.EventId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrTicketTypeNotFound
+	}
+	return nil
+}
+
+// Delete removes a ticket type. It fails with ErrTicketTypeInUse once
+// orders, including expired ones, have been placed for it, or while promo
+// codes are restricted to it.
+func (m *TicketTypeModel) Delete(eventId, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var used bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM order_items WHERE ticket_type_id = $1) OR EXISTS (SELECT 1 FROM promo_codes WHERE ticket_type_id = $1)`, id).Scan(&used); err != nil {
+		return err
+	}
+	if used {
+		return ErrTicketTypeInUse
+	}
+
+	stmt := `
+		DELETE FROM ticket_types
+		WHERE id = $1 AND event_id IN (SELECT e.id FROM events e WHERE e.id = $2 AND ` + tenantFilter(3) + `)`
+	res, err := tx.ExecContext(ctx, stmt, id, eventId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrTicketTypeNotFound
+	}
+	return tx.Commit()
+}
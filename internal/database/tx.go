@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// maxTxAttempts is how many times Models.WithTx runs a transaction that
+// fails because the database is busy.
+const maxTxAttempts = 5
+
+// txRetryDelay is the wait before the first retry; it doubles on every
+// attempt.
+const txRetryDelay = 20 * time.Millisecond
+
+// DBTX is what models run their queries on: the database itself, or a
+// transaction started by Models.WithTx.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Tx is a transaction that may be nested in an outer one.
+type Tx interface {
+	DBTX
+	Commit() error
+	Rollback() error
+}
+
+// beginTx starts a transaction on db. When db already is a transaction the
+// statements join it, and committing or rolling back is left to its owner.
+func beginTx(ctx context.Context, db DBTX) (Tx, error) {
+	switch db := db.(type) {
+	case *sql.DB:
+		return db.BeginTx(ctx, nil)
+	case *sql.Tx:
+		return nestedTx{db}, nil
+	default:
+		return nil, errors.New("database: cannot begin a transaction")
+	}
+}
+
+type nestedTx struct {
+	*sql.Tx
+}
+
+func (nestedTx) Commit() error   { return nil }
+func (nestedTx) Rollback() error { return nil }
+
+// isBusy reports whether err means another connection holds a lock SQLite
+// gave up waiting for.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// isUniqueViolation reports whether err is a UNIQUE constraint failure.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
@@ -3,42 +3,84 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 )
 
 type UserModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 type User struct {
-	ID       int    `json:"id"`
-	Email    string `json:"email"`
-	Name     string `json:"name"`
-	Password string `json:"-"`
+	ID           int        `json:"id"`
+	Email        string     `json:"email"`
+	Name         string     `json:"name"`
+	Password     string     `json:"-"`
+	AvatarURL    string     `json:"avatarUrl"`
+	Bio          string     `json:"bio"`
+	TimeZone     string     `json:"timeZone"`
+	PendingEmail string     `json:"pendingEmail,omitempty"`
+	Role         string     `json:"role"`
+	AnonymizedAt *time.Time `json:"anonymizedAt,omitempty"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	// Invited is set for accounts created for someone else, e.g. by an
+	// attendee import, until the invitation is accepted with a password.
+	Invited bool `json:"invited,omitempty"`
+	// EventReminders is whether the user is reminded of the events they
+	// attend; new accounts are until they opt out.
+	EventReminders bool `json:"eventReminders"`
 }
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+var ErrInvalidToken = errors.New("Invalid or expired token")
+
+const userColumns = `id, COALESCE(deleted_email, email), name, password, avatar_url, bio, time_zone, event_reminders, COALESCE(pending_email, ''), role, anonymized_at, deleted_at`
+
 func (m *UserModel) Insert(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	if user.TimeZone == "" {
+		user.TimeZone = "UTC"
+	}
+	if user.Role == "" {
+		user.Role = RoleUser
+	}
+	user.EventReminders = true
+
 	stmt := `
-		INSERT INTO users (name, email, password)
-		VALUES ($1, $2, $3)
-		RETURNING id;	
+		INSERT INTO users (name, email, password, avatar_url, bio, time_zone, role)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id;
 	`
-	err := m.DB.QueryRowContext(ctx, stmt, user.Name, user.Email, user.Password).Scan(&user.ID)
+	err := m.DB.QueryRowContext(ctx, stmt, user.Name, user.Email, user.Password, user.AvatarURL, user.Bio, user.TimeZone, user.Role).Scan(&user.ID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func scanUser(row rowScanner, user *User) error {
+	err := row.Scan(&user.ID, &user.Email, &user.Name, &user.Password, &user.AvatarURL, &user.Bio, &user.TimeZone, &user.EventReminders, &user.PendingEmail, &user.Role, &user.AnonymizedAt, &user.DeletedAt)
+	user.Invited = user.Password == "" && user.AnonymizedAt == nil
+	return err
+}
+
 func (m *UserModel) getUser(query string, args ...interface{}) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var user User
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.Email, &user.Name, &user.Password)
+	err := scanUser(m.DB.QueryRowContext(ctx, query, args...), &user)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -50,11 +92,531 @@ func (m *UserModel) getUser(query string, args ...interface{}) (*User, error) {
 }
 
 func (m *UserModel) Get(id int) (*User, error) {
-	query := `SELECT * FROM users WHERE id = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
 	return m.getUser(query, id)
 }
 
 func (m *UserModel) GetByEmail(email string) (*User, error) {
-	query := `SELECT * FROM users WHERE email = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1 AND deleted_at IS NULL`
 	return m.getUser(query, email)
 }
+
+// FindByEmail looks a user up by email ignoring case, as lists typed by
+// hand often differ in it. An exact match wins over others.
+func (m *UserModel) FindByEmail(email string) (*User, error) {
+	query := `
+		SELECT ` + userColumns + ` FROM users
+		WHERE email = $1 COLLATE NOCASE AND deleted_at IS NULL
+		ORDER BY email = $1 DESC
+		LIMIT 1`
+	return m.getUser(query, email)
+}
+
+// InsertInvited adds an account without a password for someone who hasn't
+// signed up yet. It can't be claimed until SetInviteToken gives it a token.
+func (m *UserModel) InsertInvited(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	user.Password = ""
+	user.TimeZone = "UTC"
+	user.Role = RoleUser
+	user.EventReminders = true
+	user.Invited = true
+	stmt := `
+		INSERT INTO users (name, email, password, time_zone, role)
+		VALUES ($1, $2, '', $3, $4)
+		RETURNING id
+	`
+	return m.DB.QueryRowContext(ctx, stmt, user.Name, user.Email, user.TimeZone, user.Role).Scan(&user.ID)
+}
+
+// SetInviteToken replaces the token an invited account is claimed with.
+// tokenHash is the hash of the token, never the token itself. It fails with
+// ErrNoRowsAffected once the account was claimed, anonymized or deleted.
+func (m *UserModel) SetInviteToken(id int, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE users
+		SET invite_token = $1, invite_token_expires_at = $2
+		WHERE id = $3 AND password = '' AND anonymized_at IS NULL AND deleted_at IS NULL
+	`
+	result, err := m.DB.ExecContext(ctx, stmt, tokenHash, expiresAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+// AcceptInvite sets the password of the invited account owning tokenHash,
+// which can log in from then on.
+func (m *UserModel) AcceptInvite(tokenHash, passwordHash string) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE users
+		SET password = $1, invite_token = NULL, invite_token_expires_at = NULL
+		WHERE invite_token = $2 AND invite_token_expires_at > $3 AND deleted_at IS NULL
+		RETURNING id
+	`
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, stmt, passwordHash, tokenHash, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	return m.Get(id)
+}
+
+func (m *UserModel) UpdateProfile(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE users
+		SET name = $1, avatar_url = $2, bio = $3, time_zone = $4, event_reminders = $5
+		WHERE id = $6
+	`
+
+	res, err := m.DB.ExecContext(ctx, stmt, user.Name, user.AvatarURL, user.Bio, user.TimeZone, user.EventReminders, user.ID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+func (m *UserModel) UpdatePassword(id int, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `UPDATE users SET password = $1 WHERE id = $2`
+
+	res, err := m.DB.ExecContext(ctx, stmt, passwordHash, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// RequestEmailChange stores the new address as pending until the token sent
+// to it is confirmed. tokenHash is the hash of the token, never the token itself.
+func (m *UserModel) RequestEmailChange(id int, email, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE users
+		SET pending_email = $1, email_token = $2, email_token_expires_at = $3
+		WHERE id = $4
+	`
+
+	res, err := m.DB.ExecContext(ctx, stmt, email, tokenHash, expiresAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// ConfirmEmailChange swaps the pending email in for the user owning tokenHash.
+func (m *UserModel) ConfirmEmailChange(tokenHash string) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, email_token = NULL, email_token_expires_at = NULL
+		WHERE email_token = $1 AND pending_email IS NOT NULL AND email_token_expires_at > $2
+		RETURNING id
+	`
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, stmt, tokenHash, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	return m.Get(id)
+}
+
+// What happens to the events owned by a deleted account.
+const (
+	// OwnedEventsTransfer hands them over to another user.
+	OwnedEventsTransfer = "transfer"
+	// OwnedEventsCancel cancels published events, which stay visible with
+	// their attendees, also after the account is purged. Drafts nobody has
+	// seen are deleted with the account.
+	OwnedEventsCancel = "cancel"
+	// OwnedEventsCascade deletes them together with the account.
+	OwnedEventsCascade = "cascade"
+)
+
+// ErrTransferNotMember is returned by Delete when the user events are
+// transferred to is not a member of an organization they belong to.
+var ErrTransferNotMember = conflictError("conflict", "The new owner must be a member of every organization the events and venues belong to")
+
+// ErrEmailTaken is returned by Restore when another account signed up with
+// the email of the deleted user in the meantime.
+var ErrEmailTaken = conflictError("already_exists", "Another account uses the email of this user now")
+
+// AccountDeletion lists the events and venues Delete changed, by id.
+type AccountDeletion struct {
+	TransferredEvents []int
+	TransferredVenues []int
+	CancelledEvents   []int
+	DeletedEvents     []int
+}
+
+// Delete soft-deletes a user. Events owned by the user are dealt with as
+// ownedEvents says; venues are handed over to transferTo when transferring
+// and stay the user's otherwise. Events and venues of an organization can
+// only be transferred to one of its members. The email is freed for new
+// accounts. RSVPs and memberships are kept until the user is purged, so the
+// account can be restored in the meantime.
+func (m *UserModel) Delete(id int, ownedEvents string, transferTo int) (*AccountDeletion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var deletion AccountDeletion
+
+	switch ownedEvents {
+	case OwnedEventsTransfer:
+		// Organizations the events and venues belong to that the new owner
+		// is not a member of.
+		query := `
+			SELECT EXISTS (
+				SELECT organization_id FROM events WHERE owner_id = $1
+				UNION
+				SELECT organization_id FROM venues WHERE owner_id = $1
+				EXCEPT
+				SELECT organization_id FROM organization_members WHERE user_id = $2
+				EXCEPT
+				SELECT NULL
+			)
+		`
+		var notMember bool
+		if err := tx.QueryRowContext(ctx, query, id, transferTo).Scan(&notMember); err != nil {
+			return nil, err
+		}
+		if notMember {
+			return nil, ErrTransferNotMember
+		}
+
+		if deletion.TransferredEvents, err = queryIds(ctx, tx, `UPDATE events SET owner_id = $1, version = version + 1 WHERE owner_id = $2 RETURNING id`, transferTo, id); err != nil {
+			return nil, err
+		}
+		if deletion.TransferredVenues, err = queryIds(ctx, tx, `UPDATE venues SET owner_id = $1 WHERE owner_id = $2 RETURNING id`, transferTo, id); err != nil {
+			return nil, err
+		}
+	case OwnedEventsCancel:
+		stmt := `UPDATE events SET status = $1, version = version + 1 WHERE owner_id = $2 AND status = $3 AND deleted_at IS NULL RETURNING id`
+		if deletion.CancelledEvents, err = queryIds(ctx, tx, stmt, StatusCancelled, id, StatusPublished); err != nil {
+			return nil, err
+		}
+		stmt = `UPDATE events SET deleted_at = $1, version = version + 1 WHERE owner_id = $2 AND status = $3 AND deleted_at IS NULL RETURNING id`
+		if deletion.DeletedEvents, err = queryIds(ctx, tx, stmt, now, id, StatusDraft); err != nil {
+			return nil, err
+		}
+	case OwnedEventsCascade:
+		stmt := `UPDATE events SET deleted_at = $1, version = version + 1 WHERE owner_id = $2 AND deleted_at IS NULL RETURNING id`
+		if deletion.DeletedEvents, err = queryIds(ctx, tx, stmt, now, id); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown ownedEvents %q", ownedEvents)
+	}
+
+	stmt := `
+		UPDATE users
+		SET deleted_at = $1, deleted_email = email, email = 'deleted-' || id || '@deleted.invalid'
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+	res, err := tx.ExecContext(ctx, stmt, now, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// queryIds runs a query returning a single column of ids.
+func queryIds(ctx context.Context, db DBTX, query string, args ...any) ([]int, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetDeleted returns a user deleted after since.
+func (m *UserModel) GetDeleted(id int, since time.Time) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at > $2`
+	return m.getUser(query, id, since.UTC())
+}
+
+// Restore undeletes a user deleted after since, together with the events
+// that were deleted with the account.
+func (m *UserModel) Restore(id int, since time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	err = tx.QueryRowContext(ctx, `SELECT deleted_at FROM users WHERE id = $1 AND deleted_at > $2`, id, since.UTC()).Scan(&deletedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNoRowsAffected
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE events SET deleted_at = NULL, version = version + 1 WHERE owner_id = $1 AND deleted_at = $2`, id, deletedAt); err != nil {
+		return err
+	}
+
+	stmt := `
+		UPDATE users SET deleted_at = NULL, email = deleted_email, deleted_email = NULL
+		WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM users WHERE email = (SELECT deleted_email FROM users WHERE id = $1))
+	`
+	res, err := tx.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrEmailTaken
+	}
+
+	return tx.Commit()
+}
+
+// GetAll lists every user, including deleted users when includeDeleted is set.
+func (m *UserModel) GetAll(includeDeleted bool) ([]*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE ($1 OR deleted_at IS NULL) ORDER BY id`
+	rows, err := m.DB.QueryContext(ctx, query, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+// UserPurge lists the users Purge removed and the events and venues it
+// removed with them, by id.
+type UserPurge struct {
+	Users  []int
+	Events []int
+	Venues []int
+}
+
+// Purge hard-deletes the users deleted before the given time together with
+// their RSVPs, registration answers, memberships, the deleted events they own and
+// their personal venues, and returns what it removed. Events
+// cancelled when the account was deleted stay. Other events booked at those venues
+// lose their booking. Files they uploaded to other events stay, without their
+// uploader, and so do orders they placed for other events, without their
+// buyer.
+func (m *UserModel) Purge(before time.Time) (*UserPurge, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var purge UserPurge
+
+	purged := `SELECT id FROM users WHERE deleted_at <= $1`
+	owned := `SELECT id FROM events WHERE owner_id IN (` + purged + `) AND deleted_at IS NOT NULL`
+	ownedVenues := `SELECT id FROM venues WHERE organization_id IS NULL AND owner_id IN (` + purged + `)`
+	stmts := []string{
+		`DELETE FROM attendees WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM event_organizers WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM event_invite_links WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM event_revisions WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM event_tags WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM order_items WHERE order_id IN (SELECT id FROM orders WHERE event_id IN (` + owned + `))`,
+		`DELETE FROM orders WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM promo_codes WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM ticket_types WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM registration_answers WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM registration_forms WHERE event_id IN (` + owned + `)`,
+		`DELETE FROM event_reminders WHERE event_id IN (` + owned + `)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt, before.UTC()); err != nil {
+			return nil, err
+		}
+	}
+	if purge.Events, err = queryIds(ctx, tx, `DELETE FROM events WHERE id IN (`+owned+`) RETURNING id`, before.UTC()); err != nil {
+		return nil, err
+	}
+
+	stmts = []string{
+		`UPDATE events SET venue_id = NULL, room_id = NULL, version = version + 1 WHERE venue_id IN (` + ownedVenues + `)`,
+		`DELETE FROM rooms WHERE venue_id IN (` + ownedVenues + `)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt, before.UTC()); err != nil {
+			return nil, err
+		}
+	}
+	if purge.Venues, err = queryIds(ctx, tx, `DELETE FROM venues WHERE id IN (`+ownedVenues+`) RETURNING id`, before.UTC()); err != nil {
+		return nil, err
+	}
+
+	stmts = []string{
+		`UPDATE venues SET owner_id = NULL WHERE owner_id IN (` + purged + `)`,
+		`UPDATE event_files SET uploaded_by = NULL WHERE uploaded_by IN (` + purged + `)`,
+		`UPDATE orders SET user_id = NULL WHERE user_id IN (` + purged + `)`,
+		`UPDATE order_items SET user_id = NULL, answers = NULL WHERE user_id IN (` + purged + `)`,
+		`DELETE FROM attendees WHERE user_id IN (` + purged + `)`,
+		`DELETE FROM registration_answers WHERE user_id IN (` + purged + `)`,
+		`DELETE FROM event_organizers WHERE user_id IN (` + purged + `)`,
+		`DELETE FROM organization_members WHERE user_id IN (` + purged + `)`,
+		`DELETE FROM idempotency_keys WHERE user_id IN (` + purged + `)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt, before.UTC()); err != nil {
+			return nil, err
+		}
+	}
+	if purge.Users, err = queryIds(ctx, tx, `DELETE FROM users WHERE deleted_at <= $1 RETURNING id`, before.UTC()); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &purge, nil
+}
+
+func (m *UserModel) SetRole(id int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res)
+}
+
+// Anonymize erases the personal data of a user while keeping the row, so
+// their RSVPs still count towards other people's events. The account can no
+// longer be used to log in. Everything the data export holds about the user
+// is covered: their registration answers, those given with orders, and emails
+// to them still waiting in the job queue go as well. The append-only audit log
+// is left as it is: its entries keep the user's id, and those written before
+// personal data was redacted from them may still hold the user's name, email,
+// profile and answers.
+func (m *UserModel) Anonymize(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		DELETE FROM organization_invitations
+		WHERE accepted_at IS NULL AND email = (SELECT COALESCE(deleted_email, email) FROM users WHERE id = $1)
+	`
+	if _, err := tx.ExecContext(ctx, stmt, id); err != nil {
+		return err
+	}
+
+	// Stored responses of idempotent requests may hold personal data.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+
+	stmts := []string{
+		`DELETE FROM registration_answers WHERE user_id = $1`,
+		`UPDATE order_items SET answers = NULL WHERE user_id = $1`,
+		`DELETE FROM jobs WHERE status <> '` + JobRunning + `' AND json_extract(payload, '$.to') = (SELECT COALESCE(deleted_email, email) FROM users WHERE id = $1)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt, id); err != nil {
+			return err
+		}
+	}
+
+	stmt = `
+		UPDATE users
+		SET name = 'Deleted user',
+			email = 'deleted-' || id || '@anonymized.invalid',
+			deleted_email = NULL,
+			password = '',
+			avatar_url = '',
+			bio = '',
+			time_zone = 'UTC',
+			pending_email = NULL,
+			email_token = NULL,
+			email_token_expires_at = NULL,
+			invite_token = NULL,
+			invite_token_expires_at = NULL,
+			anonymized_at = $1
+		WHERE id = $2 AND anonymized_at IS NULL
+	`
+
+	res, err := tx.ExecContext(ctx, stmt, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// VenueModel queries are scoped to a tenant like EventModel's: OrgID 0 is the
+// personal namespace, any other value an organization.
+type VenueModel struct {
+	DB    DBTX
+	OrgID int
+}
+
+// Venue is a place events can be booked at. Capacity is optional; when set
+// it bounds the capacity of its rooms and of the events booked there.
+type Venue struct {
+	ID             int       `json:"id"`
+	OrganizationId *int      `json:"organizationId,omitempty"`
+	OwnerId        *int      `json:"ownerId,omitempty"`
+	Name           string    `json:"name" binding:"required,min=2,max=200"`
+	Address        *Address  `json:"address,omitempty"`
+	Capacity       *int      `json:"capacity,omitempty" binding:"omitempty,min=1"`
+	Rooms          []*Room   `json:"rooms" binding:"dive"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Room is a part of a venue that can be booked on its own.
+type Room struct {
+	ID       int    `json:"id"`
+	VenueId  int    `json:"venueId"`
+	Name     string `json:"name" binding:"required,max=100"`
+	Capacity *int   `json:"capacity,omitempty" binding:"omitempty,min=1"`
+}
+
+// Room returns the room of the venue with the given id, or nil.
+func (v *Venue) Room(id int) *Room {
+	for _, r := range v.Rooms {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+var ErrVenueNotFound = notFoundError("venue not found")
+var ErrRoomNotFound = notFoundError("room not found")
+var ErrVenueInUse = conflictError("conflict", "Events are booked there; move or delete them first")
+
+// venueInTenant matches venues of the model's tenant; it expects the tenant
+// id as the query parameter with the given index.
+func venueInTenant(param int) string {
+	return fmt.Sprintf("($%[1]d = %[2]d OR COALESCE(v.organization_id, 0) = $%[1]d)", param, AllOrganizations)
+}
+
+const venueColumns = `v.id, v.organization_id, v.owner_id, v.name, v.street, v.city, v.region, v.postal_code, v.country, v.capacity, v.created_at`
+
+func scanVenue(row rowScanner, venue *Venue) error {
+	var address Address
+	err := row.Scan(&venue.ID, &venue.OrganizationId, &venue.OwnerId, &venue.Name,
+		&address.Street, &address.City, &address.Region, &address.PostalCode, &address.Country, &venue.Capacity, &venue.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	venue.Address = nil
+	if address != (Address{}) {
+		venue.Address = &address
+	}
+	return nil
+}
+
+// Insert creates the venue in the model's tenant together with its rooms.
+func (m *VenueModel) Insert(venue *Venue) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if m.OrgID == AllOrganizations {
+		return errors.New("cannot insert a venue without a tenant")
+	}
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	venue.CreatedAt = time.Now().UTC()
+	address := AddressOf(venue.Address)
+	stmt := `
+		INSERT INTO venues (organization_id, owner_id, name, street, city, region, postal_code, country, capacity, created_at)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, organization_id
+	`
+	err = tx.QueryRowContext(ctx, stmt, m.OrgID, venue.OwnerId, venue.Name,
+		address.Street, address.City, address.Region, address.PostalCode, address.Country, venue.Capacity, venue.CreatedAt).Scan(&venue.ID, &venue.OrganizationId)
+	if err != nil {
+		return err
+	}
+
+	if venue.Rooms == nil {
+		venue.Rooms = []*Room{}
+	}
+	for _, room := range venue.Rooms {
+		room.VenueId = venue.ID
+		stmt := `INSERT INTO rooms (venue_id, name, capacity) VALUES ($1, $2, $3) RETURNING id`
+		if err := tx.QueryRowContext(ctx, stmt, room.VenueId, room.Name, room.Capacity).Scan(&room.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Get returns a venue of the tenant with its rooms, or ErrVenueNotFound.
+func (m *VenueModel) Get(id int) (*Venue, error) {
+	venues, err := m.queryVenues(`WHERE v.id = $1 AND `+venueInTenant(2), id, m.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(venues) == 0 {
+		return nil, ErrVenueNotFound
+	}
+	return venues[0], nil
+}
+
+// GetAll lists the venues of the tenant with their rooms.
+func (m *VenueModel) GetAll() ([]*Venue, error) {
+	return m.queryVenues(`WHERE `+venueInTenant(1), m.OrgID)
+}
+
+// queryVenues returns the venues matching where, ordered by name, and loads
+// their rooms.
+func (m *VenueModel) queryVenues(where string, args ...any) ([]*Venue, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT `+venueColumns+` FROM venues v `+where+` ORDER BY v.name, v.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	venues := []*Venue{}
+	byId := map[int]*Venue{}
+	for rows.Next() {
+		venue := &Venue{Rooms: []*Room{}}
+		if err := scanVenue(rows, venue); err != nil {
+			return nil, err
+		}
+		venues = append(venues, venue)
+		byId[venue.ID] = venue
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	query := `
+		SELECT r.id, r.venue_id, r.name, r.capacity
+		FROM rooms r
+		JOIN venues v ON v.id = r.venue_id
+		` + where + `
+		ORDER BY r.name, r.id`
+	rows, err = m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room Room
+		if err := rows.Scan(&room.ID, &room.VenueId, &room.Name, &room.Capacity); err != nil {
+			return nil, err
+		}
+		if venue := byId[room.VenueId]; venue != nil {
+			venue.Rooms = append(venue.Rooms, &room)
+		}
+	}
+	return venues, rows.Err()
+}
+
+// Update saves the name, address and capacity of a venue of the tenant.
+// Rooms are changed through InsertRoom, UpdateRoom and DeleteRoom.
+func (m *VenueModel) Update(venue *Venue) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	address := AddressOf(venue.Address)
+	stmt := `
+		UPDATE venues AS v
+		SET name = $1, street = $2, city = $3, region = $4, postal_code = $5, country = $6, capacity = $7
+		WHERE v.id = $8 AND ` + venueInTenant(9)
+
+	res, err := m.DB.ExecContext(ctx, stmt, venue.Name,
+		address.Street, address.City, address.Region, address.PostalCode, address.Country, venue.Capacity, venue.ID, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrVenueNotFound
+	}
+	return nil
+}
+
+// Delete removes a venue of the tenant and its rooms. It fails with
+// ErrVenueInUse while events, including deleted ones that have not been
+// purged yet, are booked there.
+func (m *VenueModel) Delete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var booked bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM events WHERE venue_id = $1)`, id).Scan(&booked); err != nil {
+		return err
+	}
+	if booked {
+		return ErrVenueInUse
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rooms WHERE venue_id IN (SELECT v.id FROM venues v WHERE v.id = $1 AND `+venueInTenant(2)+`)`, id, m.OrgID); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM venues AS v WHERE v.id = $1 AND `+venueInTenant(2), id, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrVenueNotFound
+	}
+
+	return tx.Commit()
+}
+
+// InsertRoom adds a room to a venue of the tenant.
+func (m *VenueModel) InsertRoom(room *Room) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO rooms (venue_id, name, capacity)
+		SELECT v.id, $1, $2 FROM venues v
+		WHERE v.id = $3 AND ` + venueInTenant(4) + `
+		RETURNING id
+	`
+	err := m.DB.QueryRowContext(ctx, stmt, room.Name, room.Capacity, room.VenueId, m.OrgID).Scan(&room.ID)
+	if err == sql.ErrNoRows {
+		return ErrVenueNotFound
+	}
+	return err
+}
+
+// UpdateRoom saves the name and capacity of a room.
+func (m *VenueModel) UpdateRoom(room *Room) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `
+		UPDATE rooms
+		SET name = $1, capacity = $2
+		WHERE id = $3 AND venue_id IN (SELECT v.id FROM venues v WHERE v.id = $4 AND ` + venueInTenant(5) + `)`
+
+	res, err := m.DB.ExecContext(ctx, stmt, room.Name, room.Capacity, room.ID, room.VenueId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
+// DeleteRoom removes a room. It fails with ErrVenueInUse while events are
+// booked in it.
+func (m *VenueModel) DeleteRoom(venueId, roomId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var booked bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM events WHERE room_id = $1)`, roomId).Scan(&booked); err != nil {
+		return err
+	}
+	if booked {
+		return ErrVenueInUse
+	}
+
+	stmt := `
+		DELETE FROM rooms
+		WHERE id = $1 AND venue_id IN (SELECT v.id FROM venues v WHERE v.id = $2 AND ` + venueInTenant(3) + `)`
+	res, err := tx.ExecContext(ctx, stmt, roomId, venueId, m.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrRoomNotFound
+	}
+
+	return tx.Commit()
+}
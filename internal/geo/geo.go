@@ -0,0 +1,71 @@
+package geo
+
+import "math"
+
+// Point is a position on Earth in decimal degrees.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// earthRadiusKm is the mean radius of the Earth.
+const earthRadiusKm = 6371.0088
+
+// Distance returns the great-circle distance between a and b in kilometres,
+// using the haversine formula.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLng := radians(b.Lng - a.Lng)
+
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Box is a latitude/longitude rectangle. MinLng is greater than MaxLng when
+// the box crosses the antimeridian.
+type Box struct {
+	MinLat, MaxLat float64
+	MinLng, MaxLng float64
+}
+
+// CrossesAntimeridian reports whether the box wraps around longitude 180.
+func (b Box) CrossesAntimeridian() bool {
+	return b.MinLng > b.MaxLng
+}
+
+// BoundingBox returns the smallest box containing every point within
+// radiusKm of center. Boxes reaching a pole span every longitude.
+func BoundingBox(center Point, radiusKm float64) Box {
+	angle := radiusKm / earthRadiusKm
+	dLat := degrees(angle)
+
+	box := Box{MinLat: center.Lat - dLat, MaxLat: center.Lat + dLat, MinLng: -180, MaxLng: 180}
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		box.MinLat = math.Max(box.MinLat, -90)
+		box.MaxLat = math.Min(box.MaxLat, 90)
+		return box
+	}
+
+	dLng := degrees(math.Asin(math.Sin(angle) / math.Cos(radians(center.Lat))))
+	if dLng >= 180 {
+		return box
+	}
+	box.MinLng = center.Lng - dLng
+	box.MaxLng = center.Lng + dLng
+	if box.MinLng < -180 {
+		box.MinLng += 360
+	}
+	if box.MaxLng > 180 {
+		box.MaxLng -= 360
+	}
+	return box
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
@@ -0,0 +1,53 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrNoMatch is returned by a Geocoder that cannot place an address.
+var ErrNoMatch = errors.New("geo: address not found")
+
+// Geocoder looks up the coordinates of a postal address.
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (Point, error)
+}
+
+// StubGeocoder places addresses offline by looking for the name of a
+// well-known city in them, and returns the coordinates of its centre. It is
+// the default for local development; anything it doesn't recognise fails with
+// ErrNoMatch.
+type StubGeocoder struct{}
+
+// stubCities are the places StubGeocoder knows, with the spellings it
+// accepts.
+var stubCities = []struct {
+	names []string
+	point Point
+}{
+	{[]string{"ho chi minh", "hồ chí minh", "saigon", "sài gòn"}, Point{10.7769, 106.7009}},
+	{[]string{"hanoi", "ha noi", "hà nội"}, Point{21.0285, 105.8542}},
+	{[]string{"da nang", "đà nẵng", "danang"}, Point{16.0544, 108.2022}},
+	{[]string{"bangkok"}, Point{13.7563, 100.5018}},
+	{[]string{"singapore"}, Point{1.3521, 103.8198}},
+	{[]string{"tokyo"}, Point{35.6762, 139.6503}},
+	{[]string{"sydney"}, Point{-33.8688, 151.2093}},
+	{[]string{"london"}, Point{51.5072, -0.1276}},
+	{[]string{"paris"}, Point{48.8566, 2.3522}},
+	{[]string{"berlin"}, Point{52.5200, 13.4050}},
+	{[]string{"new york"}, Point{40.7128, -74.0060}},
+	{[]string{"san francisco"}, Point{37.7749, -122.4194}},
+}
+
+func (StubGeocoder) Geocode(ctx context.Context, address string) (Point, error) {
+	address = strings.ToLower(address)
+	for _, city := range stubCities {
+		for _, name := range city.names {
+			if strings.Contains(address, name) {
+				return city.point, nil
+			}
+		}
+	}
+	return Point{}, ErrNoMatch
+}
@@ -30,11 +30,21 @@ func GetUserFromContext(c *gin.Context) *database.User {
 	return user
 }
 
-func ErrorResponse(c *gin.Context, status int, message string) {
-	c.JSON(status, gin.H{
-		"status": "fail",
-		"error":  message,
-	})
+// GetMembershipFromContext returns the current user's membership of the
+// organization in the route, or nil outside organization routes.
+func GetMembershipFromContext(c *gin.Context) *database.Membership {
+	membership, ok := c.Get("membership")
+	if !ok {
+		return nil
+	}
+	m, _ := membership.(*database.Membership)
+	return m
+}
+
+// GetRequestIDFromContext returns the ID RequestIDMiddleware assigned to the
+// request.
+func GetRequestIDFromContext(c *gin.Context) string {
+	return c.GetString("requestId")
 }
 
 func JSONResponse(c *gin.Context, status int, payload any) {
@@ -0,0 +1,365 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Problem is an RFC 7807 problem details response. Code is a stable,
+// machine-readable identifier from ErrorCatalog; Detail is meant for humans
+// and may change.
+type Problem struct {
+	Type      string       `json:"type" example:"/api/v1/errors#not_found"`
+	Title     string       `json:"title" example:"Not found"`
+	Status    int          `json:"status" example:"404"`
+	Detail    string       `json:"detail,omitempty" example:"event not found"`
+	Instance  string       `json:"instance,omitempty" example:"/api/v1/events/42"`
+	Code      string       `json:"code" enums:"bad_request,invalid_body,validation_failed,unauthorized,forbidden,not_found,conflict,already_exists,constraint_violation,invalid_transition,booking_conflict,event_full,sold_out,ticket_required,already_checked_in,payload_too_large,unsupported_media_type,request_in_progress,idempotency_key_reused,gone,precondition_failed,internal_error"`
+	RequestId string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// Extension holds the members a StatusError adds to the problem, such
+	// as the conflicts of a booking_conflict. Its fields are written next
+	// to the others.
+	Extension any `json:"-"`
+}
+
+// MarshalJSON writes the problem with the fields of its Extension.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	data, err := json.Marshal(problem(p))
+	if err != nil || p.Extension == nil {
+		return data, err
+	}
+	ext, err := json.Marshal(p.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if len(ext) <= len("{}") || ext[0] != '{' {
+		return data, nil
+	}
+	return append(append(data[:len(data)-1], ','), ext[1:]...), nil
+}
+
+// StatusError is implemented by errors clients can cause, such as the not
+// found errors of the models. They carry the status and problem code they
+// are reported with and their message is the detail, so ServerErrorResponse
+// needn't know every package's errors. Errors that add members to their
+// problem also have a ProblemExtension method returning them.
+type StatusError interface {
+	error
+	Status() int
+	Code() string
+}
+
+type problemExtension interface {
+	ProblemExtension() any
+}
+
+// FieldError is a single invalid field of a request body. Code is the
+// validation rule that failed.
+type FieldError struct {
+	Field   string `json:"field" example:"name"`
+	Code    string `json:"code" example:"min"`
+	Message string `json:"message" example:"must be at least 3 characters long"`
+}
+
+// ErrorCode is an entry of the error catalog.
+type ErrorCode struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+}
+
+const (
+	CodeBadRequest          = "bad_request"
+	CodeInvalidBody         = "invalid_body"
+	CodeValidationFailed    = "validation_failed"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeAlreadyExists       = "already_exists"
+	CodeConstraintViolation = "constraint_violation"
+	CodeInvalidTransition   = "invalid_transition"
+	CodeBookingConflict     = "booking_conflict"
+	CodeEventFull           = "event_full"
+	CodeSoldOut             = "sold_out"
+	CodeTicketRequired      = "ticket_required"
+	CodeAlreadyCheckedIn    = "already_checked_in"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeUnsupportedMedia    = "unsupported_media_type"
+	CodeRequestInProgress   = "request_in_progress"
+	CodeIdempotencyMismatch = "idempotency_key_reused"
+	CodeGone                = "gone"
+	CodePreconditionFailed  = "precondition_failed"
+	CodeInternal            = "internal_error"
+)
+
+// ErrorCatalog lists every code an error response may carry.
+var ErrorCatalog = []ErrorCode{
+	{CodeBadRequest, http.StatusBadRequest, "Bad request"},
+	{CodeInvalidBody, http.StatusBadRequest, "Request body is not valid JSON"},
+	{CodeValidationFailed, http.StatusBadRequest, "Validation failed"},
+	{CodeUnauthorized, http.StatusUnauthorized, "Unauthorized"},
+	{CodeForbidden, http.StatusForbidden, "Forbidden"},
+	{CodeNotFound, http.StatusNotFound, "Not found"},
+	{CodeConflict, http.StatusConflict, "Conflict"},
+	{CodeAlreadyExists, http.StatusConflict, "Already exists"},
+	{CodeConstraintViolation, http.StatusConflict, "Constraint violation"},
+	{CodeInvalidTransition, http.StatusConflict, "Invalid status transition"},
+	{CodeBookingConflict, http.StatusConflict, "Venue is already booked"},
+	{CodeEventFull, http.StatusConflict, "Event is full"},
+	{CodeSoldOut, http.StatusConflict, "Tickets are sold out"},
+	{CodeTicketRequired, http.StatusConflict, "Event requires a ticket"},
+	{CodeAlreadyCheckedIn, http.StatusConflict, "Ticket was already scanned"},
+	{CodePayloadTooLarge, http.StatusRequestEntityTooLarge, "Upload is too large"},
+	{CodeUnsupportedMedia, http.StatusUnsupportedMediaType, "File type is not allowed"},
+	{CodeRequestInProgress, http.StatusConflict, "A request with this idempotency key is in progress"},
+	{CodeIdempotencyMismatch, http.StatusUnprocessableEntity, "Idempotency key reused with a different request"},
+	{CodeGone, http.StatusGone, "Gone"},
+	{CodePreconditionFailed, http.StatusPreconditionFailed, "Precondition failed"},
+	{CodeInternal, http.StatusInternalServerError, "Internal server error"},
+}
+
+// ErrorsPath is where the error catalog is served; problem types point into
+// it.
+const ErrorsPath = "/api/v1/errors"
+
+// statusCodes is the code used for each status when a handler doesn't pick a
+// more specific one.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusGone:                  CodeGone,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	http.StatusInternalServerError:   CodeInternal,
+}
+
+func init() {
+	// Report JSON field names rather than Go field names in validation
+	// errors.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+		v.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+			return slugPattern.MatchString(fl.Field().String())
+		})
+	}
+}
+
+// slugPattern matches the URL-safe identifiers of categories.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// InvalidFieldError is a request field that failed a check the validator
+// can't express, such as one that needs the database. ServerErrorResponse
+// reports it like a validation error.
+type InvalidFieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *InvalidFieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// InvalidFieldsError reports several invalid fields at once, for checks
+// that go on after the first failure. ServerErrorResponse reports it like a
+// validation error with Detail.
+type InvalidFieldsError struct {
+	Detail string
+	Errors []FieldError
+}
+
+func (e *InvalidFieldsError) Error() string {
+	return e.Detail
+}
+
+// ErrorResponse writes a problem with the default code of status.
+func ErrorResponse(c *gin.Context, status int, message string) {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeBadRequest
+	}
+	ProblemResponse(c, status, code, message)
+}
+
+// ProblemResponse writes a problem with the given code and detail.
+func ProblemResponse(c *gin.Context, status int, code, detail string) {
+	writeProblem(c, &Problem{Status: status, Code: code, Detail: detail})
+}
+
+func writeProblem(c *gin.Context, p *Problem) {
+	p.Type = ErrorsPath + "#" + p.Code
+	p.Title = titleOf(p.Code)
+	p.Instance = c.Request.URL.Path
+	p.RequestId = GetRequestIDFromContext(c)
+
+	c.Header("Content-Type", "application/problem+json")
+	c.JSON(p.Status, p)
+}
+
+func titleOf(code string) string {
+	for _, e := range ErrorCatalog {
+		if e.Code == code {
+			return e.Title
+		}
+	}
+	return http.StatusText(http.StatusInternalServerError)
+}
+
+// BindErrorResponse writes the problem for an error returned by one of the
+// ShouldBind methods: malformed JSON, or the fields that failed validation.
+func BindErrorResponse(c *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		p := &Problem{Status: http.StatusBadRequest, Code: CodeValidationFailed, Detail: "One or more fields are invalid"}
+		for _, fe := range validationErrs {
+			p.Errors = append(p.Errors, FieldError{
+				Field:   fieldPath(fe),
+				Code:    fe.Tag(),
+				Message: validationMessage(fe),
+			})
+		}
+		writeProblem(c, p)
+	case errors.As(err, &typeErr):
+		writeProblem(c, &Problem{
+			Status: http.StatusBadRequest,
+			Code:   CodeValidationFailed,
+			Detail: "One or more fields are invalid",
+			Errors: []FieldError{{Field: typeErr.Field, Code: "type", Message: "must be of type " + typeErr.Type.String()}},
+		})
+	case errors.As(err, &syntaxErr):
+		ProblemResponse(c, http.StatusBadRequest, CodeInvalidBody, fmt.Sprintf("Malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		ProblemResponse(c, http.StatusBadRequest, CodeInvalidBody, "Request body is truncated")
+	case errors.Is(err, io.EOF):
+		ProblemResponse(c, http.StatusBadRequest, CodeInvalidBody, "Request body is empty")
+	default:
+		ProblemResponse(c, http.StatusBadRequest, CodeInvalidBody, "Request body could not be read")
+	}
+}
+
+// fieldPath strips the name of the top-level struct from the namespace of a
+// validation error, e.g. "Event.name" becomes "name".
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func validationMessage(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters long"
+	} else if fe.Kind() == reflect.Slice || fe.Kind() == reflect.Map {
+		unit = " items"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		return "must be at least " + fe.Param() + unit
+	case "max", "lte":
+		return "must be at most " + fe.Param() + unit
+	case "len":
+		return "must be exactly " + fe.Param() + unit
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "lt":
+		return "must be less than " + fe.Param()
+	case "email":
+		return "must be a valid email address"
+	case "url", "http_url":
+		return "must be a valid URL"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "datetime":
+		return "must be a date in the format " + fe.Param()
+	case "timezone":
+		return "must be an IANA time zone"
+	case "iso4217":
+		return "must be an ISO 4217 currency code"
+	case "eqfield":
+		return "must match " + fe.Param()
+	case "excludes":
+		return "must not contain " + strconv.Quote(strings.ReplaceAll(fe.Param(), "0x2C", ","))
+	case "slug":
+		return "must contain only lowercase letters, digits and hyphens"
+	case "required_with":
+		return "is required when " + strings.ToLower(fe.Param()[:1]) + fe.Param()[1:] + " is set"
+	}
+	return "is invalid"
+}
+
+// ServerErrorResponse writes the problem for an error a handler did not
+// expect. StatusErrors and invalid fields are reported as such and
+// constraint violations as 409; anything else is logged and hidden behind
+// the request ID, which is returned so the failure can be traced.
+func ServerErrorResponse(c *gin.Context, err error) {
+	var sqliteErr sqlite3.Error
+	var fieldErr *InvalidFieldError
+	var fieldsErr *InvalidFieldsError
+	var statusErr StatusError
+
+	switch {
+	case errors.As(err, &fieldErr):
+		writeProblem(c, &Problem{
+			Status: http.StatusBadRequest,
+			Code:   CodeValidationFailed,
+			Detail: "One or more fields are invalid",
+			Errors: []FieldError{{Field: fieldErr.Field, Code: fieldErr.Code, Message: fieldErr.Message}},
+		})
+	case errors.As(err, &fieldsErr):
+		writeProblem(c, &Problem{Status: http.StatusBadRequest, Code: CodeValidationFailed, Detail: fieldsErr.Detail, Errors: fieldsErr.Errors})
+	case errors.As(err, &statusErr):
+		p := &Problem{Status: statusErr.Status(), Code: statusErr.Code(), Detail: statusErr.Error()}
+		if ext, ok := statusErr.(problemExtension); ok {
+			p.Extension = ext.ProblemExtension()
+		}
+		writeProblem(c, p)
+	case errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint:
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			ProblemResponse(c, http.StatusConflict, CodeAlreadyExists, "The resource already exists")
+		default:
+			ProblemResponse(c, http.StatusConflict, CodeConstraintViolation, "The request conflicts with existing data")
+		}
+	default:
+		log.Printf("request %s: %s %s: %v", GetRequestIDFromContext(c), c.Request.Method, c.Request.URL.Path, err)
+		ProblemResponse(c, http.StatusInternalServerError, CodeInternal, "An unexpected error occurred; quote the request ID when reporting it")
+	}
+}
@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// NewToken returns a random token to hand out to the user and its hash to
+// store in the database.
+func NewToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SignValue returns value followed by an HMAC of it, so the value can be
+// handed out and later verified with VerifySignedValue.
+func SignValue(secret, purpose, value string) string {
+	return value + "." + signature(secret, purpose, value)
+}
+
+// VerifySignedValue returns the value of a token created by SignValue with
+// the same secret and purpose.
+func VerifySignedValue(secret, purpose, token string) (string, bool) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", false
+	}
+	value, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, purpose, value))) {
+		return "", false
+	}
+	return value, true
+}
+
+func signature(secret, purpose, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + ":" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
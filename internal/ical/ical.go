@@ -0,0 +1,89 @@
+package ical
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is a single all-day VEVENT.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Date        time.Time
+	Cancelled   bool
+	// URL links to more about the event, such as the attendee's ticket.
+	URL string
+}
+
+// Write renders events as an iCalendar (RFC 5545) document.
+func Write(w io.Writer, events []Event) error {
+	now := time.Now().UTC().Format("20060102T150405Z")
+
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	b.WriteString("VERSION:2.0\r\n")
+	b.WriteString("PRODID:-//gin-event-app//EN\r\n")
+	b.WriteString("CALSCALE:GREGORIAN\r\n")
+	for _, e := range events {
+		b.WriteString("BEGIN:VEVENT\r\n")
+		writeLine(&b, "UID", e.UID)
+		writeLine(&b, "DTSTAMP", now)
+		writeLine(&b, "DTSTART;VALUE=DATE", e.Date.Format("20060102"))
+		writeLine(&b, "DTEND;VALUE=DATE", e.Date.AddDate(0, 0, 1).Format("20060102"))
+		writeLine(&b, "SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			writeLine(&b, "DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			writeLine(&b, "LOCATION", escape(e.Location))
+		}
+		if e.URL != "" {
+			writeLine(&b, "URL", e.URL)
+		}
+		if e.Cancelled {
+			writeLine(&b, "STATUS", "CANCELLED")
+		}
+		b.WriteString("END:VEVENT\r\n")
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ParseDate reads an event date as stored in the database, either a plain
+// date or a full timestamp.
+func ParseDate(s string) (time.Time, error) {
+	if len(s) < len("2006-01-02") {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	return time.Parse("2006-01-02", s[:len("2006-01-02")])
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// writeLine folds content lines longer than 75 octets as required by the RFC.
+func writeLine(b *strings.Builder, name, value string) {
+	line := name + ":" + value
+	for len(line) > 75 {
+		cut := 75
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+	}
+	b.WriteString(line + "\r\n")
+}
+
+func isRuneStart(c byte) bool {
+	return c&0xC0 != 0x80
+}
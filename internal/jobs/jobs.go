@@ -0,0 +1,220 @@
+// Package jobs runs background work queued in the database. Handlers are
+// registered per kind of job with the type of their payload; a Worker claims
+// due jobs and runs them on a pool of goroutines, retrying failures with
+// exponential backoff until a job runs out of attempts and is dead.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+)
+
+// DefaultMaxAttempts is how often a job is tried unless Options say
+// otherwise.
+const DefaultMaxAttempts = 5
+
+// Bounds of the exponential backoff between attempts.
+const (
+	minBackoff = 30 * time.Second
+	maxBackoff = time.Hour
+)
+
+// Options tune an enqueued job. The zero value runs it once right away, with
+// DefaultMaxAttempts.
+type Options struct {
+	// RunAt delays the job until the given time.
+	RunAt time.Time
+	// UniqueKey makes sure the job is only ever enqueued once; enqueueing
+	// it again returns the existing job. Prefix keys with the kind.
+	UniqueKey   string
+	MaxAttempts int
+}
+
+// Enqueue adds a job of the given kind with payload as its JSON input. It
+// reports whether the job was added, which it isn't when its unique key was
+// enqueued before.
+func Enqueue(m *database.JobModel, kind string, payload any, opts Options) (*database.Job, bool, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, false, err
+	}
+	job := &database.Job{Kind: kind, Payload: data, RunAt: opts.RunAt, MaxAttempts: opts.MaxAttempts}
+	if opts.UniqueKey != "" {
+		job.UniqueKey = &opts.UniqueKey
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+	added, err := m.Enqueue(job)
+	return job, added, err
+}
+
+// Handler runs a job. Returning an error fails the attempt.
+type Handler func(ctx context.Context, job *database.Job) error
+
+// permanentError is an error that retrying won't fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying won't fix, such as a payload that
+// refers to something deleted. The job is dead right away.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Backoff returns how long to wait before the next attempt after the given
+// number of attempts failed: 30 seconds doubling up to an hour, with some
+// jitter so jobs that failed together don't retry together.
+func Backoff(attempts int) time.Duration {
+	d := maxBackoff
+	if attempts = max(attempts, 1); attempts < 8 {
+		d = min(minBackoff<<(attempts-1), maxBackoff)
+	}
+	return d + rand.N(d/10)
+}
+
+// Worker runs queued jobs. Register the handlers before calling Run.
+type Worker struct {
+	Jobs *database.JobModel
+	// Concurrency is how many jobs run at once.
+	Concurrency int
+	// PollInterval is how often the queue is checked while it is empty.
+	PollInterval time.Duration
+	// Timeout bounds a single attempt. Jobs held longer than twice as long,
+	// by a worker that stopped, are released again.
+	Timeout time.Duration
+
+	handlers map[string]Handler
+}
+
+// Handle registers the handler of a kind of job.
+func (w *Worker) Handle(kind string, h Handler) {
+	if w.handlers == nil {
+		w.handlers = map[string]Handler{}
+	}
+	w.handlers[kind] = h
+}
+
+// Register registers the handler of a kind of job whose payload is a T. A
+// payload that doesn't decode fails the job permanently.
+func Register[T any](w *Worker, kind string, fn func(ctx context.Context, payload T) error) {
+	w.Handle(kind, func(ctx context.Context, job *database.Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("decode payload: %w", err))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// Run claims and runs due jobs until ctx is done, then waits for the
+// running ones to finish.
+func (w *Worker) Run(ctx context.Context) {
+	slots := make(chan struct{}, max(w.Concurrency, 1))
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	lastSweep := time.Time{}
+
+	for {
+		if time.Since(lastSweep) >= w.Timeout {
+			w.requeueStale()
+			lastSweep = time.Now()
+		}
+
+		// Claim jobs as long as there are due ones and free slots.
+		for {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			job, err := w.Jobs.Claim(time.Now())
+			if err != nil {
+				log.Printf("claim job: %v", err)
+			}
+			if job == nil {
+				<-slots
+				break
+			}
+			running.Add(1)
+			go func() {
+				defer func() {
+					<-slots
+					running.Done()
+				}()
+				w.run(job)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs an attempt of a claimed job and records its outcome.
+func (w *Worker) run(job *database.Job) {
+	err := w.call(job)
+	if err == nil {
+		if err := w.Jobs.Complete(job.ID); err != nil {
+			log.Printf("complete job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	var permanent permanentError
+	if !errors.As(err, &permanent) && job.Attempts < job.MaxAttempts {
+		at := time.Now().Add(Backoff(job.Attempts))
+		retryAt = &at
+	}
+	if retryAt == nil {
+		log.Printf("job %d (%s) is dead after %d attempts: %v", job.ID, job.Kind, job.Attempts, err)
+	} else {
+		log.Printf("job %d (%s) failed, retrying at %s: %v", job.ID, job.Kind, retryAt.UTC().Format(time.RFC3339), err)
+	}
+	if err := w.Jobs.Fail(job.ID, err.Error(), retryAt); err != nil {
+		log.Printf("fail job %d: %v", job.ID, err)
+	}
+}
+
+// call runs the handler of a job, turning panics into errors.
+func (w *Worker) call(job *database.Job) (err error) {
+	h, ok := w.handlers[job.Kind]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for jobs of kind %q", job.Kind))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
+
+func (w *Worker) requeueStale() {
+	n, err := w.Jobs.RequeueStale(time.Now().Add(-2 * w.Timeout))
+	if err != nil {
+		log.Printf("requeue stale jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("requeued %d stale jobs", n)
+	}
+}
@@ -0,0 +1,23 @@
+package mailer
+
+import "log"
+
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Mailer delivers transactional email to users.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// LogMailer writes messages to the log instead of sending them. It is the
+// default for local development.
+type LogMailer struct{}
+
+func (LogMailer) Send(msg Message) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,222 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignatureHeader carries the signature of the webhook requests of
+// FakeProvider: "t=<unix time>,v1=<hex HMAC-SHA256 of t.body>".
+const SignatureHeader = "Fake-Signature"
+
+// webhookTolerance is how old a signed webhook request may be, which stops
+// captured requests from being replayed later.
+const webhookTolerance = 5 * time.Minute
+
+// Statuses of fake payments.
+const (
+	FakePending   = "pending"
+	FakeSucceeded = "succeeded"
+	FakeFailed    = "failed"
+	FakeRefunded  = "refunded"
+)
+
+// FakeProvider is a Provider for local development that moves no money.
+// Payments are kept in memory and completed by calling Complete, which the
+// API exposes as a fake checkout page; the outcome is then delivered to
+// WebhookURL, signed with Secret, as a real provider would.
+type FakeProvider struct {
+	// CheckoutURL is where buyers complete payments; the payment id is
+	// appended to it.
+	CheckoutURL string
+	WebhookURL  string
+	Secret      string
+	// Client delivers webhooks; http.DefaultClient when nil.
+	Client *http.Client
+
+	mu       sync.Mutex
+	payments map[string]*FakePayment
+}
+
+// FakePayment is the state of a payment of a FakeProvider.
+type FakePayment struct {
+	ID          string `json:"id"`
+	OrderId     int    `json:"orderId"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"description"`
+	Status      string `json:"status" enums:"pending,succeeded,failed,refunded"`
+}
+
+func NewFakeProvider(checkoutURL, webhookURL, secret string) *FakeProvider {
+	return &FakeProvider{
+		CheckoutURL: checkoutURL,
+		WebhookURL:  webhookURL,
+		Secret:      secret,
+		payments:    map[string]*FakePayment{},
+	}
+}
+
+func (p *FakeProvider) CreatePayment(ctx context.Context, req Request) (*Payment, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := "fake_" + hex.EncodeToString(b)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.payments[id] = &FakePayment{
+		ID:          id,
+		OrderId:     req.OrderId,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Description: req.Description,
+		Status:      FakePending,
+	}
+	return &Payment{ID: id, CheckoutURL: strings.TrimSuffix(p.CheckoutURL, "/") + "/" + id}, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, paymentId string, amount int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentId]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	if payment.Status != FakeSucceeded || payment.Amount != amount {
+		return ErrInvalidState
+	}
+	payment.Status = FakeRefunded
+	return nil
+}
+
+// Get returns a copy of a payment.
+func (p *FakeProvider) Get(paymentId string) (*FakePayment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentId]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	result := *payment
+	return &result, nil
+}
+
+// Complete plays the buyer finishing a pending payment, successfully or not,
+// and delivers the outcome to the webhook. Completing a payment again with
+// the same outcome delivers the webhook again, like a provider retrying.
+func (p *FakeProvider) Complete(ctx context.Context, paymentId string, succeed bool) error {
+	status, eventType := FakeFailed, EventFailed
+	if succeed {
+		status, eventType = FakeSucceeded, EventSucceeded
+	}
+
+	p.mu.Lock()
+	payment, ok := p.payments[paymentId]
+	if !ok {
+		p.mu.Unlock()
+		return ErrPaymentNotFound
+	}
+	if payment.Status != FakePending && payment.Status != status {
+		p.mu.Unlock()
+		return ErrInvalidState
+	}
+	payment.Status = status
+	event := Event{
+		Type:      eventType,
+		PaymentId: payment.ID,
+		OrderId:   payment.OrderId,
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+	}
+	p.mu.Unlock()
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	event.ID = "evt_" + hex.EncodeToString(b)
+	return p.deliver(ctx, &event)
+}
+
+func (p *FakeProvider) deliver(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, p.sign(time.Now(), body))
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("payment: webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (p *FakeProvider) sign(t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + p.mac(timestamp, body)
+}
+
+func (p *FakeProvider) mac(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *FakeProvider) ParseWebhook(header http.Header, body []byte) (*Event, error) {
+	var timestamp, signature string
+	for _, part := range strings.Split(header.Get(SignatureHeader), ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	if !hmac.Equal([]byte(signature), []byte(p.mac(timestamp, body))) {
+		return nil, ErrInvalidSignature
+	}
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(t, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
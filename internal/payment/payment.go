@@ -0,0 +1,59 @@
+// Package payment takes payments for orders through a payment provider.
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrInvalidSignature = errors.New("payment: webhook signature is not valid")
+	ErrPaymentNotFound  = errors.New("payment: payment not found")
+	ErrInvalidState     = errors.New("payment: payment is not in a state that allows this")
+)
+
+// Request describes a payment to start. Amount is in the minor unit of the
+// currency, e.g. cents.
+type Request struct {
+	OrderId     int
+	Amount      int64
+	Currency    string
+	Description string
+}
+
+// Payment is a payment started with a provider. The buyer completes it at
+// CheckoutURL.
+type Payment struct {
+	ID          string
+	CheckoutURL string
+}
+
+// Types of webhook events.
+const (
+	EventSucceeded = "payment.succeeded"
+	EventFailed    = "payment.failed"
+)
+
+// Event is a notification a provider sends to the webhook about a payment.
+type Event struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	PaymentId string `json:"paymentId"`
+	OrderId   int    `json:"orderId"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+}
+
+// Provider is a payment service. Payments are confirmed asynchronously: once
+// the buyer has paid, the provider calls the webhook of the API, which hands
+// the request to ParseWebhook.
+type Provider interface {
+	// CreatePayment starts a payment.
+	CreatePayment(ctx context.Context, req Request) (*Payment, error)
+	// Refund pays amount of a succeeded payment back in full.
+	Refund(ctx context.Context, paymentId string, amount int64) error
+	// ParseWebhook verifies that a webhook request comes from the provider
+	// and returns the event it carries, or ErrInvalidSignature.
+	ParseWebhook(header http.Header, body []byte) (*Event, error)
+}
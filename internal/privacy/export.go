@@ -0,0 +1,152 @@
+package privacy
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/LeeDat03/gin-event-app/internal/database"
+	"github.com/LeeDat03/gin-event-app/internal/ical"
+)
+
+// Export is everything the application stores about a single user.
+type Export struct {
+	ExportedAt    time.Time              `json:"exportedAt"`
+	User          *database.User         `json:"user"`
+	Organizations []*database.Membership `json:"organizations"`
+	OwnedEvents   []*database.Event      `json:"ownedEvents"`
+	Attending     []database.Event       `json:"attending"`
+	// CheckIns are the RSVPs of the user whose ticket was scanned.
+	CheckIns []*database.Attendee `json:"checkIns"`
+	// Uploads lists the files the user uploaded to events; the files
+	// themselves are not included.
+	Uploads []*database.EventFile `json:"uploads"`
+	// Orders are the tickets the user bought.
+	Orders []*database.Order `json:"orders"`
+	// Registrations are the answers the user gave when registering for
+	// events.
+	Registrations []*database.RegistrationAnswers `json:"registrations"`
+}
+
+// Collect gathers the personal data of a user across all organizations.
+func Collect(models database.Models, userId int) (*Export, error) {
+	models = models.ForOrganization(database.AllOrganizations)
+
+	user, err := models.Users.Get(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %d not found", userId)
+	}
+
+	memberships, err := models.Organizations.GetMembershipsForUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	owned, err := models.Events.GetByOwner(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	attending, err := models.Events.GetByAttendee(userId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if attending == nil {
+		attending = []database.Event{}
+	}
+
+	checkIns, err := models.Attendees.GetCheckInsByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads, err := models.EventFiles.GetByUploader(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := models.Orders.GetByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	registrations, err := models.RegistrationForms.GetAnswersByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{
+		ExportedAt:    time.Now().UTC(),
+		User:          user,
+		Organizations: memberships,
+		OwnedEvents:   owned,
+		Attending:     attending,
+		CheckIns:      checkIns,
+		Uploads:       uploads,
+		Orders:        orders,
+		Registrations: registrations,
+	}, nil
+}
+
+// WriteArchive writes the export as a zip archive containing data.json and
+// calendar.ics with every event the user owns or attends.
+func WriteArchive(w io.Writer, export *Export) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create("data.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(export); err != nil {
+		return err
+	}
+
+	f, err = zw.Create("calendar.ics")
+	if err != nil {
+		return err
+	}
+	if err := ical.Write(f, calendarEvents(export)); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func calendarEvents(export *Export) []ical.Event {
+	seen := map[int]bool{}
+	events := []ical.Event{}
+
+	add := func(e *database.Event) {
+		if seen[e.Id] {
+			return
+		}
+		seen[e.Id] = true
+		date, err := ical.ParseDate(e.Date)
+		if err != nil {
+			return
+		}
+		events = append(events, ical.Event{
+			UID:         fmt.Sprintf("event-%d@gin-event-app", e.Id),
+			Summary:     e.Name,
+			Description: e.Description,
+			Location:    e.Location,
+			Date:        date,
+			Cancelled:   e.Status == database.StatusCancelled,
+		})
+	}
+
+	for _, e := range export.OwnedEvents {
+		add(e)
+	}
+	for i := range export.Attending {
+		add(&export.Attending[i])
+	}
+	return events
+}
@@ -0,0 +1,274 @@
+package qr
+
+// grid is a code being laid out. Function modules (finder, timing and
+// alignment patterns, format and version information) are marked in
+// function so data and masks leave them alone.
+type grid struct {
+	size     int
+	dark     []bool
+	function []bool
+}
+
+func newGrid(version int) *grid {
+	size := version*4 + 17
+	return &grid{size: size, dark: make([]bool, size*size), function: make([]bool, size*size)}
+}
+
+func (g *grid) setFunction(x, y int, dark bool) {
+	g.dark[y*g.size+x] = dark
+	g.function[y*g.size+x] = true
+}
+
+func (g *grid) drawFunctionPatterns(version int) {
+	for i := range g.size {
+		g.setFunction(6, i, i%2 == 0)
+		g.setFunction(i, 6, i%2 == 0)
+	}
+
+	g.drawFinder(3, 3)
+	g.drawFinder(g.size-4, 3)
+	g.drawFinder(3, g.size-4)
+
+	positions := alignmentPositions(version, g.size)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// The corners are taken by finder patterns.
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			g.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format information; applyBestMask fills it in.
+	g.drawFormat(0)
+	g.drawVersion(version)
+}
+
+// drawFinder draws a finder pattern centred on x, y with its separator.
+func (g *grid) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= g.size || yy < 0 || yy >= g.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			g.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (g *grid) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			g.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns the row and column centres of the alignment
+// patterns: evenly spaced from the last one at size-7 down to 6.
+func alignmentPositions(version, size int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*4 + n*2 + 1) / (n*2 - 2) * 2
+	positions := make([]int, n)
+	positions[0] = 6
+	for i, pos := n-1, size-7; i > 0; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// drawFormat draws both copies of the format information: the error
+// correction level (M is 00) and the mask, protected by a BCH code.
+func (g *grid) drawFormat(mask int) {
+	data := mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		g.setFunction(8, i, bit(i))
+	}
+	g.setFunction(8, 7, bit(6))
+	g.setFunction(8, 8, bit(7))
+	g.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		g.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		g.setFunction(g.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		g.setFunction(8, g.size-15+i, bit(i))
+	}
+	g.setFunction(8, g.size-8, true)
+}
+
+// drawVersion draws both copies of the version information, which versions
+// 7 and up carry.
+func (g *grid) drawVersion(version int) {
+	if version < 7 {
+		return
+	}
+	rem := version
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	bits := version<<12 | rem
+	for i := range 18 {
+		dark := bits>>i&1 == 1
+		a, b := g.size-11+i%3, i/3
+		g.setFunction(a, b, dark)
+		g.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in two-module wide columns, zigzagging
+// up and down from the bottom right corner and skipping function modules.
+func (g *grid) drawCodewords(codewords []byte) {
+	i := 0
+	for right := g.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := range g.size {
+			y := vert
+			if upward {
+				y = g.size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if g.function[y*g.size+x] || i >= len(codewords)*8 {
+					continue
+				}
+				g.dark[y*g.size+x] = codewords[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// masks are the eight data mask patterns; modules where the pattern is true
+// are inverted.
+var masks = [8]func(x, y int) bool{
+	func(x, y int) bool { return (x+y)%2 == 0 },
+	func(x, y int) bool { return y%2 == 0 },
+	func(x, y int) bool { return x%3 == 0 },
+	func(x, y int) bool { return (x+y)%3 == 0 },
+	func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+	func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+	func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+	func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+}
+
+func (g *grid) applyMask(mask int) {
+	for y := range g.size {
+		for x := range g.size {
+			if !g.function[y*g.size+x] && masks[mask](x, y) {
+				g.dark[y*g.size+x] = !g.dark[y*g.size+x]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask that scores the lowest penalty, which
+// makes the code easiest to scan.
+func (g *grid) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := range masks {
+		g.applyMask(mask)
+		g.drawFormat(mask)
+		if p := g.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		g.applyMask(mask) // masks are their own inverse
+	}
+	g.applyMask(best)
+	g.drawFormat(best)
+}
+
+var (
+	finderLike         = []bool{true, false, true, true, true, false, true, false, false, false, false}
+	finderLikeReversed = []bool{false, false, false, false, true, false, true, true, true, false, true}
+)
+
+// penalty scores the grid by the four rules of the standard: long runs of
+// one colour, 2x2 blocks of one colour, patterns that look like finders and
+// an unbalanced share of dark modules.
+func (g *grid) penalty() int {
+	at := func(x, y int, transposed bool) bool {
+		if transposed {
+			x, y = y, x
+		}
+		return g.dark[y*g.size+x]
+	}
+
+	result := 0
+	for _, transposed := range []bool{false, true} {
+		for y := range g.size {
+			run := 0
+			for x := range g.size {
+				if x > 0 && at(x, y, transposed) == at(x-1, y, transposed) {
+					run++
+				} else {
+					run = 1
+				}
+				if run == 5 {
+					result += 3
+				} else if run > 5 {
+					result++
+				}
+			}
+			for x := 0; x+len(finderLike) <= g.size; x++ {
+				for _, pattern := range [][]bool{finderLike, finderLikeReversed} {
+					match := true
+					for i, dark := range pattern {
+						if at(x+i, y, transposed) != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						result += 40
+					}
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := range g.size {
+		for x := range g.size {
+			if g.dark[y*g.size+x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := g.dark[y*g.size+x]
+				if g.dark[y*g.size+x-1] == c && g.dark[(y-1)*g.size+x] == c && g.dark[(y-1)*g.size+x-1] == c {
+					result += 3
+				}
+			}
+		}
+	}
+	total := g.size * g.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return result + k*10
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
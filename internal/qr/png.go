@@ -0,0 +1,37 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// quietZone is the light margin, in modules, scanners need around a code.
+const quietZone = 4
+
+// PNG renders the code with every module scale pixels wide, surrounded by
+// the quiet zone.
+func (c *Code) PNG(scale int) ([]byte, error) {
+	side := (c.Size + 2*quietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := range c.Size {
+		for x := range c.Size {
+			if !c.Dark(x, y) {
+				continue
+			}
+			for dy := range scale {
+				row := img.Pix[((y+quietZone)*scale+dy)*img.Stride:]
+				for dx := range scale {
+					row[(x+quietZone)*scale+dx] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,146 @@
+// Package qr encodes short texts as QR codes (ISO/IEC 18004) and renders
+// them as PNG images. It covers what tickets need: byte mode, error
+// correction level M and versions 1 to 10, which hold up to 213 bytes.
+package qr
+
+import (
+	"errors"
+)
+
+// MaxLength is the number of bytes the largest supported version holds.
+const MaxLength = 213
+
+var ErrTooLong = errors.New("qr: data does not fit in a version 10 code")
+
+// Code is a square grid of dark and light modules.
+type Code struct {
+	// Size is the number of modules on each side, without the quiet zone.
+	Size    int
+	modules []bool
+}
+
+// Dark reports whether the module in column x and row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y*c.Size+x]
+}
+
+// blockLayout is how the codewords of a version are split into error
+// correction blocks: every block has ecPerBlock error correction codewords,
+// and each group has blocks blocks of dataLen data codewords.
+type blockLayout struct {
+	ecPerBlock int
+	groups     [2]struct{ blocks, dataLen int }
+}
+
+// levelM lists the block layouts of error correction level M by version.
+var levelM = [...]blockLayout{
+	{10, [2]struct{ blocks, dataLen int }{{1, 16}}},
+	{16, [2]struct{ blocks, dataLen int }{{1, 28}}},
+	{26, [2]struct{ blocks, dataLen int }{{1, 44}}},
+	{18, [2]struct{ blocks, dataLen int }{{2, 32}}},
+	{24, [2]struct{ blocks, dataLen int }{{2, 43}}},
+	{16, [2]struct{ blocks, dataLen int }{{4, 27}}},
+	{18, [2]struct{ blocks, dataLen int }{{4, 31}}},
+	{22, [2]struct{ blocks, dataLen int }{{2, 38}, {2, 39}}},
+	{22, [2]struct{ blocks, dataLen int }{{3, 36}, {2, 37}}},
+	{26, [2]struct{ blocks, dataLen int }{{4, 43}, {1, 44}}},
+}
+
+func (l blockLayout) dataLen() int {
+	return l.groups[0].blocks*l.groups[0].dataLen + l.groups[1].blocks*l.groups[1].dataLen
+}
+
+// countBits is the length of the character count of byte mode segments.
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// capacity is how many bytes fit in a code of the given version.
+func capacity(version int) int {
+	return (levelM[version-1].dataLen()*8 - 4 - countBits(version)) / 8
+}
+
+// Encode returns the smallest code that holds data.
+func Encode(data []byte) (*Code, error) {
+	for version := 1; version <= len(levelM); version++ {
+		if len(data) <= capacity(version) {
+			return encode(data, version), nil
+		}
+	}
+	return nil, ErrTooLong
+}
+
+func encode(data []byte, version int) *Code {
+	layout := levelM[version-1]
+
+	var bits bitBuffer
+	bits.append(0b0100, 4) // byte mode
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacityBits := layout.dataLen() * 8
+	bits.append(0, min(4, capacityBits-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacityBits; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	g := newGrid(version)
+	g.drawFunctionPatterns(version)
+	g.drawCodewords(interleave(bits.bytes(), layout))
+	g.applyBestMask()
+	return &Code{Size: g.size, modules: g.dark}
+}
+
+// interleave splits data into blocks, adds their error correction codewords
+// and interleaves the blocks codeword by codeword.
+func interleave(data []byte, layout blockLayout) []byte {
+	var blocks, ecBlocks [][]byte
+	for _, group := range layout.groups {
+		for range group.blocks {
+			block := data[:group.dataLen]
+			data = data[group.dataLen:]
+			blocks = append(blocks, block)
+			ecBlocks = append(ecBlocks, rsRemainder(block, layout.ecPerBlock))
+		}
+	}
+
+	var out []byte
+	longest := max(layout.groups[0].dataLen, layout.groups[1].dataLen)
+	for i := range longest {
+		for _, block := range blocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := range layout.ecPerBlock {
+		for _, ec := range ecBlocks {
+			out = append(out, ec[i])
+		}
+	}
+	return out
+}
+
+// bitBuffer is a sequence of bits, most significant first.
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
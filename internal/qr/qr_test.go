@@ -0,0 +1,313 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// TestRSRemainder checks the error correction codewords of the version 1-M
+// example of ISO/IEC 18004 Annex I, which encodes "01234567".
+func TestRSRemainder(t *testing.T) {
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	want := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+	if got := rsRemainder(data, 10); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = % X, want % X", got, want)
+	}
+}
+
+func TestGFMultiply(t *testing.T) {
+	tests := []struct{ x, y, want byte }{
+		{0x00, 0x53, 0x00},
+		{0x01, 0x53, 0x53},
+		{0x80, 0x02, 0x1D}, // α^8 = α^4 + α^3 + α^2 + 1
+		{0x02, 0x8E, 0x01}, // α^255 = 1
+	}
+	for _, tt := range tests {
+		if got := gfMultiply(tt.x, tt.y); got != tt.want {
+			t.Errorf("gfMultiply(%#x, %#x) = %#x, want %#x", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+// TestFormatInformation checks the format information of level M for every
+// mask against Table C.1 of the standard, in both copies.
+func TestFormatInformation(t *testing.T) {
+	want := [8]string{
+		"101010000010010", "101000100100101", "101111001111100", "101101101001011",
+		"100010111111001", "100000011001110", "100111110010111", "100101010100000",
+	}
+	for mask := range masks {
+		g := newGrid(1)
+		g.drawFormat(mask)
+		first, second := readFormat(g.dark, g.size)
+		if first != want[mask] || second != want[mask] {
+			t.Errorf("mask %d: format information %s and %s, want %s", mask, first, second, want[mask])
+		}
+	}
+}
+
+// TestVersionInformation checks the version information against Table D.1
+// of the standard, in both copies.
+func TestVersionInformation(t *testing.T) {
+	want := map[int]int{7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3}
+	for version, bits := range want {
+		g := newGrid(version)
+		g.drawVersion(version)
+		var topRight, bottomLeft int
+		for i := range 18 {
+			a, b := g.size-11+i%3, i/3
+			if g.dark[b*g.size+a] {
+				topRight |= 1 << i
+			}
+			if g.dark[a*g.size+b] {
+				bottomLeft |= 1 << i
+			}
+		}
+		if topRight != bits || bottomLeft != bits {
+			t.Errorf("version %d: version information %#x and %#x, want %#x", version, topRight, bottomLeft, bits)
+		}
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	// Table E.1 of the standard.
+	want := map[int][]int{
+		1: nil, 2: {6, 18}, 6: {6, 34}, 7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+	}
+	for version, positions := range want {
+		if got := alignmentPositions(version, version*4+17); fmt.Sprint(got) != fmt.Sprint(positions) {
+			t.Errorf("alignmentPositions(%d) = %v, want %v", version, got, positions)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	// Table 7 of the standard, byte mode at level M.
+	want := []int{14, 26, 42, 62, 84, 106, 122, 152, 180, 213}
+	for i, n := range want {
+		if got := capacity(i + 1); got != n {
+			t.Errorf("capacity(%d) = %d, want %d", i+1, got, n)
+		}
+	}
+	if MaxLength != want[len(want)-1] {
+		t.Errorf("MaxLength = %d, want %d", MaxLength, want[len(want)-1])
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 14, 15, 26, 27, 62, 106, 122, 123, 180, MaxLength} {
+		data := []byte(strings.Repeat("TICKET-0123456789abcdef:", 10))[:n]
+		code, err := Encode(data)
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", n, err)
+		}
+		got, err := decode(code)
+		if err != nil {
+			t.Errorf("decode the code of %d bytes: %v", n, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("decode the code of %d bytes = %q, want %q", n, got, data)
+		}
+	}
+}
+
+func TestEncodeVersion(t *testing.T) {
+	tests := []struct{ n, size int }{{14, 21}, {15, 25}, {122, 45}, {123, 49}, {MaxLength, 57}}
+	for _, tt := range tests {
+		code, err := Encode(make([]byte, tt.n))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", tt.n, err)
+		}
+		if code.Size != tt.size {
+			t.Errorf("Encode(%d bytes).Size = %d, want %d", tt.n, code.Size, tt.size)
+		}
+	}
+	if _, err := Encode(make([]byte, MaxLength+1)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode(%d bytes): err = %v, want ErrTooLong", MaxLength+1, err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode([]byte("https://example.com/tickets/3f9c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const scale = 3
+	data, err := code.PNG(scale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode PNG: %v", err)
+	}
+	side := (code.Size + 2*quietZone) * scale
+	if b := img.Bounds(); b.Dx() != side || b.Dy() != side {
+		t.Fatalf("PNG is %dx%d, want %dx%d", b.Dx(), b.Dy(), side, side)
+	}
+	for y := range side {
+		for x := range side {
+			mx, my := x/scale-quietZone, y/scale-quietZone
+			dark := mx >= 0 && my >= 0 && mx < code.Size && my < code.Size && code.Dark(mx, my)
+			r, _, _, _ := img.At(x, y).RGBA()
+			if (r == 0) != dark {
+				t.Fatalf("pixel %d,%d: dark = %v, want %v", x, y, r == 0, dark)
+			}
+		}
+	}
+}
+
+// readFormat returns both copies of the format information of a grid, most
+// significant bit first.
+func readFormat(dark []bool, size int) (string, string) {
+	at := func(x, y int) bool { return dark[y*size+x] }
+	var first, second [15]bool
+	for i := 0; i <= 5; i++ {
+		first[i] = at(8, i)
+	}
+	first[6], first[7], first[8] = at(8, 7), at(8, 8), at(7, 8)
+	for i := 9; i < 15; i++ {
+		first[i] = at(14-i, 8)
+	}
+	for i := 0; i < 8; i++ {
+		second[i] = at(size-1-i, 8)
+	}
+	for i := 8; i < 15; i++ {
+		second[i] = at(8, size-15+i)
+	}
+	format := func(bits [15]bool) string {
+		var b strings.Builder
+		for i := 14; i >= 0; i-- {
+			if bits[i] {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		}
+		return b.String()
+	}
+	return format(first), format(second)
+}
+
+// decode reads a code back the way a scanner does: it reads the mask from
+// the format information, unmasks and reads the codewords, checks the error
+// correction of every block and parses the byte mode segment.
+func decode(c *Code) ([]byte, error) {
+	version := (c.Size - 17) / 4
+	layout := levelM[version-1]
+
+	first, second := readFormat(c.modules, c.Size)
+	if first != second {
+		return nil, fmt.Errorf("format information copies differ: %s and %s", first, second)
+	}
+	var format int
+	fmt.Sscanf(first, "%b", &format)
+	format ^= 0x5412
+	if level := format >> 13; level != 0 {
+		return nil, fmt.Errorf("error correction level bits %02b, want 00 (M)", level)
+	}
+	mask := format >> 10 & 7
+
+	// The standard's masks, in row i and column j.
+	masked := [8]func(i, j int) bool{
+		func(i, j int) bool { return (i+j)%2 == 0 },
+		func(i, j int) bool { return i%2 == 0 },
+		func(i, j int) bool { return j%3 == 0 },
+		func(i, j int) bool { return (i+j)%3 == 0 },
+		func(i, j int) bool { return (i/2+j/3)%2 == 0 },
+		func(i, j int) bool { return i*j%2+i*j%3 == 0 },
+		func(i, j int) bool { return (i*j%2+i*j%3)%2 == 0 },
+		func(i, j int) bool { return ((i+j)%2+i*j%3)%2 == 0 },
+	}[mask]
+
+	g := newGrid(version)
+	g.drawFunctionPatterns(version)
+	var bits bitBuffer
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range c.Size {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for _, x := range []int{right, right - 1} {
+				if !g.function[y*c.Size+x] {
+					bits = append(bits, c.Dark(x, y) != masked(y, x))
+				}
+			}
+		}
+	}
+	codewords := bits[:len(bits)/8*8].bytes()
+
+	// Undo the interleaving.
+	var blocks [][]byte
+	for _, group := range layout.groups {
+		for range group.blocks {
+			blocks = append(blocks, make([]byte, 0, group.dataLen+layout.ecPerBlock))
+		}
+	}
+	i := 0
+	for n := 0; i < layout.dataLen(); n++ {
+		for b, group := 0, 0; b < len(blocks); b++ {
+			if b == layout.groups[0].blocks {
+				group = 1
+			}
+			if n < layout.groups[group].dataLen {
+				blocks[b] = append(blocks[b], codewords[i])
+				i++
+			}
+		}
+	}
+	var data []byte
+	for b := range blocks {
+		data = append(data, blocks[b]...)
+	}
+	for range layout.ecPerBlock {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[i])
+			i++
+		}
+	}
+	for b, block := range blocks {
+		dataLen := len(block) - layout.ecPerBlock
+		if ec := rsRemainder(block[:dataLen], layout.ecPerBlock); !bytes.Equal(ec, block[dataLen:]) {
+			return nil, fmt.Errorf("block %d: error correction % X, want % X", b, block[dataLen:], ec)
+		}
+	}
+
+	var stream bitBuffer
+	for _, b := range data {
+		stream.append(int(b), 8)
+	}
+	read := func(n int) int {
+		v := 0
+		for range n {
+			v <<= 1
+			if stream[0] {
+				v |= 1
+			}
+			stream = stream[1:]
+		}
+		return v
+	}
+	if mode := read(4); mode != 0b0100 {
+		return nil, fmt.Errorf("mode %04b, want byte mode", mode)
+	}
+	n := read(countBits(version))
+	if n*8 > len(stream) {
+		return nil, fmt.Errorf("count %d exceeds the data", n)
+	}
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(read(8))
+	}
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package qr
+
+// rsRemainder returns the n Reed-Solomon error correction codewords of data:
+// the remainder of data, shifted by n codewords, divided by the generator
+// polynomial of degree n.
+func rsRemainder(data []byte, n int) []byte {
+	divisor := rsDivisor(n)
+	result := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[n-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// rsDivisor returns the coefficients of (x - α^0)(x - α^1)...(x - α^(n-1)),
+// highest power first, without the leading 1.
+func rsDivisor(n int) []byte {
+	result := make([]byte, n)
+	result[n-1] = 1
+	root := byte(1)
+	for range n {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < n {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
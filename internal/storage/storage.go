@@ -0,0 +1,40 @@
+// Package storage keeps uploaded files, such as event cover images and
+// attachments, in a blob store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned by a BlobStore asked for a key it doesn't hold.
+var ErrNotFound = errors.New("storage: blob not found")
+
+// BlobStore stores blobs under slash-separated keys such as
+// "events/12/3f9c.pdf". Deleting a key that doesn't exist is not an error.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// checkKey rejects keys that are empty or could escape the store: every
+// segment must be made of letters, digits, dots, hyphens and underscores, and
+// must not be "." or "..".
+func checkKey(key string) error {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+		for _, r := range segment {
+			ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_'
+			if !ok {
+				return fmt.Errorf("storage: invalid key %q", key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package thumbnail renders small JPEG previews of uploaded images.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// MaxPixels bounds the size of the images Make decodes, so a small but
+// highly compressed upload can't exhaust memory.
+const MaxPixels = 40_000_000
+
+var ErrTooLarge = errors.New("thumbnail: image has too many pixels")
+
+// CanMake reports whether Make can decode images of the given content type.
+func CanMake(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Make decodes a JPEG, PNG or GIF image and returns a JPEG that fits in a
+// maxSide by maxSide square, keeping the aspect ratio. Images that already
+// fit are not enlarged. Transparent areas become white.
+func Make(data []byte, maxSide int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(src, maxSide), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale shrinks src with a box filter: every pixel of the result is the
+// average of the source pixels it covers, composited over white.
+func scale(src image.Image, maxSide int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			w, h = maxSide, max(1, h*maxSide/b.Dx())
+		} else {
+			w, h = max(1, w*maxSide/b.Dy()), maxSide
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			// The colours are premultiplied by alpha, so adding the
+			// missing coverage as white composites over white.
+			white := 0xffff*n - a
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8((r + white) / n >> 8)
+			dst.Pix[i+1] = uint8((g + white) / n >> 8)
+			dst.Pix[i+2] = uint8((bl + white) / n >> 8)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
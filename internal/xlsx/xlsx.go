@@ -0,0 +1,150 @@
+// Package xlsx writes spreadsheets in the Office Open XML format read by
+// Excel, LibreOffice and Google Sheets. It covers what exports need: a
+// single sheet of text cells, written row by row as they come, so large
+// sheets are never held in memory.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxSheetName is the longest sheet name spreadsheet applications accept.
+const MaxSheetName = 31
+
+var ErrClosed = errors.New("xlsx: writer is closed")
+
+const header = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// parts are the files of the package besides the sheet itself.
+var parts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// Writer writes a workbook with one sheet. Rows are written with Write; the
+// workbook is only complete once Close returns.
+type Writer struct {
+	zw     *zip.Writer
+	sheet  *bufio.Writer
+	row    int
+	closed bool
+}
+
+// NewWriter starts a workbook on w whose sheet is called sheetName. Names
+// are shortened to MaxSheetName and characters spreadsheets don't allow in
+// them are replaced.
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range parts {
+		if err := writePart(zw, part.name, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	var workbook strings.Builder
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="`)
+	xml.EscapeText(&workbook, []byte(SheetName(sheetName)))
+	workbook.WriteString(`" sheetId="1" r:id="rId1"/></sheets></workbook>`)
+	if err := writePart(zw, "xl/workbook.xml", workbook.String()); err != nil {
+		return nil, err
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	sheet.WriteString(header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return &Writer{zw: zw, sheet: sheet}, nil
+}
+
+func writePart(zw *zip.Writer, name, content string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, header+content)
+	return err
+}
+
+// SheetName returns name as spreadsheets accept it as the name of a sheet.
+func SheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > MaxSheetName {
+		name = string(runes[:MaxSheetName])
+	}
+	if strings.TrimSpace(name) == "" {
+		return "Sheet1"
+	}
+	return name
+}
+
+// Write appends a row of text cells. Like csv.Writer it buffers; the
+// buffer is written out as it fills up.
+func (w *Writer) Write(record []string) error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.row++
+	row := strconv.Itoa(w.row)
+	w.sheet.WriteString(`<row r="` + row + `">`)
+	for i, value := range record {
+		if value == "" {
+			continue
+		}
+		w.sheet.WriteString(`<c r="` + ColumnName(i) + row + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(w.sheet, []byte(value)); err != nil {
+			return err
+		}
+		w.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := w.sheet.WriteString(`</row>`)
+	return err
+}
+
+// Close finishes the sheet and the workbook. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	w.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// ColumnName returns the letters of the column with the given zero-based
+// index: A to Z, then AA, AB and so on.
+func ColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
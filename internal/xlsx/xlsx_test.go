@@ -0,0 +1,184 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		i    int
+		want string
+	}{
+		{0, "A"}, {1, "B"}, {25, "Z"}, {26, "AA"}, {27, "AB"}, {51, "AZ"}, {52, "BA"},
+		{701, "ZZ"}, {702, "AAA"}, {16383, "XFD"}, // the last column Excel has
+	}
+	for _, tt := range tests {
+		if got := ColumnName(tt.i); got != tt.want {
+			t.Errorf("ColumnName(%d) = %q, want %q", tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestSheetName(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"Attendees", "Attendees"},
+		{"Q1/Q2: [draft]?*\\", "Q1_Q2_ _draft____"},
+		{"", "Sheet1"},
+		{"   ", "Sheet1"},
+		{strings.Repeat("é", 40), strings.Repeat("é", MaxSheetName)},
+	}
+	for _, tt := range tests {
+		if got := SheetName(tt.name); got != tt.want {
+			t.Errorf("SheetName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// sheet is the part of the worksheet schema the writer produces.
+type sheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R    string `xml:"r,attr"`
+			T    string `xml:"t,attr"`
+			Text string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+type workbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// readPackage returns the parts of a workbook by name.
+func readPackage(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+	}
+	return files
+}
+
+func TestWriter(t *testing.T) {
+	records := [][]string{
+		{"Name", "Email", "Note"},
+		{"Ada <Lovelace>", "ada@example.com", "Tom & Jerry \"quoted\""},
+		{"", "skipped@example.com", "  leading and trailing  "},
+		{"Zoë 日本", "", "two\nlines"},
+		{},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Attendees: [Launch]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	files := readPackage(t, buf.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels", "xl/workbook.xml", "xl/worksheets/sheet1.xml"} {
+		content, ok := files[name]
+		if !ok {
+			t.Errorf("part %s is missing", name)
+			continue
+		}
+		// Every part must be well-formed XML.
+		d := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("part %s: %v", name, err)
+				break
+			}
+		}
+	}
+
+	var wb workbook
+	if err := xml.Unmarshal(files["xl/workbook.xml"], &wb); err != nil {
+		t.Fatalf("parse workbook: %v", err)
+	}
+	if len(wb.Sheets) != 1 || wb.Sheets[0].Name != "Attendees_ _Launch_" || wb.Sheets[0].ID != "rId1" {
+		t.Errorf("sheets = %+v, want one sheet Attendees_ _Launch_ with id rId1", wb.Sheets)
+	}
+
+	var s sheet
+	if err := xml.Unmarshal(files["xl/worksheets/sheet1.xml"], &s); err != nil {
+		t.Fatalf("parse sheet: %v", err)
+	}
+	if len(s.Rows) != len(records) {
+		t.Fatalf("sheet has %d rows, want %d", len(s.Rows), len(records))
+	}
+	for i, record := range records {
+		row := s.Rows[i]
+		if row.R != i+1 {
+			t.Errorf("row %d: r = %d, want %d", i, row.R, i+1)
+		}
+		got := make([]string, len(record))
+		columns := map[string]int{}
+		for j := range record {
+			columns[ColumnName(j)+strconv.Itoa(i+1)] = j
+		}
+		for _, c := range row.Cells {
+			if c.T != "inlineStr" {
+				t.Errorf("cell %s: type %q, want inlineStr", c.R, c.T)
+			}
+			j, ok := columns[c.R]
+			if !ok {
+				t.Errorf("row %d: unexpected cell %s", i+1, c.R)
+				continue
+			}
+			got[j] = c.Text
+		}
+		if !reflect.DeepEqual(got, record) {
+			t.Errorf("row %d = %q, want %q", i+1, got, record)
+		}
+	}
+}
+
+func TestWriterClosed(t *testing.T) {
+	w, err := NewWriter(io.Discard, "Sheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]string{"late"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write after Close: err = %v, want ErrClosed", err)
+	}
+	if err := w.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("second Close: err = %v, want ErrClosed", err)
+	}
+}